@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/auditsink"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/webhooks"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	// oneTimePasswordLen - длина случайной части пароля при сбросе, байт
+	oneTimePasswordLen = 16
+	// adminUserAgent - User-Agent событий журнала аудита, записанных командами администрирования
+	adminUserAgent = "gophkeeper admin"
+	// adminAuditFlushTimeout - сколько ждать отправки событий аудита во внешние приемники при выходе
+	adminAuditFlushTimeout = 5 * time.Second
+)
+
+var (
+	// quotaMaxRecords, quotaMaxBytes, quotaMaxRecordSize - квоты пользователя для admin quota
+	quotaMaxRecords    int64
+	quotaMaxBytes      int64
+	quotaMaxRecordSize int64
+	// quotaReset - сброс квот пользователя к значениям по умолчанию
+	quotaReset bool
+)
+
+// adminStore - хранилище с управлением учетными записями
+type adminStore interface {
+	store.Store
+	store.UserAdmin
+}
+
+// adminEnv - окружение команды администрирования
+type adminEnv struct {
+	logger *zap.SugaredLogger
+	config *config.ServerConfig
+	store  adminStore
+	// auditSinks - внешние приемники событий аудита из конфигурации, nil - не настроены
+	auditSinks *auditsink.Dispatcher
+}
+
+// init - команды администрирования пользователей
+func init() {
+	adminCmd.AddCommand(adminUsersCmd)
+	adminCmd.AddCommand(adminDisableCmd)
+	adminCmd.AddCommand(adminEnableCmd)
+	adminCmd.AddCommand(adminLogoutCmd)
+	adminCmd.AddCommand(adminResetPasswordCmd)
+	adminCmd.AddCommand(adminUsageCmd)
+	adminQuotaCmd.Flags().Int64Var(&quotaMaxRecords, "max-records", 0, "max number of records, 0 - unlimited")
+	adminQuotaCmd.Flags().Int64Var(&quotaMaxBytes, "max-bytes", 0, "max total size of records in bytes, 0 - unlimited")
+	adminQuotaCmd.Flags().Int64Var(&quotaMaxRecordSize, "max-record-size", 0,
+		"max size of a single record in bytes, 0 - unlimited")
+	adminQuotaCmd.Flags().BoolVar(&quotaReset, "reset", false, "return the user to the default quotas")
+	adminCmd.AddCommand(adminQuotaCmd)
+	adminAuditCmd.AddCommand(adminAuditVerifyCmd)
+	adminCmd.AddCommand(adminAuditCmd)
+	rootCmd.AddCommand(adminCmd)
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin [sub]",
+	Short: "Manage user accounts directly in the store",
+}
+
+var adminUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "List users with record counts and last login",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminStore(func(ctx context.Context, a *adminEnv) error {
+			users, err := a.store.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tLOGIN\tRECORDS\tLAST LOGIN\tSTATUS")
+			for _, u := range users {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", u.ID, u.Login, u.Records, formatTime(u.LastLoginAt), userStatus(&u.User))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var adminDisableCmd = &cobra.Command{
+	Use:   "disable <login>",
+	Short: "Disable an account: login and all requests with its tokens are rejected",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			if err := a.store.SetUserDisabled(ctx, u.ID, true); err != nil {
+				return err
+			}
+			if err := a.accountEvent(ctx, u.ID, models.AuditAccountDisabled, models.WebhookAccountDisabled); err != nil {
+				return err
+			}
+			a.logger.Infof("user %s disabled", u.Login)
+			return nil
+		})
+	},
+}
+
+var adminEnableCmd = &cobra.Command{
+	Use:   "enable <login>",
+	Short: "Enable a disabled account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			if err := a.store.SetUserDisabled(ctx, u.ID, false); err != nil {
+				return err
+			}
+			if err := a.accountEvent(ctx, u.ID, models.AuditAccountEnabled, models.WebhookAccountEnabled); err != nil {
+				return err
+			}
+			a.logger.Infof("user %s enabled", u.Login)
+			return nil
+		})
+	},
+}
+
+var adminLogoutCmd = &cobra.Command{
+	Use:   "logout <login>",
+	Short: "Force logout of all sessions: tokens issued before now are rejected",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			if err := a.store.RevokeSessions(ctx, u.ID); err != nil {
+				return err
+			}
+			if err := a.accountEvent(ctx, u.ID, models.AuditSessionsRevoked, models.WebhookSessionsRevoked); err != nil {
+				return err
+			}
+			a.logger.Infof("all sessions of user %s revoked", u.Login)
+			return nil
+		})
+	},
+}
+
+var adminResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password <login>",
+	Short: "Reset the password to a random one-time value and revoke all sessions",
+	Long: "Sets a random password, prints it once to stdout and revokes all sessions of the user. " +
+		"Pass the password to the user over a secure channel. The password only lets the user set a new one " +
+		"(POST /api/user/password, `gclient login` asks for it): login with it is rejected until then.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			password, err := oneTimePassword()
+			if err != nil {
+				return err
+			}
+			if err := a.store.SetPassword(ctx, u.ID, password); err != nil {
+				return err
+			}
+			if err := a.store.RevokeSessions(ctx, u.ID); err != nil {
+				return err
+			}
+			if err := a.accountEvent(ctx, u.ID, models.AuditPasswordReset, models.WebhookPasswordReset); err != nil {
+				return err
+			}
+			a.logger.Infof("password of user %s reset, all sessions revoked", u.Login)
+			fmt.Println(password)
+			return nil
+		})
+	},
+}
+
+var adminUsageCmd = &cobra.Command{
+	Use:   "usage <login>",
+	Short: "Show storage usage of a user against quotas, including the ./userdata folder",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			usage, override, err := a.userUsage(ctx, u.ID)
+			if err != nil {
+				return err
+			}
+			folderSize, err := u.FolderSize()
+			if err != nil {
+				return fmt.Errorf("error reading user folder: %w", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "user:\t%s (id %d, %s)\n", u.Login, u.ID, userStatus(u))
+			fmt.Fprintf(w, "records:\t%d of %s\n", usage.Records, formatLimit(usage.Limits.MaxRecords,
+				override.MaxRecords))
+			fmt.Fprintf(w, "record data:\t%d bytes of %s\n", usage.Bytes, formatLimit(usage.Limits.MaxBytes,
+				override.MaxBytes))
+			fmt.Fprintf(w, "record size limit:\t%s\n", formatLimit(usage.Limits.MaxRecordSize, override.MaxRecordSize))
+			fmt.Fprintf(w, "folder %s:\t%d bytes\n", u.FolderPath(), folderSize)
+			fmt.Fprintf(w, "total:\t%d bytes\n", usage.Bytes+folderSize)
+			return w.Flush()
+		})
+	},
+}
+
+var adminQuotaCmd = &cobra.Command{
+	Use:   "quota <login>",
+	Short: "Override storage quotas of a user",
+	Long: "Sets per-user quotas over the server defaults (QUOTA_MAX_RECORDS, QUOTA_MAX_BYTES, " +
+		"QUOTA_MAX_RECORD_SIZE). 0 means unlimited, --reset returns the user to the defaults. " +
+		"Without flags shows the current quotas.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminUser(args[0], func(ctx context.Context, a *adminEnv, u *models.User) error {
+			override, err := a.store.GetQuotaOverride(ctx, u.ID)
+			if err != nil {
+				return err
+			}
+			if quotaReset {
+				override = &models.QuotaOverride{}
+			}
+			flags := []struct {
+				name  string
+				value int64
+				field **int64
+			}{
+				{"max-records", quotaMaxRecords, &override.MaxRecords},
+				{"max-bytes", quotaMaxBytes, &override.MaxBytes},
+				{"max-record-size", quotaMaxRecordSize, &override.MaxRecordSize},
+			}
+			changed := quotaReset
+			for _, f := range flags {
+				if !cmd.Flags().Changed(f.name) {
+					continue
+				}
+				if f.value < 0 {
+					return fmt.Errorf("--%s must not be negative", f.name)
+				}
+				value := f.value
+				*f.field = &value
+				changed = true
+			}
+			if changed {
+				if err := a.store.SetQuotaOverride(ctx, u.ID, override); err != nil {
+					return err
+				}
+				a.logger.Infof("quotas of user %s updated", u.Login)
+			}
+			limits := a.config.Quota().Apply(override)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "max records:\t%s\n", formatLimit(limits.MaxRecords, override.MaxRecords))
+			fmt.Fprintf(w, "max bytes:\t%s\n", formatLimit(limits.MaxBytes, override.MaxBytes))
+			fmt.Fprintf(w, "max record size:\t%s\n", formatLimit(limits.MaxRecordSize, override.MaxRecordSize))
+			return w.Flush()
+		})
+	},
+}
+
+var adminAuditCmd = &cobra.Command{
+	Use:   "audit [sub]",
+	Short: "Inspect the audit log",
+}
+
+var adminAuditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the hash chain of the audit log",
+	Long: "Recomputes the hash of every audit event and checks that it links to the previous one. " +
+		"A modified, deleted or inserted event breaks the chain. Removal of the newest events is not detected: " +
+		"compare the printed last hash with a previously saved one.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAdminStore(func(ctx context.Context, a *adminEnv) error {
+			count, last, err := store.VerifyAuditChain(ctx, a.store)
+			if err != nil {
+				if last != nil {
+					a.logger.Errorf("last valid event: %d", last.ID)
+				}
+				return err
+			}
+			if last == nil {
+				fmt.Println("audit log is empty")
+				return nil
+			}
+			fmt.Printf("audit chain is valid: %d events, last event %d at %s, hash %s\n", count, last.ID,
+				last.CreatedAt.Local().Format(time.DateTime), last.Hash)
+			return nil
+		})
+	},
+}
+
+// withAdminStore - открытие хранилища из конфигурации и вызов fn. Хранилище в памяти не поддерживается:
+// команды работают в отдельном процессе и не видят данных запущенного сервера.
+func withAdminStore(fn func(ctx context.Context, a *adminEnv) error) error {
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelCtx()
+
+	l, err := logger.NewLogger()
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	c, err := loadConfig(l)
+	if err != nil {
+		return err
+	}
+	s, err := store.Open(ctx, c)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+	defer s.Close()
+	as, ok := s.(adminStore)
+	if _, persistent := s.(store.Migratable); !ok || !persistent {
+		return errors.New("admin commands require a persistent store: use a postgres:// or sqlite:// DSN")
+	}
+	if err := prepareSchema(ctx, l, s, false); err != nil {
+		return err
+	}
+	auditSinks, err := auditsink.FromConfig(c, l.Named("audit"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to set up audit export: %w", err)
+	}
+	defer func() {
+		ctx, cancelCtx := context.WithTimeout(context.Background(), adminAuditFlushTimeout)
+		defer cancelCtx()
+		if err := auditSinks.Close(ctx); err != nil {
+			l.Errorf("an error occurred during audit export shutdown: %v", err)
+		}
+	}()
+	return fn(ctx, &adminEnv{logger: l.Named("admin"), config: c, store: as, auditSinks: auditSinks})
+}
+
+// withAdminUser - вызов fn для пользователя с логином login
+func withAdminUser(login string, fn func(ctx context.Context, a *adminEnv, u *models.User) error) error {
+	return withAdminStore(func(ctx context.Context, a *adminEnv) error {
+		u, err := a.store.GetUser(ctx, &models.User{Login: login})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("user %q not found", login)
+			}
+			return err
+		}
+		return fn(ctx, a, u)
+	})
+}
+
+// accountEvent - запись действия администратора над пользователем userID в журнал аудита и постановка
+// события в очередь вебхуков пользователя; события доставит запущенный сервер
+func (a *adminEnv) accountEvent(ctx context.Context, userID uint64, action, event string) error {
+	e := &models.AuditEvent{UserID: userID, Action: action, UserAgent: adminUserAgent}
+	if err := a.store.AppendAuditEvent(ctx, e); err != nil {
+		return fmt.Errorf("error writing audit event: %w", err)
+	}
+	a.auditSinks.Publish(e)
+	if _, err := webhooks.Enqueue(ctx, a.store, userID, event, models.WebhookPayload{}); err != nil {
+		return fmt.Errorf("error enqueueing webhook event: %w", err)
+	}
+	return nil
+}
+
+// userUsage - использование хранилища пользователем с квотами и заданные ему администратором значения
+func (a *adminEnv) userUsage(ctx context.Context, userID uint64) (*models.Usage, *models.QuotaOverride, error) {
+	usage, err := a.store.GetUsage(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	override, err := a.store.GetQuotaOverride(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	usage.Limits = a.config.Quota().Apply(override)
+	return usage, override, nil
+}
+
+// formatLimit - квота для вывода с пометкой, задана ли она пользователю
+func formatLimit(limit int64, override *int64) string {
+	value := "unlimited"
+	if limit > 0 {
+		value = fmt.Sprint(limit)
+	}
+	if override != nil {
+		return value + " (user override)"
+	}
+	return value + " (default)"
+}
+
+// oneTimePassword - случайный пароль для сброса
+func oneTimePassword() (string, error) {
+	b := make([]byte, oneTimePasswordLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// userStatus - состояние учетной записи для вывода
+func userStatus(u *models.User) string {
+	if u.DisabledAt != nil {
+		return "disabled since " + formatTime(u.DisabledAt)
+	}
+	if u.MustChangePassword {
+		return "active, password reset"
+	}
+	return "active"
+}
+
+// formatTime - время для вывода, "never" для nil
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/certs"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// certHosts - DNS имена и IP адреса сертификата сервера
+	certHosts []string
+	// certKeyType - тип ключей: ecdsa или rsa
+	certKeyType string
+	// certDays - срок действия сертификата сервера в днях
+	certDays int
+	// caDays - срок действия CA в днях
+	caDays int
+	// caCertPath, caKeyPath - файлы CA, по умолчанию ca.pem и ca-key.pem рядом с сертификатом сервера
+	caCertPath string
+	caKeyPath  string
+	// certForce - перезаписать сертификат сервера (init) или перевыпустить его независимо от срока (renew)
+	certForce bool
+	// renewBefore - перевыпускать сертификат, если до истечения осталось меньше
+	renewBefore time.Duration
+)
+
+// init - команды управления TLS сертификатами
+func init() {
+	for _, c := range []*cobra.Command{certsInitCmd, certsRenewCmd} {
+		c.Flags().StringSliceVar(&certHosts, "host", nil,
+			"DNS name or IP address of the server, repeatable (default localhost,127.0.0.1,::1; renew keeps current)")
+		c.Flags().StringVar(&certKeyType, "key-type", "", "key type: ecdsa (default) or rsa")
+		c.Flags().IntVar(&certDays, "days", 365, "server certificate validity in days")
+		c.Flags().StringVar(&caCertPath, "ca-cert", "", "CA certificate file (default ca.pem next to the server certificate)")
+		c.Flags().StringVar(&caKeyPath, "ca-key", "", "CA key file (default ca-key.pem next to the server certificate)")
+		c.Flags().BoolVar(&certForce, "force", false, "overwrite (init) or reissue regardless of expiry (renew)")
+	}
+	certsInitCmd.Flags().IntVar(&caDays, "ca-days", 3650, "CA validity in days, used when the CA is created")
+	certsRenewCmd.Flags().DurationVar(&renewBefore, "before", certs.DefaultRenewBefore,
+		"reissue when the certificate expires within this duration")
+	certsCmd.AddCommand(certsInitCmd)
+	certsCmd.AddCommand(certsRenewCmd)
+	rootCmd.AddCommand(certsCmd)
+}
+
+var certsCmd = &cobra.Command{
+	Use:   "certs [sub]",
+	Short: "Manage the local CA and the server TLS certificate",
+}
+
+var certsInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a local CA and a server certificate signed by it",
+	Long: "Creates a local CA (unless it already exists) and issues the server certificate to TLS_CERT_PATH and " +
+		"TLS_KEY_PATH. Clients trust the server with --ca-cert pointing to the CA certificate.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		caOpts := certs.Options{KeyType: certKeyType, Validity: days(caDays)}
+		opts := certs.Options{Hosts: certHosts, KeyType: certKeyType, Validity: days(certDays)}
+		if _, err := certs.Init(paths, caOpts, opts, certForce); err != nil {
+			return err
+		}
+		fmt.Printf("CA certificate: %s\nserver certificate: %s\nserver key: %s\n", paths.CACert, c.TLSCertPath, c.TLSKeyPath)
+		return nil
+	},
+}
+
+var certsRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Reissue the server certificate before it expires",
+	Long: "Reissues the server certificate with the local CA if it expires within --before. A running server " +
+		"picks up the new certificate on SIGHUP.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, paths, err := certPaths()
+		if err != nil {
+			return err
+		}
+		opts := certs.Options{Hosts: certHosts, KeyType: certKeyType, Validity: days(certDays)}
+		renewed, notAfter, err := certs.Renew(paths, opts, renewBefore, certForce)
+		if err != nil {
+			return err
+		}
+		if !renewed {
+			fmt.Printf("certificate is valid until %s, nothing to do\n", notAfter.UTC().Format(time.RFC3339))
+			return nil
+		}
+		fmt.Printf("certificate renewed, valid until %s; send SIGHUP to the server to reload it\n",
+			notAfter.UTC().Format(time.RFC3339))
+		return nil
+	},
+}
+
+// certPaths - пути к файлам сертификатов из конфигурации и флагов
+func certPaths() (*config.ServerConfig, certs.Paths, error) {
+	l, err := logger.NewLogger()
+	if err != nil {
+		return nil, certs.Paths{}, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	c, err := config.Load(l, configFlags)
+	if err != nil {
+		return nil, certs.Paths{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	paths := certs.Paths{CACert: caCertPath, CAKey: caKeyPath, Cert: c.TLSCertPath, Key: c.TLSKeyPath}
+	defaultCert, defaultKey := certs.CAPaths(c.TLSCertPath)
+	if paths.CACert == "" {
+		paths.CACert = defaultCert
+	}
+	if paths.CAKey == "" {
+		paths.CAKey = defaultKey
+	}
+	return c, paths, nil
+}
+
+// days - количество дней в виде time.Duration
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
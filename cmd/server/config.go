@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+// printRedacted - скрывать пароли и ключи при выводе конфигурации
+var printRedacted bool
+
+// init - команды работы с конфигурацией
+func init() {
+	configPrintCmd.Flags().BoolVar(&printRedacted, "redacted", false, "hide passwords and keys")
+	configCmd.AddCommand(configPrintCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config [sub]",
+	Short: "Inspect server configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration as JSON",
+	Long: "Prints the configuration after applying defaults, config file, environment and flags. " +
+		"Validation errors are reported to stderr, the configuration is printed anyway.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		l, err := logger.NewLogger()
+		if err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		c, err := config.Load(l, configFlags)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := c.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		}
+		out := *c
+		if printRedacted {
+			out = c.Redacted()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	},
+}
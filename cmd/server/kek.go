@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/envelope"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// newKEKFile - файл с новым KEK для ротации
+	newKEKFile string
+	// newKEK - новый KEK в base64 для ротации
+	newKEK string
+)
+
+// init - команды управления ключом шифрования ключей (KEK)
+func init() {
+	kekRotateCmd.Flags().StringVar(&newKEKFile, "new-kek-file", "", "file with the new KEK (32 raw bytes or base64)")
+	kekRotateCmd.Flags().StringVar(&newKEK, "new-kek", "", "new KEK in base64")
+	kekCmd.AddCommand(kekGenerateCmd)
+	kekCmd.AddCommand(kekRotateCmd)
+	rootCmd.AddCommand(kekCmd)
+}
+
+var kekCmd = &cobra.Command{
+	Use:   "kek [sub]",
+	Short: "Manage the key-encryption key of server-side encryption",
+}
+
+var kekGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Print a new random KEK in base64",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return nil
+	},
+}
+
+var kekRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rewrap all users' data keys with a new KEK",
+	Long: "Rewraps all users' data keys from the configured KEK (KEK_FILE or KEK) to the new one in a single " +
+		"transaction. Record payloads are not re-encrypted. After rotation switch the server config to the new KEK.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancelCtx()
+
+		next, err := envelope.LoadKEK(newKEKFile, newKEK)
+		if err != nil {
+			return fmt.Errorf("failed to load new KEK: %w", err)
+		}
+		if next == nil {
+			return errors.New("new KEK is required: use --new-kek-file or --new-kek")
+		}
+		l, err := logger.NewLogger()
+		if err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		c, err := loadConfig(l)
+		if err != nil {
+			return err
+		}
+		s, err := store.Open(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %w", err)
+		}
+		defer s.Close()
+		r, ok := s.(store.KeyRotator)
+		if !ok {
+			return fmt.Errorf("store %q does not support server-side encryption", c.DatabaseDSN)
+		}
+		n, err := r.RewrapDataKeys(ctx, next)
+		if err != nil {
+			return fmt.Errorf("failed to rotate KEK: %w", err)
+		}
+		l.Named("kek").Infof("rewrapped %d data key(s) with KEK %s", n, next.ID())
+		return nil
+	},
+}
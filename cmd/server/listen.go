@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/listeners"
+	"go.uber.org/zap"
+)
+
+// serverListeners - листенеры сервера: основной, перенаправление HTTP на HTTPS и unix сокет (последние два необязательны)
+type serverListeners struct {
+	main     net.Listener
+	redirect net.Listener
+	unix     net.Listener
+}
+
+// openListeners - листенеры из активации сокетами systemd, недостающие открываются по конфигурации
+func openListeners(c *config.ServerConfig, l *zap.SugaredLogger) (*serverListeners, error) {
+	activated, err := listeners.Systemd()
+	if err != nil {
+		return nil, err
+	}
+	ls := &serverListeners{main: activated[listeners.Main], redirect: activated[listeners.Redirect], unix: activated[listeners.Unix]}
+	for name, ln := range activated {
+		l.Infof("using systemd socket %q on %s", name, ln.Addr())
+	}
+	if len(activated) > ls.count() {
+		ls.close()
+		return nil, errors.New("unknown systemd socket name: use main, redirect or unix")
+	}
+	if ls.redirect != nil && !c.EnableHTTPS {
+		ls.close()
+		return nil, errors.New("systemd redirect socket requires ENABLE_HTTPS")
+	}
+	if ls.main == nil {
+		if ls.main, err = net.Listen("tcp", c.RunAddr); err != nil {
+			ls.close()
+			return nil, fmt.Errorf("error listening on %s: %w", c.RunAddr, err)
+		}
+	}
+	if ls.redirect == nil && c.HTTPRedirectAddr != "" {
+		if ls.redirect, err = net.Listen("tcp", c.HTTPRedirectAddr); err != nil {
+			ls.close()
+			return nil, fmt.Errorf("error listening on %s: %w", c.HTTPRedirectAddr, err)
+		}
+	}
+	if ls.unix == nil && c.UnixSocket != "" {
+		if ls.unix, err = listeners.ListenUnix(c.UnixSocket); err != nil {
+			ls.close()
+			return nil, err
+		}
+	}
+	return ls, nil
+}
+
+// count - количество открытых листенеров
+func (ls *serverListeners) count() int {
+	n := 0
+	for _, ln := range []net.Listener{ls.main, ls.redirect, ls.unix} {
+		if ln != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// close - закрытие открытых листенеров
+func (ls *serverListeners) close() {
+	for _, ln := range []net.Listener{ls.main, ls.redirect, ls.unix} {
+		if ln != nil {
+			_ = ln.Close()
+		}
+	}
+}
+
+// redirectServer - HTTP сервер, перенаправляющий на порт основного листенера по HTTPS
+func (ls *serverListeners) redirectServer() *http.Server {
+	_, port, _ := net.SplitHostPort(ls.main.Addr().String())
+	return &http.Server{Handler: listeners.RedirectHandler(port), ReadHeaderTimeout: timeoutServerShutdown}
+}
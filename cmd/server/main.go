@@ -1,15 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/buildinfo"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/app"
-	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/auditsink"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/certs"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/tracing"
+	"go.uber.org/zap"
 	"log"
 	"net/http"
 	"os"
@@ -24,7 +28,7 @@ const (
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -38,74 +42,174 @@ func run() error {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	c, err := config.Load(l)
+	c, err := loadConfig(l)
 	if err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+		return err
 	}
-
-	conn, err := store.NewPostgresConnection(c)
+	level, err := zap.ParseAtomicLevel(c.LogLevel)
 	if err != nil {
-		return fmt.Errorf("failed new postgres connection: %w", err)
+		return fmt.Errorf("failed to parse log level: %w", err)
+	}
+	l, err = logger.NewLoggerWithLevel(level)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	s := store.NewStore(conn)
-	err = conn.Ping()
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		ServiceName: app.ServiceName,
+		Exporter:    c.TraceExporter,
+		Endpoint:    c.TraceEndpoint,
+		Insecure:    c.TraceInsecure,
+		File:        c.TraceFile,
+		SampleRatio: c.TraceSampleRatio,
+	})
 	if err != nil {
-		return fmt.Errorf("failed ping database: %w", err)
+		return fmt.Errorf("failed to set up tracing: %w", err)
 	}
+	defer func() {
+		ctx, cancelCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
+		defer cancelCtx()
+		if err := shutdownTracing(ctx); err != nil {
+			l.Errorf("failed to flush traces: %v", err)
+		}
+	}()
 
 	wg := &sync.WaitGroup{}
 	defer func() {
 		wg.Wait()
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer l.Info("closed DB")
-		defer wg.Done()
-		<-ctx.Done()
-		defer conn.Close()
+	if devMode {
+		l.Warn("using in-memory store: all data will be lost on shutdown. Use only for development")
+	}
+
+	reload := &reloader{current: *c, level: level, logger: l}
+	if c.EnableHTTPS {
+		if err := ensureCertificates(c.TLSCertPath, c.TLSKeyPath, l); err != nil {
+			return err
+		}
+		reload.certs, err = app.NewCertReloader(c.TLSCertPath, c.TLSKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	ls, err := openListeners(c, l)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(ctx, c)
+	if err != nil {
+		ls.close()
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+
+	err = s.Ping(ctx)
+	if err != nil {
+		ls.close()
+		_ = s.Close()
+		return fmt.Errorf("failed ping database: %w", err)
+	}
+
+	if err := prepareSchema(ctx, l, s, c.AutoMigrate || migrateOnStart); err != nil {
+		ls.close()
+		_ = s.Close()
+		return err
+	}
+
+	// storeUsers - сервер и фоновые обработчики: хранилище закрывается только после их завершения
+	storeUsers := &sync.WaitGroup{}
+	defer func() {
+		storeUsers.Wait()
+		if err := s.Close(); err != nil {
+			l.Errorf("an error occurred during DB close: %v", err)
+		}
+		l.Info("closed DB")
 	}()
 
 	componentsErrs := make(chan error, 1)
 
-	a := app.NewApp(c, s, l.Named("app"))
+	m := metrics.New(s)
+	auditSinks, err := auditsink.FromConfig(c, l.Named("audit"), m)
+	if err != nil {
+		ls.close()
+		cancelCtx()
+		return fmt.Errorf("failed to set up audit export: %w", err)
+	}
+	a := app.NewApp(c, s, l.Named("app"), m, auditSinks)
+	reload.app = a
 	srv, err := a.NewServer()
 	if err != nil {
 		l.Fatalf("error creating server: %w", err)
 	}
+	storeUsers.Add(1)
+	go func() {
+		defer storeUsers.Done()
+		a.RunWebhooks(ctx)
+	}()
+	storeUsers.Add(1)
+	go func() {
+		defer storeUsers.Done()
+		a.RunEvents(ctx)
+	}()
+	storeUsers.Add(1)
+	go func() {
+		defer storeUsers.Done()
+		a.RunIdempotencyPurge(ctx)
+	}()
+	storeUsers.Add(1)
+	go func() {
+		defer storeUsers.Done()
+		a.RunTombstonePurge(ctx)
+	}()
+	l.Infof("gophkeeper %s", buildinfo.Get())
 
-	go func(errs chan<- error) {
-		if c.EnableHTTPS {
-			_, errCert := os.ReadFile(c.TLSCertPath)
-			_, errKey := os.ReadFile(c.TLSKeyPath)
-			if errors.Is(errCert, os.ErrNotExist) || errors.Is(errKey, os.ErrNotExist) {
-				privateKey, certBytes, err := app.CreateCertificates(l.Named("certs-builder"))
-				if err != nil {
-					errs <- fmt.Errorf("error creating tls certs: %w", err)
-					return
-				}
-				if err := app.WriteCertificates(certBytes, c.TLSCertPath, privateKey, c.TLSKeyPath, l); err != nil {
-					errs <- fmt.Errorf("error writing tls certs: %w", err)
-					return
-				}
+	if c.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		metricsSrv := &http.Server{Addr: c.MetricsAddr, Handler: mux, ReadHeaderTimeout: timeoutServerShutdown}
+		go func(errs chan<- error) {
+			l.Infof("serving metrics on %s", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("run metrics server has failed: %w", err)
 			}
-			srv.TLSConfig = &tls.Config{
-				MinVersion:         tls.VersionTLS12,
-				ClientAuth:         tls.RequestClientCert,
-				KeyLogWriter:       bufio.NewWriter(os.Stdout),
-				InsecureSkipVerify: true,
+		}(componentsErrs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
+			defer cancelShutdownTimeoutCtx()
+			if err := metricsSrv.Shutdown(shutdownTimeoutCtx); err != nil {
+				l.Errorf("an error occurred during metrics server shutdown: %v", err)
 			}
-			if err := srv.ListenAndServeTLS(c.TLSCertPath, c.TLSKeyPath); err != nil {
-				if errors.Is(err, http.ErrServerClosed) {
-					return
-				}
+		}()
+	}
+
+	if reload.certs != nil {
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reload.certs.GetCertificate,
+		}
+		if err := app.ClientTLS(c, srv.TLSConfig); err != nil {
+			ls.close()
+			cancelCtx()
+			return err
+		}
+	}
+	go reload.watch(ctx)
+
+	go func(errs chan<- error) {
+		if c.EnableHTTPS {
+			l.Infof("serving https server %s", ls.main.Addr())
+			if err := srv.ServeTLS(ls.main, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				errs <- fmt.Errorf("run tls server has failed: %w", err)
-				return
 			}
+			return
 		}
-		l.Infof("serving http server %s without TLS: Use only for development", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil {
+		l.Infof("serving http server %s without TLS: Use only for development", ls.main.Addr())
+		if err := srv.Serve(ls.main); err != nil {
 			if errors.Is(err, http.ErrServerClosed) {
 				return
 			}
@@ -113,10 +217,20 @@ func run() error {
 		}
 	}(componentsErrs)
 
-	wg.Add(1)
+	// unix сокет обслуживается тем же сервером без TLS, Shutdown закрывает его вместе с основным листенером
+	if ls.unix != nil {
+		go func(errs chan<- error) {
+			l.Infof("serving http server on unix socket %s", ls.unix.Addr())
+			if err := srv.Serve(ls.unix); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("run unix socket server has failed: %w", err)
+			}
+		}(componentsErrs)
+	}
+
+	storeUsers.Add(1)
 	go func() {
 		defer l.Info("server has been shutdown")
-		defer wg.Done()
+		defer storeUsers.Done()
 		<-ctx.Done()
 
 		shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
@@ -124,8 +238,31 @@ func run() error {
 		if err := srv.Shutdown(shutdownTimeoutCtx); err != nil {
 			l.Errorf("an error occurred during server shutdown: %v", err)
 		}
+		if err := auditSinks.Close(shutdownTimeoutCtx); err != nil {
+			l.Errorf("an error occurred during audit export shutdown: %v", err)
+		}
 	}()
 
+	if ls.redirect != nil {
+		redirectSrv := ls.redirectServer()
+		go func(errs chan<- error) {
+			l.Infof("redirecting http on %s to https", ls.redirect.Addr())
+			if err := redirectSrv.Serve(ls.redirect); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("run redirect server has failed: %w", err)
+			}
+		}(componentsErrs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
+			defer cancelShutdownTimeoutCtx()
+			if err := redirectSrv.Shutdown(shutdownTimeoutCtx); err != nil {
+				l.Errorf("an error occurred during redirect server shutdown: %v", err)
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 	case err := <-componentsErrs:
@@ -142,3 +279,20 @@ func run() error {
 
 	return nil
 }
+
+// ensureCertificates - если файлов сертификата или ключа нет, создает локальный CA (см. certs init)
+// и сертификат сервера для localhost
+func ensureCertificates(certPath, keyPath string, l *zap.SugaredLogger) error {
+	_, errCert := os.Stat(certPath)
+	_, errKey := os.Stat(keyPath)
+	if !errors.Is(errCert, os.ErrNotExist) && !errors.Is(errKey, os.ErrNotExist) {
+		return nil
+	}
+	caCert, caKey := certs.CAPaths(certPath)
+	paths := certs.Paths{CACert: caCert, CAKey: caKey, Cert: certPath, Key: keyPath}
+	if _, err := certs.Init(paths, certs.Options{}, certs.Options{}, true); err != nil {
+		return fmt.Errorf("error creating tls certs: %w", err)
+	}
+	l.Warnf("created server certificate %s for %v signed by local CA %s", certPath, certs.DefaultHosts, caCert)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/migrator"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// init - команды управления миграциями схемы
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [sub]",
+	Short: "Manage database schema migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(ctx context.Context, l *zap.SugaredLogger, m *migrator.Migrator) error {
+			n, err := m.Up(ctx)
+			if err != nil {
+				return err
+			}
+			l.Infof("applied %d migration(s), schema version %d", n, m.Latest())
+			return nil
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert the last applied migration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(ctx context.Context, l *zap.SugaredLogger, m *migrator.Migrator) error {
+			version, err := m.Down(ctx)
+			if err != nil {
+				if errors.Is(err, migrator.ErrNoChange) {
+					l.Info("no migrations to revert")
+					return nil
+				}
+				return err
+			}
+			l.Infof("reverted, schema version %d", version)
+			return nil
+		})
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show schema version and pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(ctx context.Context, l *zap.SugaredLogger, m *migrator.Migrator) error {
+			s, err := m.Status(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("version: %d (dirty: %t), latest known: %d, pending: %d\n", s.Version, s.Dirty, s.Latest, s.Pending())
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, mg := range s.Migrations {
+				state := "applied"
+				if mg.Version > s.Version {
+					state = "pending"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", mg.Version, mg.Name, state)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// withMigrator - открытие хранилища из конфигурации и вызов fn с его мигратором
+func withMigrator(fn func(ctx context.Context, l *zap.SugaredLogger, m *migrator.Migrator) error) error {
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelCtx()
+
+	l, err := logger.NewLogger()
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	c, err := loadConfig(l)
+	if err != nil {
+		return err
+	}
+	s, err := store.Open(ctx, c)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+	defer s.Close()
+	ms, ok := s.(store.Migratable)
+	if !ok {
+		return fmt.Errorf("store %q has no schema to migrate", c.DatabaseDSN)
+	}
+	m, err := ms.Migrator()
+	if err != nil {
+		return err
+	}
+	return fn(ctx, l.Named("migrate"), m)
+}
+
+// prepareSchema - применение миграций при старте (если включено) и проверка версии схемы.
+// Сервер не запускается, если схема отстает от бинарника или новее его.
+func prepareSchema(ctx context.Context, l *zap.SugaredLogger, s store.Store, autoMigrate bool) error {
+	ms, ok := s.(store.Migratable)
+	if !ok {
+		return nil
+	}
+	m, err := ms.Migrator()
+	if err != nil {
+		return err
+	}
+	if autoMigrate {
+		n, err := m.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		l.Infof("applied %d migration(s), schema version %d", n, m.Latest())
+	}
+	if err := m.Check(ctx); err != nil {
+		if errors.Is(err, migrator.ErrPendingMigrations) {
+			return fmt.Errorf("%w: run `gophkeeper migrate up` or start with --migrate", err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/app"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"go.uber.org/zap"
+)
+
+// reloadableKeys - ключи конфигурации, которые применяются по SIGHUP без перезапуска.
+// Изменения остальных ключей только выводятся в лог.
+var reloadableKeys = map[string]bool{
+	"log_level":             true,
+	"tls_cert_path":         true,
+	"tls_key_path":          true,
+	"quota_max_records":     true,
+	"quota_max_bytes":       true,
+	"quota_max_record_size": true,
+	"webhook_max_attempts":  true,
+	"webhook_allow_private": true,
+}
+
+// reloader - перечитывание конфигурации работающего сервера
+type reloader struct {
+	mu      sync.Mutex
+	current config.ServerConfig
+	level   zap.AtomicLevel
+	// certs - nil, если сервер работает без TLS
+	certs *app.CertReloader
+	// app - получает квоты и настройки вебхуков
+	app    *app.App
+	logger *zap.SugaredLogger
+}
+
+// watch - перечитывание конфигурации по SIGHUP до отмены ctx
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.reload(); err != nil {
+				r.logger.Errorf("config reload rejected, keeping current config: %v", err)
+			}
+		}
+	}
+}
+
+// reload - загрузка и проверка новой конфигурации и применение изменяемых без перезапуска ключей.
+// Если новая конфигурация или сертификат не загружаются, ничего не меняется.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next, err := loadConfig(r.logger)
+	if err != nil {
+		return err
+	}
+	level, err := zap.ParseAtomicLevel(next.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	if r.certs != nil {
+		// сертификат перечитывается и без смены путей: так подхватывается замененный на месте файл
+		if err := r.certs.Reload(next.TLSCertPath, next.TLSKeyPath); err != nil {
+			return err
+		}
+	}
+	changes := config.Diff(r.current, *next)
+	r.level.SetLevel(level.Level())
+	r.current.LogLevel = next.LogLevel
+	r.current.TLSCertPath = next.TLSCertPath
+	r.current.TLSKeyPath = next.TLSKeyPath
+	r.app.Reload(next)
+	r.current.QuotaMaxRecords = next.QuotaMaxRecords
+	r.current.QuotaMaxBytes = next.QuotaMaxBytes
+	r.current.QuotaMaxRecordSize = next.QuotaMaxRecordSize
+	r.current.WebhookMaxAttempts = next.WebhookMaxAttempts
+	r.current.WebhookAllowPrivate = next.WebhookAllowPrivate
+	for _, c := range changes {
+		if reloadableKeys[c.Key] {
+			r.logger.Infof("config reloaded: %s", c)
+			continue
+		}
+		r.logger.Warnf("config change requires restart, ignored: %s", c)
+	}
+	r.logger.Infof("config reloaded, %d change(s)", len(changes))
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReloadDotenv(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+		_ = os.Unsetenv("LOG_LEVEL")
+		_ = os.Unsetenv("QUOTA_MAX_RECORDS")
+	})
+	devMode = true
+	t.Cleanup(func() { devMode = false })
+	t.Setenv("QUOTA_MAX_BYTES", "1000")
+
+	require.NoError(t, os.WriteFile(".env", []byte("LOG_LEVEL=warn\nQUOTA_MAX_BYTES=5\n"), 0600))
+	l := zap.NewNop().Sugar()
+	c, err := loadConfig(l)
+	require.NoError(t, err)
+	level, err := zap.ParseAtomicLevel(c.LogLevel)
+	require.NoError(t, err)
+	r := &reloader{current: *c, level: level, logger: l, app: app.NewApp(c, store.NewMemoryStore(), l, nil, nil)}
+	assert.Equal(t, zap.WarnLevel, r.level.Level())
+
+	require.NoError(t, os.WriteFile(".env", []byte("LOG_LEVEL=error\nQUOTA_MAX_BYTES=5\nQUOTA_MAX_RECORDS=7\n"), 0600))
+	require.NoError(t, r.reload())
+	assert.Equal(t, zap.ErrorLevel, r.level.Level(), ".env changes are applied")
+	assert.Equal(t, int64(7), r.current.QuotaMaxRecords)
+	assert.Equal(t, int64(1000), r.current.QuotaMaxBytes, "environment overrides .env")
+
+	require.NoError(t, os.WriteFile(".env", []byte("QUOTA_MAX_BYTES=5\n"), 0600))
+	require.NoError(t, r.reload())
+	assert.Equal(t, zap.DebugLevel, r.level.Level(), "removed keys fall back to defaults")
+}
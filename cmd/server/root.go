@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+var (
+	// devMode - хранилище в памяти вместо базы данных
+	devMode bool
+	// migrateOnStart - применение миграций схемы перед запуском сервера
+	migrateOnStart bool
+	// configFlags - флаги конфигурации, общие для всех команд
+	configFlags *pflag.FlagSet
+
+	rootCmd = &cobra.Command{
+		Use:           "gophkeeper",
+		Short:         "GophKeeper server",
+		Long:          "GophKeeper server stores users' private data. Without subcommand starts the HTTP(S) server.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run()
+		},
+	}
+)
+
+// init - флаги запуска сервера и флаги конфигурации, общие для всех команд
+func init() {
+	configFlags = rootCmd.PersistentFlags()
+	config.BindFlags(configFlags)
+	rootCmd.Flags().BoolVar(&devMode, "dev", false, "use in-memory store instead of PostgreSQL")
+	rootCmd.Flags().BoolVar(&migrateOnStart, "migrate", false, "apply database migrations before start (also AUTO_MIGRATE=true)")
+}
+
+// loadConfig - загрузка и проверка конфигурации с учетом флагов командной строки
+func loadConfig(l *zap.SugaredLogger) (*config.ServerConfig, error) {
+	c, err := config.Load(l, configFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if devMode {
+		c.DatabaseDSN = "memory://"
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, nil
+}
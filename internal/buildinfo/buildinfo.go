@@ -0,0 +1,52 @@
+// Модуль информации о сборке
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Значения задаются при сборке:
+// go build -ldflags "-X github.com/EvgeniyBudaev/gophkeeper/internal/buildinfo.Version=v1.0.0 ..."
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info - информация о сборке
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get - информация о сборке. Если коммит и дата не заданы через ldflags,
+// они берутся из данных VCS, которые go build встраивает в бинарник.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String - краткое описание сборки
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}
@@ -0,0 +1,62 @@
+// Модуль журнала аудита
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// auditBefore - ID события, с которого начинается страница журнала
+	auditBefore uint64
+	// auditLimit - размер страницы журнала
+	auditLimit int
+)
+
+// init представляет команду инициализации
+func init() {
+	auditCmd.Flags().Uint64Var(&auditBefore, "before", 0, "show events older than this ID (next page)")
+	auditCmd.Flags().IntVar(&auditLimit, "limit", 0, "number of events, server default if 0")
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of the account: logins and record access",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		page, err := logic.GetAuditEvents(context.Background(), auditBefore, auditLimit)
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tACTION\tRECORD\tIP\tUSER AGENT\tDETAILS")
+		for _, e := range page.Events {
+			record := ""
+			if e.RecordID != 0 {
+				record = fmt.Sprint(e.RecordID)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.CreatedAt.Local().Format(time.DateTime), e.Action,
+				record, e.IP, e.UserAgent, e.Details)
+		}
+		if err := w.Flush(); err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		if page.NextBefore != 0 {
+			fmt.Printf("more events: gclient audit --before %d\n", page.NextBefore)
+		}
+	},
+}
@@ -47,6 +47,17 @@ func Login(ctx context.Context, logger *zap.SugaredLogger) {
 			fmt.Scanln(&password)
 			httpclient := httpClient.GetHTTPClient()
 			creds, err := logic.Login(ctx, httpclient, login, password)
+			if errors.Is(err, logic.ErrPasswordChangeRequired) {
+				// пароль выдан администратором и годится только для смены на свой
+				logger.Infoln("Password was reset by the administrator, new password:")
+				var newPassword string
+				fmt.Scanln(&newPassword)
+				if err = logic.ChangePassword(ctx, httpclient, login, password, newPassword); err != nil {
+					logger.Errorf("password change failed: %v", err)
+					return
+				}
+				creds, err = logic.Login(ctx, httpclient, login, newPassword)
+			}
 			if err != nil {
 				var target *net.OpError
 				if errors.As(err, &target) {
@@ -66,6 +77,10 @@ func Login(ctx context.Context, logger *zap.SugaredLogger) {
 			if err := utils.CreateUsersDir(login); err != nil {
 				logger.Errorf("err: %w", err)
 			}
+			err = logic.EnrollDevice(ctx, httpclient, login, creds.Token)
+			if err != nil && !errors.Is(err, logic.ErrDevicesDisabled) {
+				logger.Errorf("device enrollment failed, records may be unavailable: %v", err)
+			}
 			return
 		}
 		viper.Set("token", "")
@@ -0,0 +1,94 @@
+// Модуль очереди отложенных операций
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+// pendingKeyLength - длина ключа операции в списке, ее достаточно для discard
+const pendingKeyLength = 12
+
+// discardAll - удалить из очереди все операции
+var discardAll bool
+
+// init представляет команду инициализации
+func init() {
+	discardPendingCmd.Flags().BoolVar(&discardAll, "all", false, "discard all pending operations")
+	pendingCmd.AddCommand(discardPendingCmd)
+	rootCmd.AddCommand(pendingCmd)
+}
+
+var pendingCmd = &cobra.Command{
+	Use:   "pending",
+	Short: "List record operations queued while the server was unreachable",
+	Long: "Operations made while the server was unreachable are queued and sent with their idempotency key\n" +
+		"after the next command that reaches the server or by records sync. Operations rejected by the server\n" +
+		"stay in the queue with the reason until they are discarded, including updates and deletes of records\n" +
+		"changed on the server by another device since the local copy was loaded.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		ops, err := logic.ListPending()
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		if len(ops) == 0 {
+			fmt.Println("no pending operations")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tOP\tNAME\tSERVER\tQUEUED\tATTEMPTS\tLAST ERROR")
+		for _, op := range ops {
+			key := op.Key
+			if len(key) > pendingKeyLength {
+				key = key[:pendingKeyLength]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", key, op.Op, op.Name, op.API,
+				op.CreatedAt.Local().Format(time.DateTime), op.Attempts, op.LastError)
+		}
+		if err := w.Flush(); err != nil {
+			logger.Errorf("error: %v", err)
+		}
+	},
+}
+
+var discardPendingCmd = &cobra.Command{
+	Use:   "discard [key...]",
+	Short: "Discard queued operations by key prefix, or all with --all",
+	Long:  "Discarded operations are never sent. Local copies of the records are left as they are.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(args) == 0 && !discardAll {
+			logger.Errorf("error: specify keys of operations to discard or --all")
+			return
+		}
+		if len(args) > 0 && discardAll {
+			logger.Errorf("error: keys and --all are mutually exclusive")
+			return
+		}
+		discarded, err := logic.DiscardPending(args)
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		for _, op := range discarded {
+			fmt.Printf("discarded %s of record %q\n", op.Op, op.Name)
+		}
+		fmt.Printf("%d operations discarded\n", len(discarded))
+	},
+}
@@ -4,10 +4,16 @@ package cli
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
 	"log"
+	"os"
+	"os/signal"
 	"syscall"
 )
 
@@ -15,9 +21,16 @@ import (
 func init() {
 	putRecordCmd.AddCommand()
 	recordCmd.AddCommand(putRecordCmd)
+	recordCmd.AddCommand(updateRecordCmd)
+	recordCmd.AddCommand(deleteRecordCmd)
 	recordCmd.AddCommand(getRecordCmd)
 	recordCmd.AddCommand(listRecordsCmd)
+	syncRecordsCmd.Flags().BoolVar(&syncFull, "full", false, "compare all records, not only changes since the last sync")
+	syncRecordsCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "print the sync plan without changing anything")
+	syncRecordsCmd.Flags().StringVar(&syncConflict, "conflict", "",
+		"conflict policy: server, client or keep-both (default sync_conflict from config or keep-both)")
 	recordCmd.AddCommand(syncRecordsCmd)
+	recordCmd.AddCommand(watchRecordsCmd)
 	rootCmd.AddCommand(recordCmd)
 }
 
@@ -37,23 +50,72 @@ var putRecordCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		record, err := logic.PutRecord(context.Background(), args)
+		saveRecord(logger, record, err, func(r *models.DataRecord) error {
+			return logic.SaveOrUpdateData(logger, r)
+		})
+	},
+}
+
+var updateRecordCmd = &cobra.Command{
+	Use:   "update [record_type] [path|data] [name]",
+	Short: "Replace data record",
+	Long:  "Replaces the content of an existing record, arguments are the same as for put.",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
 		if err != nil {
-			if errors.Is(err, syscall.ECONNREFUSED) {
-				if err := logic.SaveOrUpdateData(logger, record); err != nil {
-					logger.Errorf("error saving locally %s: [%w]\n", record.Name, err)
-				}
-				logger.Infof("saved local data: %s\n", record.Name)
-				return
-			}
+			log.Fatal(err)
+		}
+		record, err := logic.UpdateRecord(context.Background(), args)
+		saveRecord(logger, record, err, logic.ReplaceLocalData)
+	},
+}
+
+var deleteRecordCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete data record",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = logic.DeleteRecord(context.Background(), args[0])
+		if err != nil && !errors.Is(err, logic.ErrQueued) {
 			logger.Errorf("error: %v", err)
+			return
 		}
-		if err := logic.SaveOrUpdateData(logger, record); err != nil {
-			logger.Errorf("error saving locally: %s\n", record.Name)
+		if err := logic.RemoveLocalData(args[0]); err != nil {
+			logger.Errorf("error removing local copy %s: %v", args[0], err)
 		}
-		logger.Infof("%+v\n", record)
+		if err != nil {
+			logger.Warnf("%v, see gclient pending\n", err)
+			return
+		}
+		logger.Infof("deleted: %s\n", args[0])
 	},
 }
 
+// saveRecord - сохранение локальной копии записи функцией save после put или update.
+// Если сервер недоступен, операция уже в очереди, а локальная копия сохраняется сразу.
+func saveRecord(logger *zap.SugaredLogger, record *models.DataRecord, err error, save func(*models.DataRecord) error) {
+	if err != nil && !errors.Is(err, logic.ErrQueued) {
+		logger.Errorf("error: %v", err)
+		return
+	}
+	if err != nil {
+		if err := save(record); err != nil {
+			logger.Errorf("error saving locally %s: [%v]\n", record.Name, err)
+		}
+		logger.Warnf("%v, saved local data: %s, see gclient pending\n", err, record.Name)
+		return
+	}
+	if err := save(record); err != nil {
+		logger.Errorf("error saving locally: %s\n", record.Name)
+	}
+	logger.Infof("%+v\n", record)
+}
+
 var getRecordCmd = &cobra.Command{
 	Use:   "get [name]",
 	Short: "Get data record",
@@ -89,17 +151,69 @@ var listRecordsCmd = &cobra.Command{
 	},
 }
 
+var (
+	// syncFull - сравнить все записи без учета прошлых синхронизаций
+	syncFull bool
+	// syncDryRun - только показать план синхронизации
+	syncDryRun bool
+	// syncConflict - политика разрешения конфликтов
+	syncConflict string
+)
+
 var syncRecordsCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync data records",
+	Long: "Pushes local changes to the server and pulls changes made on the server since the last sync.\n" +
+		"Records changed on both sides are resolved by --conflict: server, client or keep-both (default),\n" +
+		"which uploads the local copy as \"<name> (conflict)\". Use --full to compare all records again.",
 	Run: func(cmd *cobra.Command, args []string) {
 		logger, err := logger.NewLogger()
 		if err != nil {
 			log.Fatal(err)
 		}
-		if err := logic.SyncDataRecords(context.Background(), logger); err != nil {
+		if syncConflict == "" {
+			syncConflict = viper.GetString("sync_conflict")
+		}
+		policy, err := logic.ParseConflictPolicy(syncConflict)
+		if err != nil {
 			logger.Errorf("error: %v", err)
+			return
+		}
+		opts := logic.SyncOptions{Policy: policy, DryRun: syncDryRun, Full: syncFull}
+		plan, err := logic.SyncRecords(context.Background(), logger, opts)
+		if plan != nil {
+			if syncDryRun {
+				fmt.Println("dry run, nothing is changed:")
+			}
+			for _, step := range plan.Steps {
+				fmt.Println(step)
+			}
+			fmt.Printf("%d changes, %d conflicts\n", len(plan.Steps), plan.Conflicts())
+		}
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
 		}
 		logger.Infoln("sync successfull")
 	},
 }
+
+var watchRecordsCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Keep local records up to date with server changes",
+	Long:  "Syncs records and then listens for changes until interrupted, reconnecting if the connection drops.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = logic.WatchRecords(ctx, logger, func(e models.RecordEvent) {
+			logger.Infof("%s: record %d (%s), local records updated\n", e.Type, e.RecordID, e.RecordType)
+		})
+		if err != nil {
+			logger.Errorf("error: %v", err)
+		}
+	},
+}
@@ -2,7 +2,10 @@
 package cli
 
 import (
+	"context"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/tracing"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"log"
@@ -13,12 +16,38 @@ var (
 	// Used for flags.
 	cfgFile string
 	apiURL  string
-	rootCmd = &cobra.Command{
+	// shutdownTracing - сброс спанов команды перед выходом
+	shutdownTracing tracing.Shutdown
+	rootCmd         = &cobra.Command{
 		Use:   "gclient",
 		Short: "A generator for Cobra based Applications",
 		Long: `Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			shutdown, err := tracing.Setup(cmd.Context(), tracing.Options{
+				ServiceName: "gclient",
+				Exporter:    viper.GetString("trace_exporter"),
+				Endpoint:    viper.GetString("trace_endpoint"),
+				Insecure:    viper.GetBool("trace_insecure"),
+				File:        viper.GetString("trace_file"),
+			})
+			if err != nil {
+				return err
+			}
+			shutdownTracing = shutdown
+			return nil
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			// команда получила ответ сервера: связь есть, можно отправить отложенные операции
+			if l, err := logger.NewLogger(); err == nil {
+				logic.AutoReplayPending(cmd.Context(), l)
+			}
+			if shutdownTracing == nil {
+				return nil
+			}
+			return shutdownTracing(context.Background())
+		},
 	}
 )
 
@@ -38,6 +67,19 @@ func init() {
 	viper.BindPFlag("login", rootCmd.PersistentFlags().Lookup("login"))
 	viper.BindPFlag("token", rootCmd.PersistentFlags().Lookup("token"))
 	viper.BindPFlag("expires_at", rootCmd.PersistentFlags().Lookup("expires_at"))
+	rootCmd.PersistentFlags().String("ca-cert", "", "CA certificate (PEM) to verify the server, e.g. the server's ca.pem")
+	rootCmd.PersistentFlags().Bool("tofu", false,
+		"trust on first use: remember the server key fingerprint and refuse to connect if it changes")
+	viper.BindPFlag("ca_cert", rootCmd.PersistentFlags().Lookup("ca-cert"))
+	viper.BindPFlag("tls_tofu", rootCmd.PersistentFlags().Lookup("tofu"))
+	rootCmd.PersistentFlags().String("trace-exporter", "none", "trace exporter: none, otlp, stdout or file")
+	rootCmd.PersistentFlags().String("trace-endpoint", "", "OTLP/HTTP collector host:port (default localhost:4318)")
+	rootCmd.PersistentFlags().Bool("trace-insecure", false, "send traces to the collector without TLS")
+	rootCmd.PersistentFlags().String("trace-file", "", "file for the file trace exporter")
+	viper.BindPFlag("trace_exporter", rootCmd.PersistentFlags().Lookup("trace-exporter"))
+	viper.BindPFlag("trace_endpoint", rootCmd.PersistentFlags().Lookup("trace-endpoint"))
+	viper.BindPFlag("trace_insecure", rootCmd.PersistentFlags().Lookup("trace-insecure"))
+	viper.BindPFlag("trace_file", rootCmd.PersistentFlags().Lookup("trace-file"))
 }
 
 // initConfig- инициализация конфига
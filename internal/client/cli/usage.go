@@ -0,0 +1,46 @@
+// Модуль использования хранилища
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/spf13/cobra"
+)
+
+// init представляет команду инициализации
+func init() {
+	rootCmd.AddCommand(usageCmd)
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show storage usage against quotas",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		usage, err := logic.GetUsage(context.Background())
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		fmt.Printf("records: %s\n", formatUsage(usage.Records, usage.Limits.MaxRecords))
+		fmt.Printf("data:    %s bytes\n", formatUsage(usage.Bytes, usage.Limits.MaxBytes))
+		if usage.Limits.MaxRecordSize > 0 {
+			fmt.Printf("max record size: %d bytes\n", usage.Limits.MaxRecordSize)
+		}
+	},
+}
+
+// formatUsage - использование относительно квоты, 0 - без ограничения
+func formatUsage(used, limit int64) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d (unlimited)", used)
+	}
+	return fmt.Sprintf("%d of %d (%d%%)", used, limit, used*100/limit)
+}
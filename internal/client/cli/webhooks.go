@@ -0,0 +1,150 @@
+// Модуль вебхуков
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// webhookEvents - события подписки для webhooks add
+	webhookEvents []string
+	// webhookSecret - секрет подписи для webhooks add, пустой - создается сервером
+	webhookSecret string
+)
+
+// init представляет команду инициализации
+func init() {
+	addWebhookCmd.Flags().StringSliceVar(&webhookEvents, "events", nil,
+		"events to subscribe to, all if empty: "+strings.Join(models.WebhookEvents, ", "))
+	addWebhookCmd.Flags().StringVar(&webhookSecret, "secret", "", "HMAC signing secret, generated by the server if empty")
+	webhooksCmd.AddCommand(addWebhookCmd)
+	webhooksCmd.AddCommand(listWebhooksCmd)
+	webhooksCmd.AddCommand(removeWebhookCmd)
+	webhooksCmd.AddCommand(testWebhookCmd)
+	rootCmd.AddCommand(webhooksCmd)
+}
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks [sub]",
+	Short: "Manage webhooks notified on record and account events",
+}
+
+var addWebhookCmd = &cobra.Command{
+	Use:   "add <url>",
+	Short: "Register a webhook",
+	Long: "Registers a webhook and prints its signing secret. The secret is shown only once: " +
+		"the receiver checks X-Gophkeeper-Signature with it.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		w, err := logic.AddWebhook(context.Background(), models.WebhookRequest{
+			URL:    args[0],
+			Events: webhookEvents,
+			Secret: webhookSecret,
+		})
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		fmt.Printf("webhook %d added for %s\n", w.ID, formatWebhookEvents(w.Events))
+		fmt.Printf("signing secret: %s\n", w.Secret)
+	},
+}
+
+var listWebhooksCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhooks",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		list, err := logic.ListWebhooks(context.Background())
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tURL\tEVENTS\tCREATED")
+		for _, h := range list {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", h.ID, h.URL, formatWebhookEvents(h.Events),
+				h.CreatedAt.Local().Format(time.DateTime))
+		}
+		if err := w.Flush(); err != nil {
+			logger.Errorf("error: %v", err)
+		}
+	},
+}
+
+var removeWebhookCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a webhook with its pending deliveries",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			logger.Errorf("invalid webhook id %q", args[0])
+			return
+		}
+		if err := logic.RemoveWebhook(context.Background(), id); err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		fmt.Printf("webhook %d removed\n", id)
+	},
+}
+
+var testWebhookCmd = &cobra.Command{
+	Use:   "test <id>",
+	Short: "Send a signed webhook.test event right away and show the receiver response",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logger.NewLogger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			logger.Errorf("invalid webhook id %q", args[0])
+			return
+		}
+		result, err := logic.TestWebhook(context.Background(), id)
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			return
+		}
+		if result.Error != "" {
+			fmt.Printf("delivery failed: %s\n", result.Error)
+			return
+		}
+		fmt.Printf("delivered, receiver responded %d\n", result.Status)
+	},
+}
+
+// formatWebhookEvents - события подписки для вывода
+func formatWebhookEvents(events []string) string {
+	if len(events) == 0 {
+		return "all events"
+	}
+	return strings.Join(events, ",")
+}
@@ -2,18 +2,29 @@
 package httpClient
 
 import (
-	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/utils"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/randid"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 )
 
 // httpClientInstance - синглетон клиента
 type HttpClientInstance struct {
 	*http.Client
 	APIURL string
+	// RequestID - ID запросов текущей команды, по нему ошибку можно найти в логах сервера
+	RequestID string
+	// reached - сервер ответил на запрос команды без ошибки сервера
+	reached atomic.Bool
 }
 
 var (
@@ -35,13 +46,122 @@ func GetHTTPClient() *HttpClientInstance {
 				httpClient = nil
 				return
 			}
+			// сертификат устройства из профиля пользователя, если устройство зарегистрировано (mTLS)
+			clientCert, clientKey := "", ""
+			if login := viper.GetString("login"); login != "" {
+				clientCert, clientKey, _ = utils.DeviceCertPaths(login)
+			}
+			tlsConfig, err := NewTLSConfig(TLSOptions{
+				ClientCert: clientCert,
+				ClientKey:  clientKey,
+				CACert:     viper.GetString("ca_cert"),
+				TOFU:       viper.GetBool("tls_tofu"),
+				Pin:        lookupPin(apiURL),
+				SavePin: func(fingerprint string) error {
+					l.Warnf("trusting %s on first use, server key fingerprint %s", apiURL, fingerprint)
+					return savePin(apiURL, fingerprint)
+				},
+			})
+			if err != nil {
+				l.Errorln(err)
+				httpClient = nil
+				return
+			}
+			id, err := randid.New()
+			if err != nil {
+				l.Errorln(err)
+				httpClient = nil
+				return
+			}
 			httpClient = &HttpClientInstance{
 				Client: &http.Client{
-					Transport: &http.Transport{
-						TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-					}},
-				APIURL: apiURL,
+					Transport: otelhttp.NewTransport(&requestIDTransport{
+						id:   id,
+						next: &http.Transport{TLSClientConfig: tlsConfig},
+					})},
+				APIURL:    apiURL,
+				RequestID: id,
 			}
 		})
 	return httpClient
 }
+
+// tlsPin - отпечаток ключа сервера, сохраненный в режиме TOFU для адреса API
+type tlsPin struct {
+	API         string `json:"api" mapstructure:"api"`
+	Fingerprint string `json:"fingerprint" mapstructure:"fingerprint"`
+}
+
+// lookupPin - сохраненный отпечаток ключа сервера для адреса API
+func lookupPin(apiURL string) string {
+	var pins []tlsPin
+	if err := viper.UnmarshalKey("tls_pins", &pins); err != nil {
+		return ""
+	}
+	for _, p := range pins {
+		if p.API == apiURL {
+			return p.Fingerprint
+		}
+	}
+	return ""
+}
+
+// savePin - сохранение отпечатка ключа сервера в конфиг клиента
+func savePin(apiURL, fingerprint string) error {
+	var pins []tlsPin
+	if err := viper.UnmarshalKey("tls_pins", &pins); err != nil {
+		return err
+	}
+	viper.Set("tls_pins", append(pins, tlsPin{API: apiURL, Fingerprint: fingerprint}))
+	return viper.WriteConfigAs("./gophkeeper.json")
+}
+
+// Do - выполнение запроса; к сетевой ошибке добавляется ID запроса
+func (h *HttpClientInstance) Do(req *http.Request) (*http.Response, error) {
+	response, err := h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w (request id %s)", err, h.RequestID)
+	}
+	if response.StatusCode < http.StatusInternalServerError {
+		h.reached.Store(true)
+	}
+	return response, nil
+}
+
+// Reached - команда уже получила ответ сервера, то есть сервер доступен
+func Reached() bool {
+	return httpClient != nil && httpClient.reached.Load()
+}
+
+// ResponseError - ошибка с кодом ответа, причиной и ID запроса из тела ответа сервера
+func (h *HttpClientInstance) ResponseError(msg string, response *http.Response) error {
+	id := response.Header.Get(models.RequestIDHeader)
+	var body models.ErrorResponse
+	if b, err := io.ReadAll(io.LimitReader(response.Body, 4096)); err == nil && json.Unmarshal(b, &body) == nil {
+		if body.RequestID != "" {
+			id = body.RequestID
+		}
+		if body.Error != "" {
+			msg = fmt.Sprintf("%s: %s", msg, body.Error)
+		}
+	}
+	if id == "" {
+		id = h.RequestID
+	}
+	return fmt.Errorf("%s: %s (request id %s)", msg, response.Status, id)
+}
+
+// requestIDTransport - добавляет X-Request-ID команды к каждому запросу
+type requestIDTransport struct {
+	id   string
+	next http.RoundTripper
+}
+
+// RoundTrip - реализация http.RoundTripper
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(models.RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(models.RequestIDHeader, t.id)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,98 @@
+// Модуль проверки TLS сертификата сервера
+package httpClient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fingerprintPrefix - префикс отпечатка открытого ключа сервера
+const fingerprintPrefix = "sha256:"
+
+// ErrPinMismatch - открытый ключ сервера не совпадает с сохраненным при первом подключении
+var ErrPinMismatch = errors.New("server public key has changed since the first connection")
+
+// TLSOptions - настройки проверки сертификата сервера
+type TLSOptions struct {
+	// CACert - PEM файл CA, которому доверяет клиент (например, ca.pem сервера); пусто - системные CA
+	CACert string
+	// TOFU - доверие при первом подключении: отпечаток ключа сервера сохраняется и проверяется при следующих.
+	// Без CACert цепочка сертификатов не проверяется, доверие держится только на отпечатке.
+	TOFU bool
+	// Pin - сохраненный отпечаток ключа сервера, пусто - первое подключение
+	Pin string
+	// SavePin - сохранение отпечатка при первом подключении в режиме TOFU
+	SavePin func(fingerprint string) error
+	// ClientCert, ClientKey - сертификат и ключ устройства для mTLS; если файлов нет, сертификат не предъявляется
+	ClientCert string
+	ClientKey  string
+}
+
+// Fingerprint - отпечаток открытого ключа сертификата (SHA-256 от SubjectPublicKeyInfo).
+// Не меняется при перевыпуске сертификата с тем же ключом.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return fingerprintPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewTLSConfig - конфигурация TLS клиента. По умолчанию сертификат сервера проверяется системными CA.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACert != "" {
+		data, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.ClientCert != "" {
+		if _, err := os.Stat(opts.ClientCert); err == nil {
+			cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("error loading device certificate: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+	}
+	if !opts.TOFU {
+		return cfg, nil
+	}
+	// цепочку проверяет VerifyConnection: без CA только отпечаток, с CA - и цепочка, и отпечаток
+	cfg.InsecureSkipVerify = opts.CACert == ""
+	var mu sync.Mutex
+	pin := opts.Pin
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		fingerprint := Fingerprint(cs.PeerCertificates[0])
+		mu.Lock()
+		defer mu.Unlock()
+		if pin == "" {
+			if opts.SavePin != nil {
+				if err := opts.SavePin(fingerprint); err != nil {
+					return fmt.Errorf("error saving server key fingerprint: %w", err)
+				}
+			}
+			pin = fingerprint
+			return nil
+		}
+		if fingerprint != pin {
+			return fmt.Errorf("%w: expected %s, got %s. Possible man-in-the-middle attack; if the server key "+
+				"was changed on purpose, remove its entry from tls_pins in the client config", ErrPinMismatch, pin,
+				fingerprint)
+		}
+		return nil
+	}
+	return cfg, nil
+}
@@ -0,0 +1,67 @@
+package httpClient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// get - запрос к серверу с заданной конфигурацией TLS
+func get(t *testing.T, srv *httptest.Server, opts TLSOptions) error {
+	t.Helper()
+	cfg, err := NewTLSConfig(opts)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// writeCA - сертификат тестового сервера в PEM файл
+func writeCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestVerifyByDefault(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	assert.ErrorContains(t, get(t, srv, TLSOptions{}), "certificate")
+	assert.NoError(t, get(t, srv, TLSOptions{CACert: writeCA(t, srv)}))
+
+	_, err := NewTLSConfig(TLSOptions{CACert: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestTOFU(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	var saved string
+	opts := TLSOptions{TOFU: true, SavePin: func(fingerprint string) error {
+		saved = fingerprint
+		return nil
+	}}
+	require.NoError(t, get(t, srv, opts))
+	assert.Equal(t, Fingerprint(srv.Certificate()), saved)
+
+	opts.Pin = saved
+	assert.NoError(t, get(t, srv, opts))
+
+	opts.Pin = "sha256:AAAA"
+	err := get(t, srv, opts)
+	assert.ErrorIs(t, err, ErrPinMismatch)
+	assert.ErrorContains(t, err, "man-in-the-middle")
+}
@@ -0,0 +1,57 @@
+// Модуль журнала аудита
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+)
+
+// GetAuditEvents - страница журнала аудита пользователя от новых событий к старым.
+// before - ID события, с которого начинается страница (0 - с последнего), limit - размер страницы (0 - по умолчанию).
+func GetAuditEvents(ctx context.Context, before uint64, limit int) (*models.AuditPage, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return nil, fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return nil, fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/audit")
+	query := url.Values{}
+	if before > 0 {
+		query.Set("before", strconv.FormatUint(before, 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, httpclient.ResponseError("error getting audit log", response)
+	}
+	var page models.AuditPage
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decode body: %w", err)
+	}
+	return &page, nil
+}
@@ -0,0 +1,171 @@
+// Модуль изменений записей на сервере и состояния синхронизации
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/repository"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/utils"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// errStaleCursor - сервер не знает сохраненного курсора (база восстановлена из резервной копии),
+// синхронизацию нужно начать сначала
+var errStaleCursor = errors.New("sync cursor is ahead of server")
+
+// GetRecordChanges - страница изменений записей после курсора since
+func GetRecordChanges(ctx context.Context, since uint64) (*models.RecordChanges, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return nil, fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return nil, fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/records/changes")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.URL.RawQuery = url.Values{"since": {strconv.FormatUint(since, 10)}}.Encode()
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("%w: %w", errStaleCursor, httpclient.ResponseError("cannot get changes", response))
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, httpclient.ResponseError("cannot get changes", response)
+	}
+	var changes models.RecordChanges
+	if err := json.NewDecoder(response.Body).Decode(&changes); err != nil {
+		return nil, fmt.Errorf("error decode body: %w", err)
+	}
+	return &changes, nil
+}
+
+// fetchChanges - все изменения записей на сервере после курсора since и курсор для следующей синхронизации.
+// Если сервер не знает курсора, изменения запрашиваются с начала; restarted - так и произошло.
+func fetchChanges(ctx context.Context, logger *zap.SugaredLogger, since uint64) (changes []models.RecordChange,
+	cursor uint64, restarted bool, err error) {
+	cursor = since
+	for {
+		page, err := GetRecordChanges(ctx, cursor)
+		if errors.Is(err, errStaleCursor) && !restarted {
+			logger.Warnf("server does not know sync cursor %d, syncing all records", cursor)
+			changes, cursor, restarted = nil, 0, true
+			continue
+		}
+		if err != nil {
+			return nil, since, restarted, err
+		}
+		changes = append(changes, page.Changes...)
+		cursor = page.Cursor
+		if !page.More {
+			return changes, cursor, restarted, nil
+		}
+	}
+}
+
+// recordRepository - локальное хранилище записей типа dataType
+func recordRepository(login string, dataType models.DataType) (repository.DataRecordRepository, error) {
+	switch dataType {
+	case models.PASS:
+		return repository.NewPassRepository(login), nil
+	default:
+		return nil, fmt.Errorf("unsupported data type")
+	}
+}
+
+// recordBase - состояние записи после последней синхронизации, с ним сравниваются локальная и удаленная копии
+type recordBase struct {
+	ID uint64 `json:"id"`
+	// Version - версия записи на сервере
+	Version uint64 `json:"version"`
+	// Hash - хэш содержимого локальной копии (recordHash)
+	Hash string `json:"hash"`
+}
+
+// syncState - состояние синхронизации с одним сервером
+type syncState struct {
+	// Cursor - последний примененный курсор изменений записей
+	Cursor  uint64                `json:"cursor"`
+	Records map[string]recordBase `json:"records"`
+}
+
+// loadSyncState - состояние синхронизации пользователя login с сервером api из профиля пользователя
+func loadSyncState(api, login string) (*syncState, error) {
+	states, err := readSyncStates(login)
+	if err != nil {
+		return nil, err
+	}
+	st := states[api]
+	if st == nil {
+		st = &syncState{}
+	}
+	if st.Records == nil {
+		st.Records = make(map[string]recordBase)
+	}
+	return st, nil
+}
+
+// saveSyncState - сохранение состояния синхронизации с сервером api в профиль пользователя login
+func saveSyncState(api, login string, st *syncState) error {
+	states, err := readSyncStates(login)
+	if err != nil {
+		return err
+	}
+	states[api] = st
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	statePath, err := utils.SyncStatePath(login)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(statePath), 0750); err != nil {
+		return err
+	}
+	// запись через временный файл, чтобы обрыв не оставил испорченное состояние
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath)
+}
+
+// readSyncStates - состояния синхронизации пользователя login по адресам серверов
+func readSyncStates(login string) (map[string]*syncState, error) {
+	states := make(map[string]*syncState)
+	statePath, err := utils.SyncStatePath(login)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, fmt.Errorf("error reading sync state %s: %w", statePath, err)
+	}
+	return states, nil
+}
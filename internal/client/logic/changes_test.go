@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var (
+	// apiServer - тестовый сервер пакета: HTTP-клиент - синглетон и запоминает адрес первого сервера
+	apiServer  *httptest.Server
+	apiOnce    sync.Once
+	apiMu      sync.Mutex
+	apiHandler http.Handler
+)
+
+// useTestAPI - обработка запросов клиента до конца теста обработчиком h
+func useTestAPI(t *testing.T, h http.Handler) {
+	apiOnce.Do(func() {
+		apiServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiMu.Lock()
+			h := apiHandler
+			apiMu.Unlock()
+			if h == nil || r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}))
+	})
+	apiMu.Lock()
+	apiHandler = h
+	apiMu.Unlock()
+	t.Cleanup(func() {
+		apiMu.Lock()
+		apiHandler = nil
+		apiMu.Unlock()
+	})
+	viper.Set("api", apiServer.URL)
+}
+
+// useTestProfile - вход пользователем user с профилем и папкой записей во временной директории
+func useTestProfile(t *testing.T) *zap.SugaredLogger {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	t.Setenv("HOME", dir)
+	viper.Set("login", "user")
+	viper.Set("token", "token")
+	replayed.Store(false)
+	l, err := logger.NewLogger()
+	require.NoError(t, err)
+	return l
+}
+
+// pagesServer - ответы на запрос изменений по значению since, отсутствующий since - 410
+type pagesServer map[string]models.RecordChanges
+
+func (s pagesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, ok := s[r.URL.Query().Get("since")]
+	if r.URL.Path != "/api/user/records/changes" || !ok {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// passChange - изменение записи типа PASS
+func passChange(op, name string, version uint64) models.RecordChange {
+	return models.RecordChange{Version: version, Op: op,
+		Record: models.DataRecord{ID: version, Type: models.PASS, Name: name, Data: "data", Version: version}}
+}
+
+func TestFetchChanges(t *testing.T) {
+	l := useTestProfile(t)
+	ctx := context.Background()
+	useTestAPI(t, pagesServer{
+		"0": {Changes: []models.RecordChange{passChange(models.ChangeCreated, "a", 1)}, Cursor: 1, More: true},
+		"1": {Changes: []models.RecordChange{passChange(models.ChangeDeleted, "b", 2)}, Cursor: 2},
+	})
+
+	changes, cursor, restarted, err := fetchChanges(ctx, l, 0)
+	require.NoError(t, err)
+	assert.Len(t, changes, 2, "all pages are fetched")
+	assert.Equal(t, uint64(2), cursor)
+	assert.False(t, restarted)
+
+	changes, cursor, restarted, err = fetchChanges(ctx, l, 7)
+	require.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, uint64(2), cursor)
+	assert.True(t, restarted, "stale cursor restarts from the beginning")
+
+	st := &syncState{Cursor: 2, Records: map[string]recordBase{"a": {ID: 1, Version: 1, Hash: "hash"}}}
+	require.NoError(t, saveSyncState(apiServer.URL, "user", st))
+	loaded, err := loadSyncState(apiServer.URL, "user")
+	require.NoError(t, err)
+	assert.Equal(t, st, loaded)
+	other, err := loadSyncState("https://other.example", "user")
+	require.NoError(t, err)
+	assert.Zero(t, other.Cursor, "state is kept per server")
+}
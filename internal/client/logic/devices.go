@@ -0,0 +1,96 @@
+// Модуль регистрации устройства (mTLS)
+package logic
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/utils"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// ErrDevicesDisabled - на сервере выключена аутентификация устройств
+var ErrDevicesDisabled = errors.New("device certificates are disabled on the server")
+
+// EnrollDevice - получение сертификата устройства после логина. Ключ создается локально и не покидает
+// устройство, на сервер отправляется только CSR. Если сертификат уже есть, ничего не делает.
+func EnrollDevice(ctx context.Context, httpclient *httpClient.HttpClientInstance, login, token string) error {
+	if httpclient == nil {
+		return fmt.Errorf("configuration error")
+	}
+	certPath, keyPath, err := utils.DeviceCertPaths(login)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(certPath); err == nil {
+		return nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating device key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: login},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("error creating CSR: %w", err)
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		name = "unknown"
+	}
+	b, _ := json.Marshal(models.EnrollRequest{
+		Name: name,
+		CSR:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/devices")
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return ErrDevicesDisabled
+	}
+	if response.StatusCode != http.StatusCreated {
+		return httpclient.ResponseError("error enrolling device", response)
+	}
+	var enrolled models.EnrollResponse
+	if err := json.NewDecoder(response.Body).Decode(&enrolled); err != nil {
+		return fmt.Errorf("error decode body: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(certPath), 0750); err != nil {
+		return fmt.Errorf("error creating user's dir: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("error saving device key: %w", err)
+	}
+	if err := os.WriteFile(certPath, []byte(enrolled.Certificate), 0600); err != nil {
+		return fmt.Errorf("error saving device certificate: %w", err)
+	}
+	return nil
+}
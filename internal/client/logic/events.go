@@ -0,0 +1,160 @@
+// Модуль отслеживания изменений записей на сервере (Server-Sent Events)
+package logic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// задержка переподключения к потоку событий; после успешного подключения - значение retry от сервера
+	watchMinRetry = time.Second
+	watchMaxRetry = time.Minute
+)
+
+// errWatchRejected - сервер отклонил подписку (токен недействителен, учетная запись заблокирована),
+// переподключаться бессмысленно
+var errWatchRejected = errors.New("event stream rejected")
+
+// sseEvent - событие потока Server-Sent Events
+type sseEvent struct {
+	Event string
+	Data  string
+	// Retry - задержка переподключения, присланная сервером; 0 - не менялась
+	Retry time.Duration
+}
+
+// WatchRecords - поддержание локальных записей в актуальном состоянии по событиям сервера до отмены ctx.
+// После каждого подключения записи синхронизируются, чтобы не пропустить изменения за время обрыва;
+// onEvent вызывается для каждого события после синхронизации.
+func WatchRecords(ctx context.Context, logger *zap.SugaredLogger, onEvent func(e models.RecordEvent)) error {
+	retry := watchMinRetry
+	delay := retry
+	for {
+		connected, err := watchRecordsOnce(ctx, logger, onEvent, &retry)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, errWatchRejected) {
+			return err
+		}
+		if connected {
+			delay = retry
+		}
+		logger.Warnf("event stream interrupted: %v, reconnecting in %s", err, delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, watchMaxRetry)
+	}
+}
+
+// watchRecordsOnce - одно подключение к потоку событий; connected - поток был открыт
+func watchRecordsOnce(ctx context.Context, logger *zap.SugaredLogger, onEvent func(e models.RecordEvent),
+	retry *time.Duration) (connected bool, err error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return false, fmt.Errorf("%w: no auth data, login first", errWatchRejected)
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return false, fmt.Errorf("%w: configuration error", errWatchRejected)
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/events")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Add("Accept", "text/event-stream")
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, fmt.Errorf("%w: %w", errWatchRejected, httpclient.ResponseError("cannot watch records", response))
+	default:
+		return false, httpclient.ResponseError("cannot watch records", response)
+	}
+	if err := SyncDataRecords(ctx, logger); err != nil {
+		return true, err
+	}
+	logger.Infoln("watching records")
+	err = readSSE(response.Body, func(e sseEvent) error {
+		if e.Retry > 0 {
+			*retry = e.Retry
+		}
+		if e.Data == "" {
+			return nil
+		}
+		var event models.RecordEvent
+		if err := json.Unmarshal([]byte(e.Data), &event); err != nil {
+			return fmt.Errorf("error decoding event %q: %w", e.Event, err)
+		}
+		if err := SyncDataRecords(ctx, logger); err != nil {
+			return err
+		}
+		onEvent(event)
+		return nil
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, errors.New("stream closed by server")
+}
+
+// readSSE - чтение событий потока до его конца; handle вызывается для каждого события, в том числе
+// состоящего только из retry. Комментарии (heartbeat сервера) пропускаются.
+func readSSE(r io.Reader, handle func(e sseEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	e := sseEvent{}
+	var data []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if len(data) > 0 || e.Retry > 0 {
+				e.Data = strings.Join(data, "\n")
+				if err := handle(e); err != nil {
+					return err
+				}
+			}
+			e, data = sseEvent{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			e.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				e.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
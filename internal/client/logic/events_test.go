@@ -0,0 +1,36 @@
+package logic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := "retry: 5000\n\n" +
+		": ping\n\n" +
+		"event: record.created\ndata: {\"record_id\":1}\n\n" +
+		"event: record.created\r\ndata: line1\r\ndata: line2\r\n\r\n" +
+		"data: incomplete"
+	var events []sseEvent
+	err := readSSE(strings.NewReader(stream), func(e sseEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []sseEvent{
+		{Retry: 5 * time.Second},
+		{Event: "record.created", Data: `{"record_id":1}`},
+		{Event: "record.created", Data: "line1\nline2"},
+	}, events, "comments and an unterminated event are skipped")
+
+	stop := errors.New("stop")
+	err = readSSE(strings.NewReader(stream), func(e sseEvent) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
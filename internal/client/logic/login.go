@@ -5,11 +5,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/client/logger"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"net/url"
 )
@@ -20,6 +22,10 @@ type LoginReq struct {
 	Password string `json:"password"`
 }
 
+// ErrPasswordChangeRequired - пароль задан администратором (admin reset-password), войти можно после его смены.
+// Текст совпадает с ошибкой в ответе сервера.
+var ErrPasswordChangeRequired = errors.New("password change required")
+
 // Login - логин
 func Login(ctx context.Context, httpclient *httpClient.HttpClientInstance, login string, password string) (creds *models.TokenResponse, err error) {
 	if httpclient == nil {
@@ -41,8 +47,16 @@ func Login(ctx context.Context, httpclient *httpClient.HttpClientInstance, login
 			logger.Log.Debug("error: %w", zap.Error(err))
 		}
 	}()
+	if response.StatusCode == http.StatusForbidden {
+		b, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		var body models.ErrorResponse
+		if json.Unmarshal(b, &body) == nil && body.Error == ErrPasswordChangeRequired.Error() {
+			return nil, ErrPasswordChangeRequired
+		}
+		response.Body = io.NopCloser(bytes.NewReader(b))
+	}
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Error in Login")
+		return nil, httpclient.ResponseError("error in Login", response)
 	}
 	creds = &models.TokenResponse{}
 	if err = json.NewDecoder(response.Body).Decode(creds); err != nil {
@@ -50,3 +64,26 @@ func Login(ctx context.Context, httpclient *httpClient.HttpClientInstance, login
 	}
 	return creds, nil
 }
+
+// ChangePassword - смена пароля password пользователя login на newPassword
+func ChangePassword(ctx context.Context, httpclient *httpClient.HttpClientInstance, login, password, newPassword string) error {
+	if httpclient == nil {
+		return fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/password")
+	b, _ := json.Marshal(models.PasswordChangeRequest{Login: login, Password: password, NewPassword: newPassword})
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		return httpclient.ResponseError("error changing password", response)
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+// Модуль очереди операций с записями, отложенных до появления связи с сервером
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/utils"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/randid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Операции с записями в очереди
+const (
+	PendingCreate = "create"
+	PendingUpdate = "update"
+	PendingDelete = "delete"
+)
+
+var (
+	// ErrServerUnreachable - запрос не дошел до сервера или ответ не получен
+	ErrServerUnreachable = errors.New("server is unreachable")
+	// ErrQueued - операция не выполнена сейчас и сохранена в очередь, она будет отправлена позже
+	ErrQueued = errors.New("operation is queued")
+)
+
+// PendingOp - операция с записью, ожидающая отправки на сервер
+type PendingOp struct {
+	// Key - ключ идемпотентности: повтор создания записи с ним не создаст дубликат,
+	// даже если первая попытка дошла до сервера, а ответ потерян
+	Key string `json:"key"`
+	// API - адрес сервера, которому предназначена операция
+	API  string `json:"api"`
+	Op   string `json:"op"`
+	Name string `json:"name"`
+	// Record - отправляемая запись, у удаления не заполнена
+	Record *models.DataRecordRequest `json:"record,omitempty"`
+	// BaseVersion - версия записи на сервере, от которой сделаны замена или удаление, 0 - без проверки.
+	// Если запись с тех пор изменило другое устройство, сервер отклоняет операцию.
+	BaseVersion uint64    `json:"base_version,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Attempts и LastError - неудачные попытки отправки и ошибка последней из них
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// statusError - сервер ответил неожиданным кодом
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// responseStatus - код ответа сервера из ошибки, 0 - ошибка не связана с ответом
+func responseStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	return 0
+}
+
+// replayed - очередь уже отправлялась этой командой
+var replayed atomic.Bool
+
+// ListPending - операции в очереди пользователя в порядке добавления
+func ListPending() ([]PendingOp, error) {
+	login := viper.GetString("login")
+	if login == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+	return readOutbox(login)
+}
+
+// DiscardPending - удаление из очереди операций по началу ключа, без ключей - всех операций.
+// Возвращает удаленные операции; начало ключа, подходящее к нескольким операциям, - ошибка.
+func DiscardPending(keys []string) ([]PendingOp, error) {
+	login := viper.GetString("login")
+	if login == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+	var discarded []PendingOp
+	err := updateOutbox(login, func(ops []PendingOp) ([]PendingOp, error) {
+		if len(keys) == 0 {
+			discarded = ops
+			return nil, nil
+		}
+		drop := make(map[string]struct{})
+		for _, prefix := range keys {
+			var found []string
+			for _, op := range ops {
+				if strings.HasPrefix(op.Key, prefix) {
+					found = append(found, op.Key)
+				}
+			}
+			switch len(found) {
+			case 0:
+				return nil, fmt.Errorf("no pending operation with key %q", prefix)
+			case 1:
+				drop[found[0]] = struct{}{}
+			default:
+				return nil, fmt.Errorf("key %q matches %d pending operations", prefix, len(found))
+			}
+		}
+		kept := ops[:0:0]
+		for _, op := range ops {
+			if _, ok := drop[op.Key]; ok {
+				discarded = append(discarded, op)
+				continue
+			}
+			kept = append(kept, op)
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return discarded, nil
+}
+
+// ReplayPending - отправка операций из очереди текущему серверу по порядку добавления.
+// Отклоненная сервером операция остается в очереди с причиной отказа, следующие операции с той же записью
+// ждут ее; недоступность сервера или отказ в доступе прерывают отправку. Возвращает число выполненных операций.
+func ReplayPending(ctx context.Context, logger *zap.SugaredLogger) (int, error) {
+	sent, rejected, err := replayPending(ctx)
+	if sent > 0 {
+		logger.Infof("%d pending operations sent to the server", sent)
+	}
+	for _, op := range rejected {
+		logger.Warnf("pending %s of record %q is rejected, see gclient pending: %s", op.Op, op.Name, op.LastError)
+	}
+	return sent, err
+}
+
+// AutoReplayPending - отправка очереди после команды, которая получила ответ сервера.
+// Ошибки только записываются в лог: команда уже выполнена, а очередь будет отправлена в следующий раз.
+func AutoReplayPending(ctx context.Context, logger *zap.SugaredLogger) {
+	if replayed.Load() || !httpClient.Reached() || viper.GetString("login") == "" || viper.GetString("token") == "" {
+		return
+	}
+	if _, err := ReplayPending(ctx, logger); err != nil {
+		logger.Warnf("pending operations are not sent: %v", err)
+	}
+}
+
+// replayPending - отправка очереди (ReplayPending) и отклоненные при этом операции
+func replayPending(ctx context.Context) (sent int, rejected []PendingOp, err error) {
+	replayed.Store(true)
+	login := viper.GetString("login")
+	if login == "" {
+		return 0, nil, fmt.Errorf("not logged in")
+	}
+	ops, err := readOutbox(login)
+	if err != nil {
+		return 0, nil, err
+	}
+	api := viper.GetString("api")
+	blocked := make(map[string]struct{})
+	// versions - версии записей после выполненных операций, от них сделаны следующие операции (completePending)
+	versions := make(map[string]uint64)
+	for _, op := range ops {
+		if _, ok := blocked[op.Name]; ok || op.API != api {
+			continue
+		}
+		if v, ok := versions[op.Name]; ok && op.Op != PendingCreate {
+			op.BaseVersion = v
+		}
+		record, sendErr := sendPending(ctx, &op)
+		if sendErr == nil {
+			if err := completePending(login, op, record); err != nil {
+				return sent, rejected, err
+			}
+			if record != nil {
+				versions[op.Name] = record.Version
+			}
+			sent++
+			continue
+		}
+		op.Attempts++
+		op.LastError = sendErr.Error()
+		if err := savePendingAttempt(login, op); err != nil {
+			return sent, rejected, err
+		}
+		if !isRejected(sendErr) {
+			return sent, rejected, sendErr
+		}
+		rejected = append(rejected, op)
+		blocked[op.Name] = struct{}{}
+	}
+	return sent, rejected, nil
+}
+
+// sendPending - отправка одной операции из очереди; для создания и замены возвращается запись на сервере
+func sendPending(ctx context.Context, op *PendingOp) (*models.DataRecord, error) {
+	switch op.Op {
+	case PendingCreate:
+		record, err := saveRemoteRecord(ctx, http.MethodPost, op.Record, op.Key, 0)
+		if responseStatus(err) == http.StatusGone {
+			// запись создана первой попыткой и с тех пор удалена: создавать ее заново не нужно
+			return nil, nil
+		}
+		return record, err
+	case PendingUpdate:
+		record, err := saveRemoteRecord(ctx, http.MethodPut, op.Record, "", op.BaseVersion)
+		if errors.Is(err, ErrVersionMismatch) {
+			// версия могла измениться самой этой заменой, если первая попытка дошла до сервера, а ответ потерян
+			current, fetchErr := fetchRemoteRecord(ctx, op.Name)
+			if fetchErr == nil && current != nil && current.Data == op.Record.Data && current.Key == op.Record.Key {
+				return current, nil
+			}
+		}
+		return record, err
+	case PendingDelete:
+		return nil, deleteRemoteRecord(ctx, op.Name, op.BaseVersion)
+	default:
+		return nil, fmt.Errorf("unknown pending operation %q", op.Op)
+	}
+}
+
+// isRejected - сервер отклонил саму операцию (конфликт, квота, запись не найдена), остальные операции можно отправлять.
+// Отказ в доступе и ошибки сервера касаются всех операций.
+func isRejected(err error) bool {
+	code := responseStatus(err)
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError
+}
+
+// sendOrQueue - отправка операции op; если сервер недоступен, операция ставится в очередь (ErrQueued).
+// Если в очереди остались операции с той же записью, новая встает за ними.
+func sendOrQueue(ctx context.Context, op PendingOp) (*models.DataRecord, error) {
+	queued, err := pendingFor(ctx, op.Name)
+	if err != nil {
+		return nil, err
+	}
+	if op.Key, err = randid.New(); err != nil {
+		return nil, err
+	}
+	if queued {
+		if err := enqueue(op); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w after earlier operations with record %q", ErrQueued, op.Name)
+	}
+	record, err := sendPending(ctx, &op)
+	if !errors.Is(err, ErrServerUnreachable) {
+		return record, err
+	}
+	if qErr := enqueue(op); qErr != nil {
+		return nil, errors.Join(err, qErr)
+	}
+	return nil, fmt.Errorf("%w: %w", ErrQueued, err)
+}
+
+// pendingFor - в очереди текущего сервера есть операции с записью name после попытки их отправить
+func pendingFor(ctx context.Context, name string) (bool, error) {
+	login := viper.GetString("login")
+	if login == "" {
+		return false, fmt.Errorf("not logged in")
+	}
+	ops, err := readOutbox(login)
+	if err != nil || len(ops) == 0 {
+		return false, err
+	}
+	if !replayed.Load() {
+		// очередь отправляется раньше новой операции, чтобы сохранить порядок; ошибки сохраняются в самой очереди
+		_, _, _ = replayPending(ctx)
+		if ops, err = readOutbox(login); err != nil {
+			return false, err
+		}
+	}
+	api := viper.GetString("api")
+	for _, op := range ops {
+		if op.API == api && op.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// enqueue - добавление операции в конец очереди текущего сервера
+func enqueue(op PendingOp) error {
+	login := viper.GetString("login")
+	if login == "" {
+		return fmt.Errorf("not logged in")
+	}
+	op.API = viper.GetString("api")
+	op.CreatedAt = time.Now().UTC()
+	return updateOutbox(login, func(ops []PendingOp) ([]PendingOp, error) {
+		return append(ops, op), nil
+	})
+}
+
+// completePending - удаление выполненной операции done из очереди. Следующие операции с той же записью сделаны
+// поверх done, поэтому их версия заменяется версией record, которую вернул сервер; локальная копия тоже получает ее.
+func completePending(login string, done PendingOp, record *models.DataRecord) error {
+	err := updateOutbox(login, func(ops []PendingOp) ([]PendingOp, error) {
+		kept := ops[:0]
+		for _, op := range ops {
+			if op.Key == done.Key {
+				continue
+			}
+			if record != nil && op.API == done.API && op.Name == done.Name && op.Op != PendingCreate {
+				op.BaseVersion = record.Version
+			}
+			kept = append(kept, op)
+		}
+		return kept, nil
+	})
+	if err != nil || record == nil {
+		return err
+	}
+	local, err := localRecord(login, done.Name)
+	if err != nil || local == nil {
+		return err
+	}
+	local.ID, local.Version = record.ID, record.Version
+	repo, err := recordRepository(login, local.Type)
+	if err != nil {
+		return err
+	}
+	return repo.Put(local)
+}
+
+// localRecord - локальная копия записи name, nil - копии нет
+func localRecord(login, name string) (*models.DataRecord, error) {
+	repo, err := recordRepository(login, models.PASS)
+	if err != nil {
+		return nil, err
+	}
+	records, err := repo.List()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].Name == name {
+			return &records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// savePendingAttempt - сохранение неудачной попытки отправить операцию
+func savePendingAttempt(login string, attempt PendingOp) error {
+	return updateOutbox(login, func(ops []PendingOp) ([]PendingOp, error) {
+		for i := range ops {
+			if ops[i].Key == attempt.Key {
+				ops[i] = attempt
+			}
+		}
+		return ops, nil
+	})
+}
+
+// updateOutbox - изменение очереди пользователя login функцией update.
+// Очередь перечитывается перед каждым изменением, чтобы не потерять операции, добавленные другой командой.
+func updateOutbox(login string, update func(ops []PendingOp) ([]PendingOp, error)) error {
+	ops, err := readOutbox(login)
+	if err != nil {
+		return err
+	}
+	if ops, err = update(ops); err != nil {
+		return err
+	}
+	outboxPath, err := utils.OutboxPath(login)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		if err := os.Remove(outboxPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(outboxPath), 0750); err != nil {
+		return err
+	}
+	// запись через временный файл, чтобы обрыв не оставил испорченную очередь
+	tmp := outboxPath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, outboxPath)
+}
+
+// readOutbox - очередь операций пользователя login
+func readOutbox(login string) ([]PendingOp, error) {
+	outboxPath, err := utils.OutboxPath(login)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(outboxPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ops []PendingOp
+	if err := json.Unmarshal(b, &ops); err != nil {
+		return nil, fmt.Errorf("error reading pending operations %s: %w", outboxPath, err)
+	}
+	return ops, nil
+}
@@ -0,0 +1,188 @@
+package logic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer - сервер, до которого запросы не доходят (down) или от которого не доходят ответы (dropResponses)
+type flakyServer struct {
+	mu            sync.Mutex
+	down          bool
+	dropResponses bool
+	next          http.Handler
+}
+
+func (s *flakyServer) set(down, dropResponses bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down, s.dropResponses = down, dropResponses
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	down, drop := s.down, s.dropResponses
+	s.mu.Unlock()
+	if !down && !drop {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	if drop {
+		s.next.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+		_ = conn.Close()
+	}
+}
+
+// Данные записей в тестах кратны блоку AES: клиент шифрует их без дополнения
+
+// pendingNames - операции очереди в виде "операция название"
+func pendingNames(t *testing.T) []string {
+	t.Helper()
+	ops, err := ListPending()
+	require.NoError(t, err)
+	result := make([]string, 0, len(ops))
+	for _, op := range ops {
+		result = append(result, op.Op+" "+op.Name)
+	}
+	return result
+}
+
+func TestPendingReplay(t *testing.T) {
+	useTestProfile(t)
+	srv := newRecordsServer()
+	net := &flakyServer{next: srv}
+	useTestAPI(t, net)
+	ctx := context.Background()
+
+	net.set(false, true)
+	record, err := PutRecord(ctx, []string{"PASS", "user:password-01", "lost"})
+	require.ErrorIs(t, err, ErrQueued)
+	require.ErrorIs(t, err, ErrServerUnreachable)
+	assert.Equal(t, "lost", record.Name)
+	assert.NotEmpty(t, record.Key, "local copy keeps the encryption key")
+	assert.Contains(t, srv.data(), "lost", "request reached the server, the response was lost")
+
+	net.set(true, false)
+	_, err = PutRecord(ctx, []string{"PASS", "user:password-02", "offline"})
+	require.ErrorIs(t, err, ErrQueued)
+	require.ErrorIs(t, DeleteRecord(ctx, "lost"), ErrQueued)
+	assert.Equal(t, []string{"create lost", "create offline", "delete lost"}, pendingNames(t))
+
+	net.set(false, false)
+	replayed.Store(false)
+	_, err = UpdateRecord(ctx, []string{"PASS", "user:password-03", "offline"})
+	require.NoError(t, err, "queue is sent before the new operation")
+	assert.Empty(t, pendingNames(t))
+	assert.Len(t, srv.data(), 1, "replayed create does not duplicate the record")
+	assert.Contains(t, srv.data(), "offline")
+	assert.NotContains(t, srv.data(), "lost")
+}
+
+func TestPendingRejected(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	srv.put("taken", "a:b")
+	net := &flakyServer{next: srv}
+	useTestAPI(t, net)
+	ctx := context.Background()
+
+	net.set(true, false)
+	_, err := PutRecord(ctx, []string{"PASS", "user:password-04", "taken"})
+	require.ErrorIs(t, err, ErrQueued)
+	_, err = UpdateRecord(ctx, []string{"PASS", "user:password-05", "taken"})
+	require.ErrorIs(t, err, ErrQueued)
+	_, err = PutRecord(ctx, []string{"PASS", "user:password-06", "free"})
+	require.ErrorIs(t, err, ErrQueued)
+
+	net.set(false, false)
+	sent, err := ReplayPending(ctx, l)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent, "rejected create holds back later operations with the same record only")
+	assert.Equal(t, "a:b", srv.data()["taken"])
+	ops, err := ListPending()
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, 2, ops[0].Attempts, "attempt made while offline is counted too")
+	assert.Contains(t, ops[0].LastError, "409")
+	assert.Zero(t, ops[1].Attempts)
+
+	_, err = DiscardPending([]string{"no-such-key"})
+	assert.Error(t, err)
+	discarded, err := DiscardPending([]string{ops[0].Key[:8]})
+	require.NoError(t, err)
+	require.Len(t, discarded, 1)
+	assert.Equal(t, PendingCreate, discarded[0].Op)
+
+	sent, err = ReplayPending(ctx, l)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.NotEqual(t, "a:b", srv.data()["taken"], "update waiting for the discarded create is sent")
+	assert.Empty(t, pendingNames(t))
+}
+
+func TestPendingVersionMismatch(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	srv.put("shared", "a:1")
+	srv.put("mine", "b:1")
+	net := &flakyServer{next: srv}
+	useTestAPI(t, net)
+	ctx := context.Background()
+	_, err := Sync(ctx, l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+
+	net.set(true, false)
+	_, err = UpdateRecord(ctx, []string{"PASS", "user:password-07", "shared"})
+	require.ErrorIs(t, err, ErrQueued)
+	_, err = UpdateRecord(ctx, []string{"PASS", "user:password-08", "mine"})
+	require.ErrorIs(t, err, ErrQueued)
+	require.ErrorIs(t, DeleteRecord(ctx, "mine"), ErrQueued)
+	srv.mu.Lock()
+	srv.put("shared", "other:device")
+	srv.mu.Unlock()
+
+	net.set(false, false)
+	sent, err := ReplayPending(ctx, l)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent, "delete waits for the update and is sent with its version")
+	assert.NotContains(t, srv.data(), "mine")
+	assert.Equal(t, "other:device", srv.data()["shared"], "edit of another device is not overwritten")
+	ops, err := ListPending()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, PendingUpdate+" shared", ops[0].Op+" "+ops[0].Name)
+	assert.Contains(t, ops[0].LastError, "412")
+}
+
+func TestPendingUpdateResponseLost(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	srv.put("note", "a:1")
+	net := &flakyServer{next: srv}
+	useTestAPI(t, net)
+	ctx := context.Background()
+	_, err := Sync(ctx, l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+
+	net.set(false, true)
+	_, err = UpdateRecord(ctx, []string{"PASS", "user:password-09", "note"})
+	require.ErrorIs(t, err, ErrQueued)
+	assert.NotEqual(t, "a:1", srv.data()["note"], "request reached the server, the response was lost")
+
+	net.set(false, false)
+	sent, err := ReplayPending(ctx, l)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent, "own update is not a conflict")
+	assert.Empty(t, pendingNames(t))
+	local, err := localRecord("user", "note")
+	require.NoError(t, err)
+	assert.Equal(t, srv.records["note"].Version, local.Version, "local copy gets the new server version")
+}
@@ -2,25 +2,29 @@
 package logic
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
-	"github.com/EvgeniyBudaev/gophkeeper/internal/client/repository"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/client/utils"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
 )
 
+// tracerName - имя трассировщика клиента
+const tracerName = "github.com/EvgeniyBudaev/gophkeeper/internal/client/logic"
+
 // SaveOrUpdateData - запись иди обновление данных
 func SaveOrUpdateData(logger *zap.SugaredLogger, data *models.DataRecord) error {
 	login := viper.GetString("login")
@@ -29,12 +33,9 @@ func SaveOrUpdateData(logger *zap.SugaredLogger, data *models.DataRecord) error
 		logger.Error(err)
 		return err
 	}
-	var repo repository.DataRecordRepository
-	switch data.Type {
-	case models.PASS:
-		repo = repository.NewPassRepository(login)
-	default:
-		return fmt.Errorf("unsupported data type")
+	repo, err := recordRepository(login, data.Type)
+	if err != nil {
+		return err
 	}
 	if err := repo.Add(data); err != nil {
 		return err
@@ -42,6 +43,32 @@ func SaveOrUpdateData(logger *zap.SugaredLogger, data *models.DataRecord) error
 	return nil
 }
 
+// ReplaceLocalData - сохранение записи с заменой локальной копии
+func ReplaceLocalData(data *models.DataRecord) error {
+	login := viper.GetString("login")
+	if login == "" {
+		return fmt.Errorf("not logged in")
+	}
+	repo, err := recordRepository(login, data.Type)
+	if err != nil {
+		return err
+	}
+	return repo.Put(data)
+}
+
+// RemoveLocalData - удаление локальной копии записи, отсутствие копии не ошибка
+func RemoveLocalData(name string) error {
+	login := viper.GetString("login")
+	if login == "" {
+		return fmt.Errorf("not logged in")
+	}
+	repo, err := recordRepository(login, models.PASS)
+	if err != nil {
+		return err
+	}
+	return repo.Remove(name, models.PASS)
+}
+
 // GetRecords - получение записей
 func GetRecord(ctx context.Context, name string) (*models.DataRecord, error) {
 	token := viper.GetString("token")
@@ -63,8 +90,12 @@ func GetRecord(ctx context.Context, name string) (*models.DataRecord, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error: %w", err)
 	}
+	defer response.Body.Close()
 	if response.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("record not found")
+		return nil, httpclient.ResponseError("record not found", response)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, httpclient.ResponseError("error in Get data", response)
 	}
 	var record models.DataRecord
 	if err = json.NewDecoder(response.Body).Decode(&record); err != nil {
@@ -88,8 +119,76 @@ func GetRecord(ctx context.Context, name string) (*models.DataRecord, error) {
 	return &record, nil
 }
 
-// PutRecord - создание записи с шифрованием
+// PutRecord - создание записи с шифрованием.
+// Если сервер недоступен, создание ставится в очередь (ErrQueued) и возвращается запись для локальной копии.
 func PutRecord(ctx context.Context, args []string) (*models.DataRecord, error) {
+	return sendRecordRequest(ctx, PendingCreate, args)
+}
+
+// UpdateRecord - замена содержимого записи с шифрованием, аргументы как у PutRecord.
+// Если сервер недоступен, замена ставится в очередь (ErrQueued) и возвращается запись для локальной копии.
+// Запись, которую после загрузки локальной копии изменило другое устройство, не заменяется (ErrVersionMismatch).
+func UpdateRecord(ctx context.Context, args []string) (*models.DataRecord, error) {
+	return sendRecordRequest(ctx, PendingUpdate, args)
+}
+
+// DeleteRecord - удаление записи на сервере; если сервер недоступен, удаление ставится в очередь (ErrQueued).
+// Запись, которую после загрузки локальной копии изменило другое устройство, не удаляется (ErrVersionMismatch).
+func DeleteRecord(ctx context.Context, name string) error {
+	base, err := baseVersion(name)
+	if err != nil {
+		return err
+	}
+	_, err = sendOrQueue(ctx, PendingOp{Op: PendingDelete, Name: name, BaseVersion: base})
+	return err
+}
+
+// sendRecordRequest - создание или замена записи из аргументов [record_type] [path|data] [name]
+func sendRecordRequest(ctx context.Context, op string, args []string) (*models.DataRecord, error) {
+	dataObj, err := newRecordRequest(args)
+	if err != nil {
+		return nil, err
+	}
+	var base uint64
+	if op == PendingUpdate {
+		if base, err = baseVersion(dataObj.Name); err != nil {
+			return nil, err
+		}
+	}
+	record, err := sendOrQueue(ctx, PendingOp{Op: op, Name: dataObj.Name, Record: dataObj, BaseVersion: base})
+	if errors.Is(err, ErrQueued) {
+		// локальная копия сохраняет версию сервера, от которой она изменена
+		return &models.DataRecord{
+			Version:  base,
+			Data:     dataObj.Data,
+			Checksum: dataObj.Checksum,
+			Type:     dataObj.Type,
+			Name:     dataObj.Name,
+			Key:      dataObj.Key,
+		}, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// baseVersion - версия записи name на сервере по локальной копии, 0 - копии нет и замена или удаление
+// выполняются без проверки версии
+func baseVersion(name string) (uint64, error) {
+	login := viper.GetString("login")
+	if login == "" {
+		return 0, fmt.Errorf("not logged in")
+	}
+	local, err := localRecord(login, name)
+	if err != nil || local == nil {
+		return 0, err
+	}
+	return local.Version, nil
+}
+
+// newRecordRequest - зашифрованная запись из аргументов [record_type] [path|data] [name]
+func newRecordRequest(args []string) (*models.DataRecordRequest, error) {
 	if len(args) != 3 {
 		return nil, fmt.Errorf("bad request")
 	}
@@ -106,15 +205,9 @@ func PutRecord(ctx context.Context, args []string) (*models.DataRecord, error) {
 		}
 		data = fi.Name()
 	}
-	token := viper.GetString("token")
-	if token == "" {
+	if viper.GetString("token") == "" {
 		return nil, fmt.Errorf("No auth data, login first")
 	}
-	httpclient := httpClient.GetHTTPClient()
-	if httpclient == nil {
-		return nil, fmt.Errorf("configuration error")
-	}
-	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/records")
 	checksum := fmt.Sprintf("%x", md5.Sum([]byte(data)))
 	// Генерация ключа шифрования
 	key, err := utils.GenerateKey()
@@ -129,40 +222,13 @@ func PutRecord(ctx context.Context, args []string) (*models.DataRecord, error) {
 	// Кодирование ключа в base64 для передачи
 	encodedKey := base64.StdEncoding.EncodeToString(key)
 	// Объект передачи с зашифрованными данными
-	dataObj := models.DataRecordRequest{
+	return &models.DataRecordRequest{
 		Type:     models.DataType(dataType),
 		Name:     args[2],
 		Data:     base64.StdEncoding.EncodeToString(encryptedData),
 		Checksum: checksum,
 		Key:      encodedKey,
-	}
-	dataObjB, err := json.Marshal(dataObj)
-	if err != nil {
-		return nil, err
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(dataObjB))
-	if err != nil {
-		return nil, err
-	}
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	response, err := httpclient.Do(request)
-	if err != nil {
-		return &models.DataRecord{
-			Data:     dataObj.Data,
-			Checksum: dataObj.Checksum,
-			Type:     dataObj.Type,
-			Name:     dataObj.Name,
-		}, err
-	}
-	if response.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("error in Post data")
-	}
-	var record models.DataRecord
-	if err = json.NewDecoder(response.Body).Decode(&record); err != nil {
-		return nil, fmt.Errorf("error decode body: %w", err)
-	}
-	return &record, nil
+	}, nil
 }
 
 // ListRecords - получение списка записей
@@ -191,12 +257,13 @@ func ListRecords(ctx context.Context, logger *zap.SugaredLogger) ([]models.DataR
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
 	if response.StatusCode == http.StatusNoContent {
 		logger.Infoln("no records found")
 		return nil, nil
 	}
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error in listrecords\n")
+		return nil, httpclient.ResponseError("error in listrecords", response)
 	}
 	records := make([]models.DataRecord, 0)
 	if err = json.NewDecoder(response.Body).Decode(&records); err != nil {
@@ -205,25 +272,30 @@ func ListRecords(ctx context.Context, logger *zap.SugaredLogger) ([]models.DataR
 	return records, nil
 }
 
-// SyncDataRecords - синхронизация данных
+// SyncDataRecords - двусторонняя синхронизация записей с политикой конфликтов из конфига (sync_conflict)
 func SyncDataRecords(ctx context.Context, logger *zap.SugaredLogger) error {
-	records, err := ListRecords(ctx, logger)
+	policy, err := ParseConflictPolicy(viper.GetString("sync_conflict"))
 	if err != nil {
 		return err
 	}
-	g := new(errgroup.Group)
-	for _, r := range records {
-		data := r
-		g.Go(func() error {
-			if err := SaveOrUpdateData(logger, &data); err != nil {
-				return err
-			}
+	_, err = SyncRecords(ctx, logger, SyncOptions{Policy: policy})
+	return err
+}
 
-			return nil
-		})
-	}
-	if err := g.Wait(); err != nil {
-		return err
-	}
-	return nil
+// SyncRecords - синхронизация записей (Sync) с трассировкой
+func SyncRecords(ctx context.Context, logger *zap.SugaredLogger, opts SyncOptions) (plan *SyncPlan, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "records sync")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	span.SetAttributes(attribute.String("sync.policy", string(opts.Policy)), attribute.Bool("sync.dry_run", opts.DryRun))
+	plan, err = Sync(ctx, logger, opts)
+	if plan != nil {
+		span.SetAttributes(attribute.Int("sync.steps", len(plan.Steps)), attribute.Int("sync.conflicts", plan.Conflicts()))
+	}
+	return plan, err
 }
@@ -36,7 +36,7 @@ func Register(logger *zap.SugaredLogger, login string, password string) (creds *
 		}
 	}()
 	if response.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("Error in Register")
+		return nil, httpclient.ResponseError("error in Register", response)
 	}
 	creds = &models.TokenResponse{}
 	if err = json.NewDecoder(response.Body).Decode(creds); err != nil {
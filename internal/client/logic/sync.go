@@ -0,0 +1,572 @@
+// Модуль двусторонней синхронизации записей
+package logic
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/repository"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ErrVersionMismatch - запись на сервере изменена после версии, от которой клиент ее меняет или удаляет
+var ErrVersionMismatch = errors.New("record was changed on the server")
+
+// ConflictPolicy - способ разрешения конфликта: запись изменена и локально, и на сервере после последней синхронизации
+type ConflictPolicy string
+
+const (
+	// ServerWins - локальная копия заменяется серверной
+	ServerWins ConflictPolicy = "server"
+	// ClientWins - серверная копия заменяется локальной
+	ClientWins ConflictPolicy = "client"
+	// KeepBoth - локальная копия отправляется на сервер как "<name> (conflict)", под прежним названием остается серверная
+	KeepBoth ConflictPolicy = "keep-both"
+)
+
+// ParseConflictPolicy - политика по названию; пустое название - KeepBoth, при которой ничего не теряется
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return KeepBoth, nil
+	case ServerWins, ClientWins, KeepBoth:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q, expected %s, %s or %s", s, ServerWins, ClientWins, KeepBoth)
+	}
+}
+
+// SyncAction - действие шага синхронизации
+type SyncAction string
+
+const (
+	// SyncPull - сохранение серверной копии локально
+	SyncPull SyncAction = "pull"
+	// SyncDeleteLocal - удаление локальной копии записи, удаленной на сервере
+	SyncDeleteLocal SyncAction = "delete-local"
+	// SyncPush - создание записи на сервере из локальной копии
+	SyncPush SyncAction = "push"
+	// SyncUpdateRemote - замена серверной копии локальной
+	SyncUpdateRemote SyncAction = "update-remote"
+	// SyncDeleteRemote - удаление на сервере записи, удаленной локально
+	SyncDeleteRemote SyncAction = "delete-remote"
+	// SyncForget - запись удалена с обеих сторон, остается забыть ее состояние
+	SyncForget SyncAction = "forget"
+)
+
+// SyncStep - шаг плана синхронизации
+type SyncStep struct {
+	Action SyncAction
+	Name   string
+	// Record - записываемое содержимое: серверная копия для SyncPull, локальная для SyncPush и SyncUpdateRemote
+	Record *models.DataRecord
+	// Version - версия серверной копии, которую меняют SyncUpdateRemote и SyncDeleteRemote, 0 - без проверки
+	Version uint64
+	// Conflict - шаг разрешает конфликт
+	Conflict bool
+}
+
+// String - описание шага для вывода плана
+func (s SyncStep) String() string {
+	if s.Conflict {
+		return fmt.Sprintf("%-13s %s [conflict]", s.Action, s.Name)
+	}
+	return fmt.Sprintf("%-13s %s", s.Action, s.Name)
+}
+
+// SyncOptions - параметры синхронизации
+type SyncOptions struct {
+	Policy ConflictPolicy
+	// DryRun - только составить план, ничего не меняя ни локально, ни на сервере
+	DryRun bool
+	// Full - загрузить все записи и сравнить их с локальными копиями без учета прошлых синхронизаций
+	Full bool
+}
+
+// SyncPlan - план синхронизации; после Sync без DryRun - выполненные шаги
+type SyncPlan struct {
+	Steps []SyncStep
+}
+
+// Conflicts - число шагов, разрешающих конфликты
+func (p *SyncPlan) Conflicts() int {
+	n := 0
+	for _, s := range p.Steps {
+		if s.Conflict {
+			n++
+		}
+	}
+	return n
+}
+
+// Sync - двусторонняя синхронизация записей пользователя. Локальные копии и изменения на сервере после
+// прошлой синхронизации сравниваются с состоянием записей на момент прошлой синхронизации (профиль пользователя):
+// изменения одной стороны переносятся на другую, изменения обеих - конфликт, который разрешается по opts.Policy.
+// Запись, измененная на сервере уже во время синхронизации, тоже считается конфликтом и разрешается по opts.Policy.
+// При ошибке выполненные шаги сохраняются, а курсор - нет, поэтому следующая синхронизация продолжит с нее.
+// Перед сравнением отправляется очередь отложенных операций (кроме opts.DryRun).
+func Sync(ctx context.Context, logger *zap.SugaredLogger, opts SyncOptions) (*SyncPlan, error) {
+	login := viper.GetString("login")
+	if login == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+	if !opts.DryRun {
+		// создание из очереди повторяется с ключом идемпотентности, а отправка той же записи синхронизацией
+		// закончилась бы конфликтом, если первая попытка все-таки дошла до сервера
+		if _, err := ReplayPending(ctx, logger); err != nil {
+			return nil, err
+		}
+	}
+	api := viper.GetString("api")
+	st, err := loadSyncState(api, login)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Full {
+		st = &syncState{Records: make(map[string]recordBase)}
+	}
+	repo, _ := recordRepository(login, models.PASS)
+	local, err := repo.List()
+	if errors.Is(err, os.ErrNotExist) {
+		// без папки записей удаление каждой из них выглядело бы локальным удалением: загружаем все заново
+		if len(st.Records) > 0 {
+			logger.Warnf("local records folder is missing, restoring all records from the server")
+		}
+		st = &syncState{Records: make(map[string]recordBase)}
+	} else if err != nil {
+		return nil, err
+	}
+	remote, cursor, restarted, err := fetchChanges(ctx, logger, st.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	supported := remote[:0]
+	for _, c := range remote {
+		if _, err := recordRepository(login, c.Record.Type); err != nil {
+			logger.Warnf("skipping record %q: %v", c.Record.Name, err)
+			continue
+		}
+		// название приходит с сервера и становится именем локального файла
+		if err := repository.CheckName(c.Record.Name); err != nil {
+			logger.Warnf("skipping record: %v", err)
+			continue
+		}
+		supported = append(supported, c)
+	}
+	if restarted {
+		// курсор устарел: версии в состоянии могут не совпадать с версиями сервера, сравниваем только содержимое
+		for name, base := range st.Records {
+			base.Version = 0
+			st.Records[name] = base
+		}
+	}
+	plan := &SyncPlan{Steps: planSync(local, supported, st.Records, opts.Policy)}
+	if opts.DryRun {
+		return plan, nil
+	}
+	plan.Steps, err = runSync(ctx, repo, st, plan.Steps, opts.Policy)
+	if err == nil {
+		st.Cursor = cursor
+	}
+	if saveErr := saveSyncState(api, login, st); saveErr != nil {
+		return plan, errors.Join(err, fmt.Errorf("error saving sync state: %w", saveErr))
+	}
+	return plan, err
+}
+
+// syncSide - изменение записи на одной стороне после прошлой синхронизации
+type syncSide int
+
+const (
+	sideNone syncSide = iota
+	sideUnchanged
+	sideCreated
+	sideModified
+	sideDeleted
+)
+
+// planSync - шаги синхронизации по локальным копиям, изменениям на сервере и состоянию прошлой синхронизации
+func planSync(local []models.DataRecord, remote []models.RecordChange, bases map[string]recordBase,
+	policy ConflictPolicy) []SyncStep {
+	localByName := make(map[string]*models.DataRecord, len(local))
+	names := make(map[string]struct{})
+	for i := range local {
+		localByName[local[i].Name] = &local[i]
+		names[local[i].Name] = struct{}{}
+	}
+	remoteByName := make(map[string]*models.RecordChange, len(remote))
+	for i := range remote {
+		c := &remote[i]
+		if cur, ok := remoteByName[c.Record.Name]; !ok || c.Version > cur.Version {
+			remoteByName[c.Record.Name] = c
+		}
+		names[c.Record.Name] = struct{}{}
+	}
+	for name := range bases {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	steps := make([]SyncStep, 0)
+	for _, name := range sorted {
+		base, hasBase := bases[name]
+		l := localByName[name]
+		ls := localSide(l, base, hasBase)
+		var r *models.DataRecord
+		rs := sideUnchanged
+		// remoteVersion - версия серверной копии, от которой она заменяется или удаляется
+		remoteVersion := base.Version
+		if c := remoteByName[name]; c != nil && (!hasBase || c.Version > base.Version) {
+			switch {
+			case c.Op != models.ChangeDeleted:
+				r, rs, remoteVersion = &c.Record, sideModified, c.Version
+			case hasBase:
+				rs = sideDeleted
+			}
+		}
+		pull := SyncStep{Action: SyncPull, Name: name, Record: r}
+		switch {
+		case rs == sideUnchanged:
+			switch ls {
+			case sideCreated:
+				steps = append(steps, SyncStep{Action: SyncPush, Name: name, Record: l})
+			case sideModified:
+				steps = append(steps, SyncStep{Action: SyncUpdateRemote, Name: name, Record: l, Version: remoteVersion})
+			case sideDeleted:
+				steps = append(steps, SyncStep{Action: SyncDeleteRemote, Name: name, Version: remoteVersion})
+			}
+		case ls == sideNone || ls == sideUnchanged:
+			if rs == sideDeleted {
+				steps = append(steps, SyncStep{Action: SyncDeleteLocal, Name: name})
+			} else {
+				steps = append(steps, pull)
+			}
+		case ls == sideDeleted && rs == sideDeleted:
+			steps = append(steps, SyncStep{Action: SyncForget, Name: name})
+		case ls == sideDeleted:
+			// удалена локально, изменена на сервере
+			if policy == ClientWins {
+				steps = append(steps, SyncStep{Action: SyncDeleteRemote, Name: name, Version: remoteVersion,
+					Conflict: true})
+			} else {
+				pull.Conflict = true
+				steps = append(steps, pull)
+			}
+		case rs == sideDeleted:
+			// изменена локально, удалена на сервере
+			if policy == ServerWins {
+				steps = append(steps, SyncStep{Action: SyncDeleteLocal, Name: name, Conflict: true})
+			} else {
+				steps = append(steps, SyncStep{Action: SyncPush, Name: name, Record: l, Conflict: true})
+			}
+		case recordHash(l) == recordHash(r):
+			// одинаково изменена с обеих сторон
+			steps = append(steps, pull)
+		default:
+			pull.Conflict = true
+			switch policy {
+			case ServerWins:
+				steps = append(steps, pull)
+			case ClientWins:
+				steps = append(steps, SyncStep{Action: SyncUpdateRemote, Name: name, Record: l, Version: remoteVersion,
+					Conflict: true})
+			default:
+				copyName := conflictName(name, names)
+				names[copyName] = struct{}{}
+				localCopy := *l
+				localCopy.ID, localCopy.Version, localCopy.Name = 0, 0, copyName
+				steps = append(steps, SyncStep{Action: SyncPush, Name: copyName, Record: &localCopy, Conflict: true}, pull)
+			}
+		}
+	}
+	return steps
+}
+
+// localSide - изменение локальной копии l после прошлой синхронизации
+func localSide(l *models.DataRecord, base recordBase, hasBase bool) syncSide {
+	switch {
+	case l == nil && hasBase:
+		return sideDeleted
+	case l == nil:
+		return sideNone
+	case !hasBase:
+		return sideCreated
+	case recordHash(l) != base.Hash:
+		return sideModified
+	default:
+		return sideUnchanged
+	}
+}
+
+// conflictName - свободное название для копии записи name при разрешении конфликта
+func conflictName(name string, taken map[string]struct{}) string {
+	candidate := name + " (conflict)"
+	for i := 2; ; i++ {
+		if _, ok := taken[candidate]; !ok {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (conflict %d)", name, i)
+	}
+}
+
+// recordHash - хэш содержимого записи, по которому определяются изменения
+func recordHash(r *models.DataRecord) string {
+	h := sha256.New()
+	for _, part := range []string{string(r.Type), r.Data, r.Key} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// runSync - выполнение шагов с обновлением состояния st; возвращает выполненные шаги.
+// Шаг, который не прошел проверку версии (запись изменена на сервере после составления плана), заменяется
+// разрешением конфликта с текущей серверной копией по policy.
+func runSync(ctx context.Context, repo repository.DataRecordRepository, st *syncState, steps []SyncStep,
+	policy ConflictPolicy) ([]SyncStep, error) {
+	done := make([]SyncStep, 0, len(steps))
+	for _, s := range steps {
+		err := runSyncStep(ctx, repo, st, s)
+		if errors.Is(err, ErrVersionMismatch) {
+			var resolved []SyncStep
+			resolved, err = resolveVersionMismatch(ctx, repo, st, s, policy)
+			done = append(done, resolved...)
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return done, fmt.Errorf("error syncing record %q (%s): %w", s.Name, s.Action, err)
+		}
+		done = append(done, s)
+	}
+	return done, nil
+}
+
+// resolveVersionMismatch - выполнение шагов, которыми planSync заменяет шаг s с учетом текущей серверной копии;
+// возвращает выполненные шаги. Повторное изменение записи на сервере за это время - ошибка.
+func resolveVersionMismatch(ctx context.Context, repo repository.DataRecordRepository, st *syncState, s SyncStep,
+	policy ConflictPolicy) ([]SyncStep, error) {
+	current, err := fetchRemoteRecord(ctx, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	base, hasBase := st.Records[s.Name]
+	bases := make(map[string]recordBase)
+	if hasBase {
+		bases[s.Name] = base
+	}
+	remote := models.RecordChange{Version: base.Version + 1, Op: models.ChangeDeleted,
+		Record: models.DataRecord{Name: s.Name}}
+	if current != nil {
+		remote = models.RecordChange{Version: current.Version, Op: models.ChangeUpdated, Record: *current}
+	}
+	var local []models.DataRecord
+	if s.Record != nil {
+		local = append(local, *s.Record)
+	}
+	steps := planSync(local, []models.RecordChange{remote}, bases, policy)
+	for i, step := range steps {
+		if err := runSyncStep(ctx, repo, st, step); err != nil {
+			return steps[:i], err
+		}
+	}
+	return steps, nil
+}
+
+// runSyncStep - выполнение шага синхронизации
+func runSyncStep(ctx context.Context, repo repository.DataRecordRepository, st *syncState, s SyncStep) error {
+	record := s.Record
+	switch s.Action {
+	case SyncPush, SyncUpdateRemote:
+		method := http.MethodPost
+		if s.Action == SyncUpdateRemote {
+			method = http.MethodPut
+		}
+		saved, err := sendRecord(ctx, method, s.Name, record, s.Version)
+		if err != nil {
+			return err
+		}
+		record = saved
+		fallthrough
+	case SyncPull:
+		if err := repo.Put(record); err != nil {
+			return err
+		}
+		st.Records[s.Name] = recordBase{ID: record.ID, Version: record.Version, Hash: recordHash(record)}
+	case SyncDeleteLocal:
+		if err := repo.Remove(s.Name, models.PASS); err != nil {
+			return err
+		}
+		delete(st.Records, s.Name)
+	case SyncDeleteRemote:
+		if err := deleteRemoteRecord(ctx, s.Name, s.Version); err != nil {
+			return err
+		}
+		delete(st.Records, s.Name)
+	case SyncForget:
+		delete(st.Records, s.Name)
+	}
+	return nil
+}
+
+// sendRecord - отправка локальной копии record на сервер под названием name: POST создает запись, PUT заменяет ее
+// версии ifVersion (0 - любой)
+func sendRecord(ctx context.Context, method, name string, record *models.DataRecord, ifVersion uint64) (
+	*models.DataRecord, error) {
+	return saveRemoteRecord(ctx, method, &models.DataRecordRequest{
+		Type:     record.Type,
+		Name:     name,
+		Data:     record.Data,
+		Checksum: fmt.Sprintf("%x", md5.Sum([]byte(record.Data))),
+		Key:      record.Key,
+	}, "", ifVersion)
+}
+
+// saveRemoteRecord - запрос сохранения записи body.Name на сервере с ключом идемпотентности key, пустой key - без ключа.
+// Замена (PUT) с ifVersion не 0 выполняется, только если запись на сервере этой версии, иначе ErrVersionMismatch.
+// Ошибка сети оборачивается в ErrServerUnreachable, неожиданный код ответа - в statusError.
+func saveRemoteRecord(ctx context.Context, method string, body *models.DataRecordRequest, key string,
+	ifVersion uint64) (*models.DataRecord, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return nil, fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return nil, fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/records")
+	expected := http.StatusCreated
+	if method == http.MethodPut {
+		endpoint, _ = url.JoinPath(endpoint, body.Name)
+		expected = http.StatusOK
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	if key != "" {
+		request.Header.Add(models.IdempotencyKeyHeader, key)
+	}
+	setIfMatch(request, ifVersion)
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrServerUnreachable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return nil, fmt.Errorf("%w: %w", ErrVersionMismatch,
+			&statusError{code: response.StatusCode, err: httpclient.ResponseError("record not saved", response)})
+	}
+	if isQuotaStatus(response.StatusCode) {
+		return nil, fmt.Errorf("%w: %w", ErrQuotaExceeded,
+			&statusError{code: response.StatusCode, err: httpclient.ResponseError("record rejected", response)})
+	}
+	if response.StatusCode != expected {
+		return nil, &statusError{code: response.StatusCode, err: httpclient.ResponseError("cannot save record", response)}
+	}
+	var saved models.DataRecord
+	if err := json.NewDecoder(response.Body).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("error decode body: %w", err)
+	}
+	return &saved, nil
+}
+
+// deleteRemoteRecord - удаление записи name на сервере; уже удаленная запись не ошибка.
+// С ifVersion не 0 запись удаляется, только если она этой версии, иначе ErrVersionMismatch.
+func deleteRemoteRecord(ctx context.Context, name string, ifVersion uint64) error {
+	token := viper.GetString("token")
+	if token == "" {
+		return fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/records", name)
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	setIfMatch(request, ifVersion)
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrServerUnreachable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %w", ErrVersionMismatch,
+			&statusError{code: response.StatusCode, err: httpclient.ResponseError("record not deleted", response)})
+	}
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusNotFound {
+		return &statusError{code: response.StatusCode, err: httpclient.ResponseError("cannot delete record", response)}
+	}
+	return nil
+}
+
+// fetchRemoteRecord - текущая серверная копия записи name без расшифровки, nil - записи нет
+func fetchRemoteRecord(ctx context.Context, name string) (*models.DataRecord, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return nil, fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return nil, fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/records", name)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrServerUnreachable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &statusError{code: response.StatusCode, err: httpclient.ResponseError("cannot get record", response)}
+	}
+	var record models.DataRecord
+	if err := json.NewDecoder(response.Body).Decode(&record); err != nil {
+		return nil, fmt.Errorf("error decode body: %w", err)
+	}
+	return &record, nil
+}
+
+// setIfMatch - условие на версию записи в запросе, 0 - без условия
+func setIfMatch(request *http.Request, version uint64) {
+	if version != 0 {
+		request.Header.Set(models.IfMatchHeader, strconv.Quote(strconv.FormatUint(version, 10)))
+	}
+}
@@ -0,0 +1,361 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/repository"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordsServer - сервер записей в памяти с изменениями по версиям, как у настоящего сервера
+type recordsServer struct {
+	mu      sync.Mutex
+	seq     uint64
+	records map[string]models.DataRecord
+	// keys - названия записей, созданных с ключом идемпотентности
+	keys map[string]string
+	// latest - последнее изменение каждой записи по названию
+	latest map[string]models.RecordChange
+}
+
+func newRecordsServer() *recordsServer {
+	return &recordsServer{records: make(map[string]models.DataRecord), keys: make(map[string]string),
+		latest: make(map[string]models.RecordChange)}
+}
+
+// put - создание или изменение записи на сервере
+func (s *recordsServer) put(name, data string) models.DataRecord {
+	s.seq++
+	r, ok := s.records[name]
+	op := models.ChangeUpdated
+	if !ok {
+		r = models.DataRecord{ID: s.seq, Type: models.PASS, Name: name}
+		op = models.ChangeCreated
+	}
+	r.Data, r.Version = data, s.seq
+	s.records[name] = r
+	s.latest[name] = models.RecordChange{Version: s.seq, Op: op, Record: r}
+	return r
+}
+
+// data - содержимое записей на сервере по названиям
+func (s *recordsServer) data() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[string]string)
+	for name, r := range s.records {
+		result[name] = r.Data
+	}
+	return result
+}
+
+func (s *recordsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/api/user/records/")
+	switch {
+	case r.Method == http.MethodGet && name == "changes":
+		page := models.RecordChanges{Changes: []models.RecordChange{}, Cursor: s.seq}
+		since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		for _, c := range s.latest {
+			if c.Version > since {
+				page.Changes = append(page.Changes, c)
+			}
+		}
+		sort.Slice(page.Changes, func(i, j int) bool { return page.Changes[i].Version < page.Changes[j].Version })
+		_ = json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodGet:
+		record, ok := s.records[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(record)
+	case s.changedSince(name, r.Header.Get(models.IfMatchHeader)):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case r.Method == http.MethodPost || r.Method == http.MethodPut:
+		var req models.DataRecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if name, ok := s.keys[r.Header.Get(models.IdempotencyKeyHeader)]; ok && r.Method == http.MethodPost {
+			record, ok := s.records[name]
+			if !ok {
+				w.WriteHeader(http.StatusGone)
+				return
+			}
+			w.Header().Set(models.IdempotentReplayedHeader, "true")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(record)
+			return
+		}
+		_, exists := s.records[req.Name]
+		status := http.StatusCreated
+		switch {
+		case r.Method == http.MethodPost && exists:
+			status = http.StatusConflict
+		case r.Method == http.MethodPut && !exists:
+			status = http.StatusNotFound
+		case r.Method == http.MethodPut:
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		if status == http.StatusConflict || status == http.StatusNotFound {
+			return
+		}
+		if key := r.Header.Get(models.IdempotencyKeyHeader); key != "" && r.Method == http.MethodPost {
+			s.keys[key] = req.Name
+		}
+		record := s.put(req.Name, req.Data)
+		record.Key = req.Key
+		s.records[req.Name] = record
+		c := s.latest[req.Name]
+		c.Record = record
+		s.latest[req.Name] = c
+		_ = json.NewEncoder(w).Encode(record)
+	case r.Method == http.MethodDelete:
+		record, ok := s.records[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.seq++
+		delete(s.records, name)
+		s.latest[name] = models.RecordChange{Version: s.seq, Op: models.ChangeDeleted,
+			Record: models.DataRecord{ID: record.ID, Type: record.Type, Name: name, Version: s.seq}}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// changedSince - запись name существует и ее версия не совпадает с версией из заголовка If-Match
+func (s *recordsServer) changedSince(name, ifMatch string) bool {
+	record, ok := s.records[name]
+	if ifMatch == "" || !ok {
+		return false
+	}
+	version, _ := strconv.ParseUint(strings.Trim(ifMatch, `"`), 10, 64)
+	return record.Version != version
+}
+
+// writeLocal - локальное изменение записи
+func writeLocal(t *testing.T, name, data string) {
+	t.Helper()
+	path := filepath.Join("user", name+".json")
+	record := models.DataRecord{Type: models.PASS, Name: name}
+	if b, err := os.ReadFile(path); err == nil {
+		require.NoError(t, json.Unmarshal(b, &record))
+	}
+	record.Data = data
+	b, err := json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll("user", 0750))
+	require.NoError(t, os.WriteFile(path, b, 0600))
+}
+
+// localData - содержимое локальных копий по названиям
+func localData(t *testing.T) map[string]string {
+	t.Helper()
+	repo, err := recordRepository("user", models.PASS)
+	require.NoError(t, err)
+	records, err := repo.List()
+	require.NoError(t, err)
+	result := make(map[string]string)
+	for _, r := range records {
+		result[r.Name] = r.Data
+	}
+	return result
+}
+
+// actions - шаги плана в виде "действие название"
+func actions(plan *SyncPlan) []string {
+	result := make([]string, 0, len(plan.Steps))
+	for _, s := range plan.Steps {
+		result = append(result, strings.Join(strings.Fields(s.String()), " "))
+	}
+	return result
+}
+
+func TestSync(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	useTestAPI(t, srv)
+	ctx := context.Background()
+	sync := func(policy ConflictPolicy, dryRun bool) *SyncPlan {
+		t.Helper()
+		plan, err := Sync(ctx, l, SyncOptions{Policy: policy, DryRun: dryRun})
+		require.NoError(t, err)
+		return plan
+	}
+
+	srv.put("remote", "r:1")
+	writeLocal(t, "local", "l:1")
+	assert.Equal(t, []string{"push local", "pull remote"}, actions(sync(KeepBoth, false)))
+	assert.Equal(t, map[string]string{"local": "l:1", "remote": "r:1"}, srv.data())
+	assert.Equal(t, map[string]string{"local": "l:1", "remote": "r:1"}, localData(t))
+	assert.Empty(t, sync(KeepBoth, false).Steps, "own changes are not pulled back")
+
+	writeLocal(t, "local", "l:2")
+	srv.put("remote", "r:2")
+	assert.Equal(t, []string{"update-remote local", "pull remote"}, actions(sync(KeepBoth, false)))
+	assert.Equal(t, map[string]string{"local": "l:2", "remote": "r:2"}, srv.data())
+	assert.Equal(t, "r:2", localData(t)["remote"])
+
+	writeLocal(t, "remote", "r:local")
+	srv.put("remote", "r:server")
+	plan := sync(ServerWins, true)
+	assert.Equal(t, []string{"pull remote [conflict]"}, actions(plan))
+	assert.Equal(t, 1, plan.Conflicts())
+	assert.Equal(t, "r:local", localData(t)["remote"], "dry run changes nothing")
+	assert.Equal(t, "r:server", srv.data()["remote"])
+
+	assert.Equal(t, []string{"push remote (conflict) [conflict]", "pull remote [conflict]"}, actions(sync(KeepBoth, false)))
+	assert.Equal(t, map[string]string{"local": "l:2", "remote": "r:server", "remote (conflict)": "r:local"}, srv.data())
+	assert.Equal(t, srv.data(), localData(t))
+
+	writeLocal(t, "local", "l:client")
+	srv.put("local", "l:server")
+	assert.Equal(t, []string{"update-remote local [conflict]"}, actions(sync(ClientWins, false)))
+	assert.Equal(t, "l:client", srv.data()["local"])
+
+	require.NoError(t, os.Remove(filepath.Join("user", "remote (conflict).json")))
+	assert.Equal(t, []string{"delete-remote remote (conflict)"}, actions(sync(KeepBoth, false)))
+	assert.NotContains(t, srv.data(), "remote (conflict)")
+
+	require.NoError(t, os.RemoveAll("user"))
+	assert.Equal(t, []string{"pull local", "pull remote"}, actions(sync(KeepBoth, false)),
+		"missing records folder is restored, not deleted on the server")
+	assert.Equal(t, srv.data(), localData(t))
+}
+
+func TestSync_UnsafeRemoteNames(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	useTestAPI(t, srv)
+	srv.put("../escape", "a:1")
+	srv.put("nested/name", "b:1")
+	srv.put(`back\slash`, "c:1")
+	srv.put("safe", "d:1")
+	require.NoError(t, os.WriteFile("victim.json", []byte("keep"), 0600))
+
+	plan, err := Sync(context.Background(), l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pull safe"}, actions(plan), "records with unsafe names are skipped")
+	assert.Equal(t, map[string]string{"safe": "d:1"}, localData(t))
+	assert.NoFileExists(t, "escape.json", "file outside the login folder is not written")
+	assert.NoDirExists(t, filepath.Join("user", "nested"))
+
+	repo := repository.NewPassRepository("user")
+	assert.ErrorIs(t, repo.Remove("../victim", models.PASS), repository.ErrUnsafeName)
+	assert.ErrorIs(t, repo.Put(&models.DataRecord{Type: models.PASS, Name: "../victim"}), repository.ErrUnsafeName)
+	assert.FileExists(t, "victim.json")
+}
+
+func TestSync_ChangedDuringSync(t *testing.T) {
+	l := useTestProfile(t)
+	srv := newRecordsServer()
+	// race - изменение записи на сервере другим устройством перед первым запросом ее замены или удаления
+	race := ""
+	useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodPut || r.Method == http.MethodDelete) && race != "" {
+			srv.mu.Lock()
+			srv.put("a", race)
+			srv.mu.Unlock()
+			race = ""
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	ctx := context.Background()
+
+	srv.put("a", "a:1")
+	_, err := Sync(ctx, l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+
+	writeLocal(t, "a", "a:client")
+	race = "a:other"
+	plan, err := Sync(ctx, l, SyncOptions{Policy: ClientWins})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update-remote a [conflict]"}, actions(plan))
+	assert.Equal(t, "a:client", srv.data()["a"])
+
+	writeLocal(t, "a", "a:client-2")
+	race = "a:other-2"
+	plan, err = Sync(ctx, l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"push a (conflict) [conflict]", "pull a [conflict]"}, actions(plan))
+	assert.Equal(t, map[string]string{"a": "a:other-2", "a (conflict)": "a:client-2"}, srv.data())
+	assert.Equal(t, srv.data(), localData(t))
+
+	require.NoError(t, os.Remove(filepath.Join("user", "a.json")))
+	race = "a:other-3"
+	plan, err = Sync(ctx, l, SyncOptions{Policy: KeepBoth})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pull a [conflict]"}, actions(plan), "record edited elsewhere is not deleted")
+	assert.Equal(t, "a:other-3", localData(t)["a"])
+	assert.Equal(t, "a:other-3", srv.data()["a"])
+}
+
+func TestPlanSync(t *testing.T) {
+	local := func(name, data string) models.DataRecord {
+		return models.DataRecord{Type: models.PASS, Name: name, Data: data}
+	}
+	base := func(data string) recordBase {
+		r := local("", data)
+		return recordBase{ID: 1, Version: 1, Hash: recordHash(&r)}
+	}
+	updated := models.RecordChange{Version: 2, Op: models.ChangeUpdated,
+		Record: models.DataRecord{ID: 1, Type: models.PASS, Name: "a", Data: "server", Version: 2}}
+	deleted := models.RecordChange{Version: 2, Op: models.ChangeDeleted,
+		Record: models.DataRecord{ID: 1, Type: models.PASS, Name: "a", Version: 2}}
+	bases := map[string]recordBase{"a": base("old")}
+
+	tests := []struct {
+		name   string
+		local  []models.DataRecord
+		remote []models.RecordChange
+		policy ConflictPolicy
+		want   []string
+	}{
+		{"unchanged", []models.DataRecord{local("a", "old")}, nil, KeepBoth, []string{}},
+		{"same edit on both sides", []models.DataRecord{local("a", "server")}, []models.RecordChange{updated}, ServerWins,
+			[]string{"pull a"}},
+		{"deleted on both sides", nil, []models.RecordChange{deleted}, KeepBoth, []string{"forget a"}},
+		{"modified locally, deleted on server, server wins", []models.DataRecord{local("a", "new")},
+			[]models.RecordChange{deleted}, ServerWins, []string{"delete-local a [conflict]"}},
+		{"modified locally, deleted on server, keep both", []models.DataRecord{local("a", "new")},
+			[]models.RecordChange{deleted}, KeepBoth, []string{"push a [conflict]"}},
+		{"deleted locally, modified on server, client wins", nil, []models.RecordChange{updated}, ClientWins,
+			[]string{"delete-remote a [conflict]"}},
+		{"deleted locally, modified on server, keep both", nil, []models.RecordChange{updated}, KeepBoth,
+			[]string{"pull a [conflict]"}},
+		{"own change echoed by server", []models.DataRecord{local("a", "old")},
+			[]models.RecordChange{{Version: 1, Op: models.ChangeUpdated, Record: local("a", "old")}}, KeepBoth, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &SyncPlan{Steps: planSync(tt.local, tt.remote, bases, tt.policy)}
+			assert.Equal(t, tt.want, actions(plan))
+		})
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	p, err := ParseConflictPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, KeepBoth, p)
+	p, err = ParseConflictPolicy("server")
+	require.NoError(t, err)
+	assert.Equal(t, ServerWins, p)
+	_, err = ParseConflictPolicy("newest")
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+// Модуль использования хранилища
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+)
+
+// ErrQuotaExceeded - сервер отклонил запись: превышена квота хранилища или размер записи
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// GetUsage - использование хранилища и квоты пользователя
+func GetUsage(ctx context.Context) (*models.Usage, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		return nil, fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return nil, fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/usage")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, httpclient.ResponseError("error getting usage", response)
+	}
+	var usage models.Usage
+	if err := json.NewDecoder(response.Body).Decode(&usage); err != nil {
+		return nil, fmt.Errorf("error decode body: %w", err)
+	}
+	return &usage, nil
+}
+
+// isQuotaStatus - ответ сервера о превышении квоты: 413 для слишком большой записи, 507 для исчерпанной квоты
+func isQuotaStatus(code int) bool {
+	return code == http.StatusRequestEntityTooLarge || code == http.StatusInsufficientStorage
+}
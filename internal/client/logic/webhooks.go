@@ -0,0 +1,93 @@
+// Модуль вебхуков
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/client/httpClient"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/spf13/viper"
+)
+
+// AddWebhook - регистрация вебхука. В ответе секрет подписи: сервер возвращает его только один раз.
+func AddWebhook(ctx context.Context, req models.WebhookRequest) (*models.Webhook, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var w models.Webhook
+	if err := webhooksRequest(ctx, http.MethodPost, "", bytes.NewReader(body), http.StatusCreated, &w); err != nil {
+		return nil, fmt.Errorf("error adding webhook: %w", err)
+	}
+	return &w, nil
+}
+
+// ListWebhooks - вебхуки пользователя
+func ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var list []models.Webhook
+	if err := webhooksRequest(ctx, http.MethodGet, "", nil, http.StatusOK, &list); err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	return list, nil
+}
+
+// RemoveWebhook - удаление вебхука
+func RemoveWebhook(ctx context.Context, id uint64) error {
+	if err := webhooksRequest(ctx, http.MethodDelete, strconv.FormatUint(id, 10), nil, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("error removing webhook: %w", err)
+	}
+	return nil
+}
+
+// TestWebhook - отправка проверочного события вебхуку, в результате ответ получателя
+func TestWebhook(ctx context.Context, id uint64) (*models.WebhookTestResult, error) {
+	var result models.WebhookTestResult
+	path := strconv.FormatUint(id, 10) + "/test"
+	if err := webhooksRequest(ctx, http.MethodPost, path, nil, http.StatusOK, &result); err != nil {
+		return nil, fmt.Errorf("error testing webhook: %w", err)
+	}
+	return &result, nil
+}
+
+// webhooksRequest - запрос к api/user/webhooks/<path> с токеном; ответ с кодом status декодируется в out
+func webhooksRequest(ctx context.Context, method, path string, body io.Reader, status int, out interface{}) error {
+	token := viper.GetString("token")
+	if token == "" {
+		return fmt.Errorf("no auth data, login first")
+	}
+	httpclient := httpClient.GetHTTPClient()
+	if httpclient == nil {
+		return fmt.Errorf("configuration error")
+	}
+	endpoint, _ := url.JoinPath(httpclient.APIURL, "api/user/webhooks", path)
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Add("Content-Type", "application/json")
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	response, err := httpclient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != status {
+		return httpclient.ResponseError("unexpected response", response)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decode body: %w", err)
+	}
+	return nil
+}
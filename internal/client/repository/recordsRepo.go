@@ -8,10 +8,28 @@ import (
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// ErrUnsafeName - название записи нельзя использовать как имя файла: копия оказалась бы вне папки пользователя
+var ErrUnsafeName = errors.New("record name cannot be used as a local file name")
+
+// CheckName - название записи годится для имени файла локальной копии: один элемент пути без разделителей и ".."
+func CheckName(name string) error {
+	if name == "" || name == "." || strings.ContainsAny(name, `/\`) || !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: %q", ErrUnsafeName, name)
+	}
+	return nil
+}
+
 type DataRecordRepository interface {
 	Add(data *models.DataRecord) error
+	// Put - сохранение записи с заменой локальной копии
+	Put(data *models.DataRecord) error
+	// Remove - удаление локальной копии записи, отсутствие копии не ошибка
+	Remove(name string, dataType models.DataType) error
+	// List - локальные копии записей; os.ErrNotExist - папки записей нет
+	List() ([]models.DataRecord, error)
 }
 
 type PassRepository struct {
@@ -23,9 +41,10 @@ func NewPassRepository(login string) *PassRepository {
 }
 
 func (r *PassRepository) Add(data *models.DataRecord) error {
-	ext := utils.GetExtension(data.Type)
-	filename := fmt.Sprintf("%s%s", data.Name, ext)
-	filepath := filepath.Join(".", r.login, filename)
+	filepath, err := r.path(data.Name, data.Type)
+	if err != nil {
+		return err
+	}
 	localFile, err := os.OpenFile(filepath, os.O_RDONLY, 0600)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -57,3 +76,72 @@ func (r *PassRepository) Add(data *models.DataRecord) error {
 	}
 	return nil
 }
+
+// Put - сохранение записи с заменой локальной копии
+func (r *PassRepository) Put(data *models.DataRecord) error {
+	path, err := r.path(data.Name, data.Type)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	localFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(localFile).Encode(data); err != nil {
+		_ = localFile.Close()
+		return err
+	}
+	return localFile.Close()
+}
+
+// Remove - удаление локальной копии записи
+func (r *PassRepository) Remove(name string, dataType models.DataType) error {
+	path, err := r.path(name, dataType)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List - локальные копии записей типа PASS, название записи - имя файла без расширения
+func (r *PassRepository) List() ([]models.DataRecord, error) {
+	ext := utils.GetExtension(models.PASS)
+	entries, err := os.ReadDir(filepath.Join(".", r.login))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]models.DataRecord, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ext {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(".", r.login, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var record models.DataRecord
+		if err := json.Unmarshal(b, &record); err != nil {
+			return nil, fmt.Errorf("error reading local record %s: %w", e.Name(), err)
+		}
+		if record.Type != models.PASS {
+			continue
+		}
+		record.Name = strings.TrimSuffix(e.Name(), ext)
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// path - файл локальной копии записи; ErrUnsafeName - название вывело бы файл за папку пользователя
+func (r *PassRepository) path(name string, dataType models.DataType) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(".", r.login, name+utils.GetExtension(dataType)), nil
+}
@@ -7,15 +7,61 @@ import (
 	"path"
 )
 
+const (
+	// deviceCertFile - сертификат устройства для mTLS в директории пользователя
+	deviceCertFile = "device.pem"
+	// deviceKeyFile - закрытый ключ устройства для mTLS в директории пользователя
+	deviceKeyFile = "device-key.pem"
+	// syncStateFile - состояние синхронизации записей по адресам серверов в директории пользователя
+	syncStateFile = "sync-state.json"
+	// outboxFile - операции с записями, ожидающие отправки на сервер, в директории пользователя
+	outboxFile = "outbox.json"
+)
+
+// UserDir - директория пользователя (профиль клиента)
+func UserDir(username string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user's home directory: %v", err)
+	}
+	return path.Join(homeDir, username, "."+"gophkeeper"), nil
+}
+
 // CreateUsersDir - создание директории пользователей
 func CreateUsersDir(username string) error {
-	homeDir, err := os.UserHomeDir()
+	userDir, err := UserDir(username)
 	if err != nil {
-		return fmt.Errorf("error getting user's home directory: %v", err)
+		return err
 	}
-	userDir := path.Join(homeDir, username, "."+"gophkeeper")
 	if err := os.MkdirAll(userDir, 0750); err != nil {
 		return fmt.Errorf("error creating user's dir: %v", err)
 	}
 	return nil
 }
+
+// DeviceCertPaths - пути к сертификату и ключу устройства в директории пользователя
+func DeviceCertPaths(username string) (certPath, keyPath string, err error) {
+	userDir, err := UserDir(username)
+	if err != nil {
+		return "", "", err
+	}
+	return path.Join(userDir, deviceCertFile), path.Join(userDir, deviceKeyFile), nil
+}
+
+// SyncStatePath - путь к файлу состояния синхронизации в директории пользователя
+func SyncStatePath(username string) (string, error) {
+	userDir, err := UserDir(username)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(userDir, syncStateFile), nil
+}
+
+// OutboxPath - путь к файлу отложенных операций в директории пользователя
+func OutboxPath(username string) (string, error) {
+	userDir, err := UserDir(username)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(userDir, outboxFile), nil
+}
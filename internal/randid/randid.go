@@ -0,0 +1,17 @@
+// Модуль случайных идентификаторов, общий для клиента и сервера
+package randid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// New - случайный идентификатор из 16 байт в hex: ID запроса или ключ идемпотентности
+func New() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
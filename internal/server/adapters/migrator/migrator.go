@@ -0,0 +1,320 @@
+// Модуль миграций схемы базы данных
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Dialect - диалект SQL базы, к которой применяются миграции
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// advisoryLockID - ключ pg_advisory_lock, под которым реплики сервера применяют миграции по очереди
+const advisoryLockID int64 = 0x676f70686b656570
+
+var (
+	// ErrSchemaTooNew - версия схемы в базе новее, чем известна этому бинарнику
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+	// ErrPendingMigrations - в базе применены не все миграции
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+	// ErrDirty - предыдущая миграция завершилась с ошибкой и требует ручного вмешательства
+	ErrDirty = errors.New("database schema is dirty")
+	// ErrNoChange - нет миграций для применения или отката
+	ErrNoChange = errors.New("no change")
+)
+
+// fileNameRe - имя файла миграции в формате golang-migrate
+var fileNameRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration - пара up/down скриптов одной версии
+type Migration struct {
+	Version uint64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status - состояние схемы базы
+type Status struct {
+	// Version - текущая версия схемы, 0 если миграции не применялись
+	Version uint64
+	// Dirty - признак незавершенной миграции
+	Dirty bool
+	// Latest - последняя версия, известная бинарнику
+	Latest uint64
+	// Migrations - все известные миграции
+	Migrations []Migration
+}
+
+// Pending - количество неприменённых миграций
+func (s Status) Pending() int {
+	n := 0
+	for _, m := range s.Migrations {
+		if m.Version > s.Version {
+			n++
+		}
+	}
+	return n
+}
+
+// Migrator - применение встроенных миграций к базе.
+// Версия хранится в таблице schema_migrations совместимо с golang-migrate,
+// поэтому базы, размеченные внешней утилитой, продолжают мигрировать без ручных действий.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New - конструктор мигратора. Файлы миграций читаются из корня source.
+func New(db *sql.DB, dialect Dialect, source fs.FS) (*Migrator, error) {
+	migrations, err := load(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// load - чтение и сортировка миграций по версии
+func load(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+	byVersion := make(map[uint64]*Migration)
+	for _, e := range entries {
+		parts := fileNameRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || parts == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing migration version %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(source, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", e.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if parts[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest - последняя версия схемы, известная бинарнику
+func (m *Migrator) Latest() uint64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status - текущее состояние схемы
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Close()
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return Status{}, err
+	}
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Version: version, Dirty: dirty, Latest: m.Latest(), Migrations: m.migrations}, nil
+}
+
+// Check - проверка, что схема базы соответствует бинарнику.
+// Возвращает ErrSchemaTooNew, ErrDirty или ErrPendingMigrations.
+func (m *Migrator) Check(ctx context.Context) error {
+	s, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.Dirty:
+		return fmt.Errorf("%w: version %d", ErrDirty, s.Version)
+	case s.Version > s.Latest:
+		return fmt.Errorf("%w: database version %d, latest known %d", ErrSchemaTooNew, s.Version, s.Latest)
+	case s.Version < s.Latest:
+		return fmt.Errorf("%w: database version %d, latest known %d", ErrPendingMigrations, s.Version, s.Latest)
+	}
+	return nil
+}
+
+// Up - применение всех неприменённых миграций. Возвращает количество примененных.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w: version %d", ErrDirty, version)
+		}
+		if version > m.Latest() {
+			return fmt.Errorf("%w: database version %d, latest known %d", ErrSchemaTooNew, version, m.Latest())
+		}
+		for _, mg := range m.migrations {
+			if mg.Version <= version {
+				continue
+			}
+			if err := m.apply(ctx, conn, mg.up, version, mg.Version); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			version = mg.Version
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down - откат последней примененной миграции
+func (m *Migrator) Down(ctx context.Context) (uint64, error) {
+	var target uint64
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w: version %d", ErrDirty, version)
+		}
+		if version == 0 {
+			return ErrNoChange
+		}
+		idx := -1
+		for i, mg := range m.migrations {
+			if mg.Version == version {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("%w: database version %d is unknown", ErrSchemaTooNew, version)
+		}
+		if idx > 0 {
+			target = m.migrations[idx-1].Version
+		}
+		mg := m.migrations[idx]
+		if mg.down == "" {
+			return fmt.Errorf("migration %d_%s has no down script", mg.Version, mg.Name)
+		}
+		if err := m.apply(ctx, conn, mg.down, version, target); err != nil {
+			return fmt.Errorf("error reverting migration %d_%s: %w", mg.Version, mg.Name, err)
+		}
+		return nil
+	})
+	return target, err
+}
+
+// withLock - выполнение fn на выделенном соединении под блокировкой миграций.
+// В PostgreSQL используется advisory lock, чтобы реплики не применяли миграции одновременно;
+// в SQLite запись сериализуется самой базой (транзакции открываются с немедленной блокировкой).
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Close()
+	if m.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+			return fmt.Errorf("error acquiring migrations lock: %w", err)
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+		}()
+	}
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureTable - создание таблицы версий схемы
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// version - текущая версия схемы; 0, если миграции не применялись
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (uint64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
+
+// apply - выполнение скрипта и перевод схемы из версии from в версию to в одной транзакции.
+// Версия перечитывается внутри транзакции: если ее успел изменить другой процесс, скрипт не выполняется.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, from, version uint64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var current int64
+	err = tx.QueryRowContext(ctx, `SELECT version FROM schema_migrations LIMIT 1`).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if uint64(current) != from {
+		return fmt.Errorf("schema version changed concurrently: expected %d, got %d", from, current)
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`,
+			int64(version), false); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
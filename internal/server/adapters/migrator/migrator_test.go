@@ -0,0 +1,95 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrator.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+var testMigrations = fstest.MapFS{
+	"1_users.up.sql":     {Data: []byte(`CREATE TABLE users (id INTEGER PRIMARY KEY);`)},
+	"1_users.down.sql":   {Data: []byte(`DROP TABLE users;`)},
+	"2_records.up.sql":   {Data: []byte(`CREATE TABLE records (id INTEGER PRIMARY KEY);`)},
+	"2_records.down.sql": {Data: []byte(`DROP TABLE records;`)},
+	"README.md":          {Data: []byte(`ignored`)},
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	m, err := New(db, SQLite, testMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), m.Latest())
+
+	s, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), s.Version)
+	assert.Equal(t, 2, s.Pending())
+	assert.ErrorIs(t, m.Check(ctx), ErrPendingMigrations)
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, m.Check(ctx))
+	n, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	version, err := m.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), version)
+	_, err = db.Exec(`SELECT 1 FROM records`)
+	assert.Error(t, err)
+
+	version, err = m.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), version)
+	_, err = m.Down(ctx)
+	assert.ErrorIs(t, err, ErrNoChange)
+}
+
+func TestMigratorSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	m, err := New(db, SQLite, testMigrations)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE schema_migrations SET version = 3`)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, m.Check(ctx), ErrSchemaTooNew)
+	_, err = m.Up(ctx)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func TestMigratorDirty(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	m, err := New(db, SQLite, testMigrations)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE schema_migrations SET dirty = true`)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, m.Check(ctx), ErrDirty)
+	_, err = m.Down(ctx)
+	assert.ErrorIs(t, err, ErrDirty)
+}
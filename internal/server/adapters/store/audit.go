@@ -0,0 +1,119 @@
+// Модуль журнала аудита, общий для хранилищ
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// auditLockID - ключ pg_advisory_xact_lock, под которым события журнала аудита добавляются по очереди
+const auditLockID int64 = 0x61756469746c6f67
+
+// Запросы журнала аудита, общие для PostgreSQL и SQLite
+const (
+	auditColumns          = `id, created_at, user_id, action, record_id, ip, user_agent, details, prev_hash, hash`
+	lastAuditHashQuery    = `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`
+	insertAuditEventQuery = `INSERT INTO audit_events
+                             (created_at, user_id, action, record_id, ip, user_agent, details, prev_hash, hash)
+                             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+                             RETURNING id`
+	listAuditEventsQuery = `SELECT ` + auditColumns + ` FROM audit_events
+                            WHERE user_id = $1 AND id < $2
+                            ORDER BY id DESC
+                            LIMIT $3`
+	auditChainQuery = `SELECT ` + auditColumns + ` FROM audit_events
+                       WHERE id > $1
+                       ORDER BY id
+                       LIMIT $2`
+)
+
+// sealAuditEvent - время события и его место в цепочке после события с хэшем prev
+func sealAuditEvent(e *models.AuditEvent, prev string) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prev
+	e.Hash = e.ComputeHash()
+}
+
+// auditBefore - верхняя граница ID для постраничного чтения, 0 - без границы
+func auditBefore(beforeID uint64) int64 {
+	if beforeID == 0 || beforeID > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(beforeID)
+}
+
+// resultRows - строки результата pgx или database/sql
+type resultRows interface {
+	rowScanner
+	Next() bool
+	Err() error
+}
+
+// collectAuditEvents - чтение событий из строк результата с колонками auditColumns
+func collectAuditEvents(rows resultRows) ([]models.AuditEvent, error) {
+	events := make([]models.AuditEvent, 0)
+	for rows.Next() {
+		e := models.AuditEvent{}
+		err := rows.Scan(&e.ID, &e.CreatedAt, &e.UserID, &e.Action, &e.RecordID, &e.IP, &e.UserAgent, &e.Details,
+			&e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading audit event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit events: %w", err)
+	}
+	return events, nil
+}
+
+// auditVerifyPageSize - сколько событий читается за раз при проверке цепочки
+const auditVerifyPageSize = 1000
+
+// ErrAuditChainBroken - цепочка журнала аудита нарушена: событие изменено, удалено или вставлено
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+// VerifyAuditChain - проверка цепочки хэшей журнала аудита с первого события.
+// Возвращает количество проверенных событий и последнее из них; при нарушении - ErrAuditChainBroken с ID события.
+// Удаление последних событий цепочка не выявляет, для этого хэш последнего события нужно хранить отдельно.
+func VerifyAuditChain(ctx context.Context, s UserAdmin) (int, *models.AuditEvent, error) {
+	var (
+		last  *models.AuditEvent
+		count int
+	)
+	prev := ""
+	for {
+		afterID := uint64(0)
+		if last != nil {
+			afterID = last.ID
+		}
+		events, err := s.AuditChain(ctx, afterID, auditVerifyPageSize)
+		if err != nil {
+			return count, last, err
+		}
+		for i := range events {
+			e := &events[i]
+			if e.PrevHash != prev {
+				return count, last, fmt.Errorf("%w: event %d does not follow the previous event", ErrAuditChainBroken,
+					e.ID)
+			}
+			if e.ComputeHash() != e.Hash {
+				return count, last, fmt.Errorf("%w: event %d was modified", ErrAuditChainBroken, e.ID)
+			}
+			prev = e.Hash
+			last = e
+			count++
+		}
+		if len(events) < auditVerifyPageSize {
+			return count, last, nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore_AuditChain(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "audit.db"), nil)
+
+	count, last, err := VerifyAuditChain(ctx, s)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Nil(t, last)
+
+	for i, action := range []string{models.AuditLoginSuccess, models.AuditRecordCreate, models.AuditRecordRead} {
+		e := &models.AuditEvent{UserID: 1, Action: action, RecordID: uint64(i), IP: "127.0.0.1", UserAgent: "test"}
+		require.NoError(t, s.AppendAuditEvent(ctx, e))
+	}
+	count, last, err = VerifyAuditChain(ctx, s)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, uint64(3), last.ID)
+
+	events, err := s.ListAuditEvents(ctx, 1, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.AuditRecordCreate, events[0].Action)
+
+	_, err = s.conn.ExecContext(ctx, `UPDATE audit_events SET details = 'x' WHERE id = 2`)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = s.conn.ExecContext(ctx, `DELETE FROM audit_events WHERE id = 2`)
+	assert.ErrorContains(t, err, "append-only")
+
+	_, err = s.conn.ExecContext(ctx, `DROP TRIGGER audit_events_no_update`)
+	require.NoError(t, err)
+	_, err = s.conn.ExecContext(ctx, `UPDATE audit_events SET ip = '10.0.0.1' WHERE id = 2`)
+	require.NoError(t, err)
+	count, last, err = VerifyAuditChain(ctx, s)
+	assert.ErrorIs(t, err, ErrAuditChainBroken)
+	assert.ErrorContains(t, err, "event 2")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, uint64(1), last.ID)
+}
@@ -0,0 +1,184 @@
+// Модуль изменений записей для синхронизации, общий для хранилищ
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// Запросы записей и их изменений, общие для PostgreSQL и SQLite.
+// Каждое изменение записей получает следующий номер из users.change_seq. UPDATE блокирует строку пользователя
+// до конца транзакции, поэтому изменения одного пользователя фиксируются строго по возрастанию номеров:
+// все номера не больше прочитанного change_seq уже видны читателям.
+const (
+	nextChangeQuery = `UPDATE users SET change_seq = change_seq + 1 WHERE id = $1 RETURNING change_seq`
+	// lastChangeQuery - последний номер изменения и наибольший номер удаленного следа удаления (см. PurgeTombstones)
+	lastChangeQuery = `SELECT change_seq, tombstones_purged_seq FROM users WHERE id = $1`
+	recordColumns   = `id, uploaded_at, type, checksum, data, filepath, name, user_id, key, version`
+	// recordByName - условие поиска записи по названию: слепой индекс или открытое название старых записей
+	recordByName          = `user_id=$1 AND (name_index=$2 OR (name_index IS NULL AND name=$3))`
+	insertDataRecordQuery = `INSERT INTO data_records
+                             (uploaded_at, type, checksum, data, filepath, name, user_id, key, name_index, size,
+                              version, created_version)
+                             VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$11)
+                             RETURNING id`
+	// updateDataRecordQuery и deleteDataRecordQuery меняют запись, только если ее версия совпадает с ожидаемой
+	// (последний параметр), 0 - без условия
+	updateDataRecordQuery = `UPDATE data_records
+                             SET uploaded_at=$4, type=$5, checksum=$6, data=$7, filepath=$8, name=$9, key=$10,
+                                 name_index=$11, size=$12, version=$13
+                             WHERE ` + recordByName + ` AND (CAST($14 AS BIGINT) = 0 OR version = CAST($14 AS BIGINT))
+                             RETURNING id`
+	// legacyNameQuery - есть ли запись с открытым названием, сохраненная до включения шифрования
+	legacyNameQuery       = `SELECT EXISTS (SELECT 1 FROM data_records WHERE user_id=$1 AND name_index IS NULL AND name=$2)`
+	deleteDataRecordQuery = `DELETE FROM data_records
+                             WHERE ` + recordByName + ` AND (CAST($4 AS BIGINT) = 0 OR version = CAST($4 AS BIGINT))
+                             RETURNING id, type, name`
+	recordExistsQuery    = `SELECT EXISTS (SELECT 1 FROM data_records WHERE ` + recordByName + `)`
+	insertTombstoneQuery = `INSERT INTO record_tombstones (record_id, user_id, type, name, version, deleted_at)
+                            VALUES ($1, $2, $3, $4, $5, $6)`
+	changedRecordsQuery = `SELECT ` + recordColumns + `, created_version FROM data_records
+                           WHERE user_id = $1 AND version > $2 AND version <= $3
+                           ORDER BY version
+                           LIMIT $4`
+	tombstonesQuery = `SELECT record_id, user_id, type, name, version, deleted_at FROM record_tombstones
+                       WHERE user_id = $1 AND version > $2 AND version <= $3
+                       ORDER BY version
+                       LIMIT $4`
+	// markPurgedTombstonesQuery - запоминает у пользователя наибольший номер следов удаления, созданных до $1,
+	// перед их удалением purgeTombstonesQuery
+	markPurgedTombstonesQuery = `UPDATE users SET tombstones_purged_seq = (
+                                     SELECT MAX(version) FROM record_tombstones t
+                                     WHERE t.user_id = users.id AND t.deleted_at < $1)
+                                 WHERE EXISTS (SELECT 1 FROM record_tombstones t
+                                               WHERE t.user_id = users.id AND t.deleted_at < $1
+                                                 AND t.version > users.tombstones_purged_seq)`
+	purgeTombstonesQuery = `DELETE FROM record_tombstones WHERE deleted_at < $1`
+)
+
+// changedRecord - запись из changedRecordsQuery с номером изменения, которым она создана
+type changedRecord struct {
+	models.DataRecord
+	createdVersion uint64
+}
+
+// scanRecord - чтение записи из строки с колонками recordColumns и дополнительными колонками extra
+func scanRecord(row rowScanner, extra ...any) (*models.DataRecord, error) {
+	r := models.DataRecord{}
+	dest := append([]any{&r.ID, &r.UploadedAt, &r.Type, &r.Checksum, &r.Data, &r.FilePath, &r.Name, &r.UserID,
+		&r.Key, &r.Version}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// legacyNameConflict - ErrConflict, если название новой записи занято записью, сохраненной открытой до включения
+// шифрования: у нее нет слепого индекса, и поиск по названию (recordByName) нашел бы обе записи.
+// row - результат legacyNameQuery; без ключа данных проверка не нужна, все названия открытые.
+func legacyNameConflict(row rowScanner) error {
+	var taken bool
+	if err := row.Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("record name is taken by a record saved before encryption: %w", ErrConflict)
+	}
+	return nil
+}
+
+// versionConflict - причина, по которой условное изменение не нашло запись: ErrVersionMismatch, если запись
+// есть (row - результат recordExistsQuery), иначе исходная ошибка err
+func versionConflict(row rowScanner, err error) error {
+	var exists bool
+	if scanErr := row.Scan(&exists); scanErr != nil {
+		return scanErr
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return err
+}
+
+// collectChangedRecords - расшифрованные записи из строк changedRecordsQuery
+func collectChangedRecords(rows resultRows, dek []byte) ([]changedRecord, error) {
+	records := make([]changedRecord, 0)
+	for rows.Next() {
+		var created uint64
+		r, err := scanRecord(rows, &created)
+		if err != nil {
+			return nil, fmt.Errorf("error reading changed record: %w", err)
+		}
+		if err := openRecord(dek, r); err != nil {
+			return nil, err
+		}
+		records = append(records, changedRecord{DataRecord: *r, createdVersion: created})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading changed records: %w", err)
+	}
+	return records, nil
+}
+
+// collectTombstones - расшифрованные следы удаления из строк tombstonesQuery
+func collectTombstones(rows resultRows, dek []byte) ([]models.RecordTombstone, error) {
+	tombstones := make([]models.RecordTombstone, 0)
+	for rows.Next() {
+		t := models.RecordTombstone{}
+		if err := rows.Scan(&t.RecordID, &t.UserID, &t.Type, &t.Name, &t.Version, &t.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error reading tombstone: %w", err)
+		}
+		if err := openTombstone(dek, &t); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tombstones: %w", err)
+	}
+	return tombstones, nil
+}
+
+// mergeRecordChanges - страница изменений после since из записей и следов удаления по возрастанию номера.
+// Обе выборки должны быть ограничены limit+1 строками: тогда первые limit изменений объединения точны,
+// а лишнее означает, что есть следующая страница. last - последний номер изменения пользователя.
+func mergeRecordChanges(records []changedRecord, tombstones []models.RecordTombstone, since, last uint64,
+	limit int) *models.RecordChanges {
+	changes := make([]models.RecordChange, 0, len(records)+len(tombstones))
+	for _, r := range records {
+		op := models.ChangeUpdated
+		if r.createdVersion > since {
+			op = models.ChangeCreated
+		}
+		changes = append(changes, models.RecordChange{Version: r.Version, Op: op, Record: r.DataRecord})
+	}
+	for i := range tombstones {
+		changes = append(changes, tombstones[i].Change())
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Version < changes[j].Version
+	})
+	result := &models.RecordChanges{Changes: changes, Cursor: last}
+	if len(changes) > limit {
+		result.Changes = changes[:limit]
+		result.Cursor = changes[limit-1].Version
+		result.More = true
+	}
+	return result
+}
+
+// checkCursor - курсор клиента не может опережать последний номер изменения: такое бывает после
+// восстановления базы из резервной копии. Курсор старше удаленных следов удаления (purged - наибольший номер
+// удаленного следа) тоже устарел: клиент не узнает об удалении записей. В обоих случаях клиенту нужна
+// полная синхронизация, курсор 0 подходит всегда.
+func checkCursor(since, last, purged uint64) error {
+	if since > last {
+		return fmt.Errorf("cursor %d is ahead of change %d: %w", since, last, ErrStaleCursor)
+	}
+	if since > 0 && since < purged {
+		return fmt.Errorf("cursor %d is older than purged deletions up to change %d: %w", since, purged, ErrStaleCursor)
+	}
+	return nil
+}
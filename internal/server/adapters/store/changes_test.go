@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeRecordChanges(t *testing.T) {
+	records := []changedRecord{
+		{DataRecord: models.DataRecord{ID: 1, Name: "old", Version: 4}, createdVersion: 1},
+		{DataRecord: models.DataRecord{ID: 3, Name: "new", Version: 6}, createdVersion: 6},
+	}
+	tombstones := []models.RecordTombstone{{RecordID: 2, Name: "gone", Version: 5, DeletedAt: time.Now()}}
+
+	page := mergeRecordChanges(records, tombstones, 3, 7, 10)
+	require.Len(t, page.Changes, 3)
+	assert.Equal(t, []string{models.ChangeUpdated, models.ChangeDeleted, models.ChangeCreated},
+		[]string{page.Changes[0].Op, page.Changes[1].Op, page.Changes[2].Op})
+	assert.Equal(t, uint64(7), page.Cursor, "cursor moves past changes of other kinds")
+	assert.False(t, page.More)
+
+	page = mergeRecordChanges(records, tombstones, 3, 7, 2)
+	require.Len(t, page.Changes, 2)
+	assert.Equal(t, uint64(5), page.Cursor)
+	assert.True(t, page.More)
+	assert.Equal(t, "gone", page.Changes[1].Record.Name)
+	assert.NotNil(t, page.Changes[1].DeletedAt)
+}
+
+func TestSQLiteStore_RecordChanges(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "changes.db"), newTestKEK(t))
+	userID, err := s.CreateUser(ctx, &models.User{Login: "user", Password: "password"})
+	require.NoError(t, err)
+
+	for _, name := range []string{"first", "second"} {
+		r := &models.DataRecord{UploadedAt: time.Now(), Type: models.TEXT, Name: name, Data: "a:b", UserID: userID}
+		require.NoError(t, s.PutDataRecord(ctx, r))
+	}
+	updated := &models.DataRecord{UploadedAt: time.Now(), Type: models.TEXT, Name: "first", Data: "c:d", UserID: userID}
+	require.NoError(t, s.UpdateDataRecord(ctx, updated, 1))
+	assert.Equal(t, uint64(3), updated.Version)
+	_, err = s.DeleteDataRecord(ctx, userID, "second", 1)
+	assert.ErrorIs(t, err, ErrVersionMismatch, "record was saved with version 2")
+	tombstone, err := s.DeleteDataRecord(ctx, userID, "second", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "second", tombstone.Name)
+	assert.Equal(t, uint64(4), tombstone.Version)
+
+	_, err = s.DeleteDataRecord(ctx, userID, "second", 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+	err = s.UpdateDataRecord(ctx, &models.DataRecord{Type: models.TEXT, Name: "second", UserID: userID}, 4)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	var sealedName string
+	require.NoError(t, s.conn.QueryRowContext(ctx, `SELECT name FROM record_tombstones`).Scan(&sealedName))
+	assert.NotEqual(t, "second", sealedName)
+
+	page, err := s.GetRecordChanges(ctx, userID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Changes, 2)
+	assert.Equal(t, models.ChangeUpdated, page.Changes[0].Op)
+	assert.Equal(t, "c:d", page.Changes[0].Record.Data)
+	assert.Equal(t, models.ChangeDeleted, page.Changes[1].Op)
+	assert.Equal(t, "second", page.Changes[1].Record.Name)
+	assert.Equal(t, uint64(4), page.Cursor)
+
+	_, err = s.GetRecordChanges(ctx, userID, 5, 10)
+	assert.ErrorIs(t, err, ErrStaleCursor)
+}
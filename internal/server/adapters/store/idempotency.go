@@ -0,0 +1,42 @@
+// Модуль ключей идемпотентности создания записей, общий для хранилищ
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// Запросы ключей идемпотентности, общие для PostgreSQL и SQLite.
+// Ключ проверяется и сохраняется в транзакции change после блокировки строки пользователя,
+// поэтому одновременные повторы одного запроса выполняются по очереди и второй видит ключ первого.
+const (
+	idempotencyKeyQuery = `SELECT user_id, key, request_hash, record_id, created_at FROM idempotency_keys
+                           WHERE user_id = $1 AND key = $2`
+	insertIdempotencyKeyQuery = `INSERT INTO idempotency_keys (user_id, key, request_hash, record_id, created_at)
+                                 VALUES ($1, $2, $3, $4, $5)`
+	recordByIDQuery           = `SELECT ` + recordColumns + ` FROM data_records WHERE user_id = $1 AND id = $2`
+	purgeIdempotencyKeysQuery = `DELETE FROM idempotency_keys WHERE created_at < $1`
+)
+
+// errKeyUsed - ключ уже использован: транзакция откатывается, чтобы не занимать номер изменения
+var errKeyUsed = errors.New("idempotency key already used")
+
+// scanIdempotencyKey - чтение ключа из строки idempotencyKeyQuery
+func scanIdempotencyKey(row rowScanner) (*models.IdempotencyKey, error) {
+	k := models.IdempotencyKey{}
+	if err := row.Scan(&k.UserID, &k.Key, &k.RequestHash, &k.RecordID, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// checkReplay - повтор запроса с ключом k, которым уже создана запись used: содержимое запроса должно совпадать
+func checkReplay(k, used *models.IdempotencyKey) error {
+	if k.RequestHash != used.RequestHash {
+		return fmt.Errorf("idempotency key %q: %w", k.Key, ErrIdempotencyMismatch)
+	}
+	*k = *used
+	return nil
+}
@@ -0,0 +1,677 @@
+// Модуль хранилища в памяти
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// MemoryStore - потокобезопасное хранилище данных в памяти.
+// Используется в тестах и в режиме разработки (--dev), данные теряются при остановке сервера.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	users   map[string]models.User
+	records map[uint64][]models.DataRecord
+	// changeSeq - последний номер изменения записей пользователя, created - номер создания записи по ее ID
+	changeSeq  map[uint64]uint64
+	created    map[uint64]uint64
+	tombstones map[uint64][]models.RecordTombstone
+	// purgedSeq - наибольший номер удаленного следа удаления пользователя
+	purgedSeq map[uint64]uint64
+	// idempotencyKeys - ключи идемпотентности пользователей по ID пользователя и ключу
+	idempotencyKeys map[uint64]map[string]models.IdempotencyKey
+	devices         map[string]models.Device
+	quotas          map[uint64]models.QuotaOverride
+	audit           []models.AuditEvent
+	webhooks        map[uint64]models.Webhook
+	deliveries      []models.WebhookDelivery
+	lastUserID      uint64
+	lastRecordID    uint64
+	lastDeviceID    uint64
+	// lastWebhookID - ID последнего вебхука, ID доставок - позиция в deliveries + 1
+	lastWebhookID uint64
+}
+
+// NewMemoryStore - создание хранилища в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:           make(map[string]models.User),
+		records:         make(map[uint64][]models.DataRecord),
+		changeSeq:       make(map[uint64]uint64),
+		created:         make(map[uint64]uint64),
+		tombstones:      make(map[uint64][]models.RecordTombstone),
+		purgedSeq:       make(map[uint64]uint64),
+		idempotencyKeys: make(map[uint64]map[string]models.IdempotencyKey),
+		devices:         make(map[string]models.Device),
+		quotas:          make(map[uint64]models.QuotaOverride),
+		webhooks:        make(map[uint64]models.Webhook),
+	}
+}
+
+// Ping - хранилище в памяти всегда доступно
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close - хранилищу в памяти нечего освобождать
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// CreateUser - создание пользователя
+func (m *MemoryStore) CreateUser(ctx context.Context, u *models.User) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.Login]; ok {
+		return 0, fmt.Errorf("error saving user %q: %w", u.Login, ErrConflict)
+	}
+	m.lastUserID++
+	u.ID = m.lastUserID
+	m.users[u.Login] = models.User{
+		ID:       u.ID,
+		Login:    u.Login,
+		Password: hashPassword(u.Password),
+	}
+	return u.ID, nil
+}
+
+// GetUser - получение пользователя
+func (m *MemoryStore) GetUser(ctx context.Context, u *models.User) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[u.Login]
+	if !ok {
+		return nil, fmt.Errorf("error user %q not found: %w", u.Login, ErrNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByID - получение пользователя по ID
+func (m *MemoryStore) GetUserByID(ctx context.Context, userID uint64) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, user := range m.users {
+		if user.ID == userID {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("error user %d not found: %w", userID, ErrNotFound)
+}
+
+// RecordLogin - сохранение времени последнего входа
+func (m *MemoryStore) RecordLogin(ctx context.Context, userID uint64) error {
+	return m.updateUser(ctx, userID, func(u *models.User) {
+		now := time.Now().UTC()
+		u.LastLoginAt = &now
+	})
+}
+
+// ListUsers - пользователи с количеством и объемом записей
+func (m *MemoryStore) ListUsers(ctx context.Context) ([]models.UserStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]models.UserStats, 0, len(m.users))
+	for _, user := range m.users {
+		stats := models.UserStats{User: user, Records: len(m.records[user.ID])}
+		for _, r := range m.records[user.ID] {
+			stats.DataSize += int64(len(r.Data))
+		}
+		users = append(users, stats)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// GetUsage - количество и суммарный размер записей пользователя
+func (m *MemoryStore) GetUsage(ctx context.Context, userID uint64) (*models.Usage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u := models.Usage{Records: int64(len(m.records[userID]))}
+	for _, r := range m.records[userID] {
+		u.Bytes += int64(len(r.Data))
+	}
+	return &u, nil
+}
+
+// GetQuotaOverride - квоты, заданные пользователю администратором
+func (m *MemoryStore) GetQuotaOverride(ctx context.Context, userID uint64) (*models.QuotaOverride, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	o := m.quotas[userID]
+	return &o, nil
+}
+
+// SetQuotaOverride - квоты пользователя
+func (m *MemoryStore) SetQuotaOverride(ctx context.Context, userID uint64, o *models.QuotaOverride) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if o.IsEmpty() {
+		delete(m.quotas, userID)
+		return nil
+	}
+	m.quotas[userID] = *o
+	return nil
+}
+
+// AppendAuditEvent - добавление события в журнал аудита
+func (m *MemoryStore) AppendAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := ""
+	if n := len(m.audit); n > 0 {
+		prev = m.audit[n-1].Hash
+	}
+	sealAuditEvent(e, prev)
+	e.ID = uint64(len(m.audit)) + 1
+	m.audit = append(m.audit, *e)
+	return nil
+}
+
+// ListAuditEvents - события пользователя с ID меньше beforeID (0 - с последнего) от новых к старым
+func (m *MemoryStore) ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]models.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := make([]models.AuditEvent, 0)
+	for i := len(m.audit) - 1; i >= 0 && len(events) < limit; i-- {
+		e := m.audit[i]
+		if e.UserID == userID && (beforeID == 0 || e.ID < beforeID) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// AuditChain - события журнала по возрастанию ID для проверки цепочки
+func (m *MemoryStore) AuditChain(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := make([]models.AuditEvent, 0)
+	for _, e := range m.audit {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// SetUserDisabled - блокировка или разблокировка учетной записи
+func (m *MemoryStore) SetUserDisabled(ctx context.Context, userID uint64, disabled bool) error {
+	return m.updateUser(ctx, userID, func(u *models.User) {
+		u.DisabledAt = disabledAt(disabled)
+	})
+}
+
+// RevokeSessions - принудительный выход пользователя
+func (m *MemoryStore) RevokeSessions(ctx context.Context, userID uint64) error {
+	return m.updateUser(ctx, userID, func(u *models.User) {
+		now := time.Now().UTC()
+		u.SessionsRevokedAt = &now
+	})
+}
+
+// SetPassword - замена пароля пользователя администратором с требованием сменить его при входе
+func (m *MemoryStore) SetPassword(ctx context.Context, userID uint64, password string) error {
+	return m.updateUser(ctx, userID, func(u *models.User) {
+		u.Password = hashPassword(password)
+		u.MustChangePassword = true
+	})
+}
+
+// ChangePassword - замена пароля самим пользователем
+func (m *MemoryStore) ChangePassword(ctx context.Context, userID uint64, password string) error {
+	return m.updateUser(ctx, userID, func(u *models.User) {
+		u.Password = hashPassword(password)
+		u.MustChangePassword = false
+	})
+}
+
+// updateUser - изменение пользователя с ID userID
+func (m *MemoryStore) updateUser(ctx context.Context, userID uint64, update func(u *models.User)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for login, user := range m.users {
+		if user.ID == userID {
+			update(&user)
+			m.users[login] = user
+			return nil
+		}
+	}
+	return fmt.Errorf("error updating user %d: %w", userID, ErrNotFound)
+}
+
+// PutDataRecord - сохранение данных
+func (m *MemoryStore) PutDataRecord(ctx context.Context, data *models.DataRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.records[data.UserID] {
+		if r.Name == data.Name {
+			return fmt.Errorf("error saving data %q: %w", data.Name, ErrConflict)
+		}
+	}
+	m.putRecord(data)
+	return nil
+}
+
+// putRecord - добавление новой записи, вызывается под m.mu
+func (m *MemoryStore) putRecord(data *models.DataRecord) {
+	m.lastRecordID++
+	data.ID = m.lastRecordID
+	data.Version = m.nextChange(data.UserID)
+	m.created[data.ID] = data.Version
+	m.records[data.UserID] = append(m.records[data.UserID], *data)
+}
+
+// GetIdempotencyKey - ключ идемпотентности пользователя
+func (m *MemoryStore) GetIdempotencyKey(ctx context.Context, userID uint64, key string) (*models.IdempotencyKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.idempotencyKeys[userID][key]
+	if !ok {
+		return nil, fmt.Errorf("error getting idempotency key: %w", ErrNotFound)
+	}
+	return &k, nil
+}
+
+// PutDataRecordOnce - сохранение записи с ключом идемпотентности
+func (m *MemoryStore) PutDataRecordOnce(ctx context.Context, data *models.DataRecord, k *models.IdempotencyKey) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if used, ok := m.idempotencyKeys[data.UserID][k.Key]; ok {
+		if err := checkReplay(k, &used); err != nil {
+			return true, err
+		}
+		for _, r := range m.records[data.UserID] {
+			if r.ID == used.RecordID {
+				*data = r
+				return true, nil
+			}
+		}
+		return true, fmt.Errorf("error getting record %d: %w", used.RecordID, ErrNotFound)
+	}
+	for _, r := range m.records[data.UserID] {
+		if r.Name == data.Name {
+			return false, fmt.Errorf("error saving data %q: %w", data.Name, ErrConflict)
+		}
+	}
+	m.putRecord(data)
+	k.UserID, k.RecordID = data.UserID, data.ID
+	if m.idempotencyKeys[data.UserID] == nil {
+		m.idempotencyKeys[data.UserID] = make(map[string]models.IdempotencyKey)
+	}
+	m.idempotencyKeys[data.UserID][k.Key] = *k
+	return false, nil
+}
+
+// PurgeIdempotencyKeys - удаление ключей идемпотентности, сохраненных до before
+func (m *MemoryStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, keys := range m.idempotencyKeys {
+		for key, k := range keys {
+			if k.CreatedAt.Before(before) {
+				delete(keys, key)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// UpdateDataRecord - замена содержимого записи по названию
+func (m *MemoryStore) UpdateDataRecord(ctx context.Context, data *models.DataRecord, ifVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records := m.records[data.UserID]
+	for i := range records {
+		if records[i].Name == data.Name {
+			if ifVersion != 0 && records[i].Version != ifVersion {
+				return fmt.Errorf("error updating record %q: %w", data.Name, ErrVersionMismatch)
+			}
+			data.ID = records[i].ID
+			data.Version = m.nextChange(data.UserID)
+			records[i] = *data
+			return nil
+		}
+	}
+	return fmt.Errorf("error updating record %q: %w", data.Name, ErrNotFound)
+}
+
+// DeleteDataRecord - удаление записи по названию
+func (m *MemoryStore) DeleteDataRecord(ctx context.Context, userID uint64, name string,
+	ifVersion uint64) (*models.RecordTombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records := m.records[userID]
+	for i, r := range records {
+		if r.Name != name {
+			continue
+		}
+		if ifVersion != 0 && r.Version != ifVersion {
+			return nil, fmt.Errorf("error deleting record %q: %w", name, ErrVersionMismatch)
+		}
+		m.records[userID] = append(records[:i:i], records[i+1:]...)
+		delete(m.created, r.ID)
+		t := models.RecordTombstone{
+			RecordID:  r.ID,
+			UserID:    userID,
+			Type:      r.Type,
+			Name:      r.Name,
+			Version:   m.nextChange(userID),
+			DeletedAt: time.Now().UTC(),
+		}
+		m.tombstones[userID] = append(m.tombstones[userID], t)
+		return &t, nil
+	}
+	return nil, fmt.Errorf("error deleting record %q: %w", name, ErrNotFound)
+}
+
+// GetRecordChanges - изменения записей пользователя после номера since
+func (m *MemoryStore) GetRecordChanges(ctx context.Context, userID, since uint64, limit int) (*models.RecordChanges, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	last := m.changeSeq[userID]
+	if err := checkCursor(since, last, m.purgedSeq[userID]); err != nil {
+		return nil, err
+	}
+	records := make([]changedRecord, 0)
+	for _, r := range m.records[userID] {
+		if r.Version > since {
+			records = append(records, changedRecord{DataRecord: r, createdVersion: m.created[r.ID]})
+		}
+	}
+	tombstones := make([]models.RecordTombstone, 0)
+	for _, t := range m.tombstones[userID] {
+		if t.Version > since {
+			tombstones = append(tombstones, t)
+		}
+	}
+	return mergeRecordChanges(records, tombstones, since, last, limit), nil
+}
+
+// PurgeTombstones - удаление следов удаления, созданных до before
+func (m *MemoryStore) PurgeTombstones(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for userID, tombstones := range m.tombstones {
+		kept := tombstones[:0]
+		for _, t := range tombstones {
+			if !t.DeletedAt.Before(before) {
+				kept = append(kept, t)
+				continue
+			}
+			m.purgedSeq[userID] = max(m.purgedSeq[userID], t.Version)
+			n++
+		}
+		m.tombstones[userID] = kept
+	}
+	return n, nil
+}
+
+// nextChange - следующий номер изменения записей пользователя под m.mu
+func (m *MemoryStore) nextChange(userID uint64) uint64 {
+	m.changeSeq[userID]++
+	return m.changeSeq[userID]
+}
+
+// GetUserRecord - получение данных по названию записи и ID пользователя
+func (m *MemoryStore) GetUserRecord(ctx context.Context, recordName string, userID uint64) (*models.DataRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.records[userID] {
+		if r.Name == recordName {
+			record := r
+			return &record, nil
+		}
+	}
+	return nil, fmt.Errorf("error getting record %q: %w", recordName, ErrNotFound)
+}
+
+// GetUserRecords - получение всех записей пользователя
+func (m *MemoryStore) GetUserRecords(ctx context.Context, userID uint64) ([]models.DataRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.records[userID]) == 0 {
+		return nil, models.ErrNoData
+	}
+	records := make([]models.DataRecord, len(m.records[userID]))
+	copy(records, m.records[userID])
+	return records, nil
+}
+
+// CreateDevice - регистрация устройства пользователя
+func (m *MemoryStore) CreateDevice(ctx context.Context, d *models.Device) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.devices[d.Fingerprint]; ok {
+		return fmt.Errorf("error saving device %q: %w", d.Name, ErrConflict)
+	}
+	m.lastDeviceID++
+	d.ID = m.lastDeviceID
+	d.CreatedAt = time.Now().UTC()
+	m.devices[d.Fingerprint] = *d
+	return nil
+}
+
+// GetDevice - получение устройства по отпечатку сертификата
+func (m *MemoryStore) GetDevice(ctx context.Context, fingerprint string) (*models.Device, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.devices[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("error getting device: %w", ErrNotFound)
+	}
+	return &d, nil
+}
+
+// CreateWebhook - создание вебхука пользователя
+func (m *MemoryStore) CreateWebhook(ctx context.Context, w *models.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastWebhookID++
+	w.ID = m.lastWebhookID
+	w.CreatedAt = time.Now().UTC()
+	m.webhooks[w.ID] = *w
+	return nil
+}
+
+// ListWebhooks - вебхуки пользователя
+func (m *MemoryStore) ListWebhooks(ctx context.Context, userID uint64) ([]models.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	webhooks := make([]models.Webhook, 0)
+	for _, w := range m.webhooks {
+		if w.UserID == userID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+// GetWebhook - вебхук пользователя по ID
+func (m *MemoryStore) GetWebhook(ctx context.Context, userID, id uint64) (*models.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w, ok := m.webhooks[id]
+	if !ok || w.UserID != userID {
+		return nil, fmt.Errorf("error getting webhook: %w", ErrNotFound)
+	}
+	return &w, nil
+}
+
+// DeleteWebhook - удаление вебхука пользователя вместе с неотправленными событиями
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, userID, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.webhooks[id]
+	if !ok || w.UserID != userID {
+		return fmt.Errorf("error deleting webhook: %w", ErrNotFound)
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+// EnqueueWebhookEvent - постановка события в очередь доставки подписанных на него вебхуков пользователя
+func (m *MemoryStore) EnqueueWebhookEvent(ctx context.Context, userID uint64, event, payload string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]uint64, 0)
+	for id, w := range m.webhooks {
+		if w.UserID == userID && w.Matches(event) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	now := time.Now().UTC()
+	for _, id := range ids {
+		m.deliveries = append(m.deliveries, models.WebhookDelivery{
+			ID:            uint64(len(m.deliveries)) + 1,
+			WebhookID:     id,
+			Event:         event,
+			Payload:       payload,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	return int64(len(ids)), nil
+}
+
+// ClaimWebhookDeliveries - выбор доставок к отправке и откладывание их на lease.
+// Доставки удаленных вебхуков пропускаются.
+func (m *MemoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := make([]models.WebhookDelivery, 0)
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		w, ok := m.webhooks[d.WebhookID]
+		if !ok || d.DeliveredAt != nil || d.FailedAt != nil || d.NextAttemptAt.After(now) || len(deliveries) >= limit {
+			continue
+		}
+		d.NextAttemptAt = now.Add(lease).UTC()
+		claimed := *d
+		claimed.URL, claimed.Secret, claimed.UserID = w.URL, w.Secret, w.UserID
+		deliveries = append(deliveries, claimed)
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery - сохранение результата попытки доставки
+func (m *MemoryStore) UpdateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d.ID == 0 || d.ID > uint64(len(m.deliveries)) {
+		return fmt.Errorf("error updating webhook delivery: %w", ErrNotFound)
+	}
+	stored := &m.deliveries[d.ID-1]
+	stored.Attempts, stored.NextAttemptAt = d.Attempts, d.NextAttemptAt
+	stored.LastStatus, stored.LastError = d.LastStatus, d.LastError
+	stored.DeliveredAt, stored.FailedAt = d.DeliveredAt, d.FailedAt
+	return nil
+}
+
+// PurgeWebhookDeliveries - завершенные доставки в памяти не удаляются: их ID - позиция в очереди
+func (m *MemoryStore) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return 0, ctx.Err()
+}
@@ -0,0 +1,216 @@
+// Модуль шифрования записей на стороне хранилища
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/envelope"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// KeyRotator - хранилище, которое умеет переобернуть ключи данных пользователей новым KEK.
+// Сами записи при этом не перешифровываются.
+type KeyRotator interface {
+	RewrapDataKeys(ctx context.Context, newKEK *envelope.KEK) (int, error)
+}
+
+// wrappedKey - обернутый ключ данных пользователя из таблицы user_keys
+type wrappedKey struct {
+	userID  uint64
+	kekID   string
+	wrapped []byte
+}
+
+// loadOrCreateDataKey - получение ключа данных пользователя. Если ключа еще нет, он создается
+// и сохраняется обернутым; insert не должен падать, если ключ параллельно создал другой запрос
+// (ON CONFLICT DO NOTHING), поэтому после вставки ключ перечитывается.
+func loadOrCreateDataKey(
+	kek *envelope.KEK,
+	load func() (*wrappedKey, error),
+	insert func(kekID string, wrapped []byte) error,
+) ([]byte, error) {
+	if kek == nil {
+		return nil, nil
+	}
+	key, err := load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading data key: %w", err)
+	}
+	if key == nil {
+		dek, err := envelope.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := kek.Wrap(dek)
+		if err != nil {
+			return nil, fmt.Errorf("error wrapping data key: %w", err)
+		}
+		if err := insert(kek.ID(), wrapped); err != nil {
+			return nil, fmt.Errorf("error saving data key: %w", err)
+		}
+		if key, err = load(); err != nil || key == nil {
+			return nil, fmt.Errorf("error loading data key: %w", err)
+		}
+	}
+	return kek.Unwrap(key.wrapped)
+}
+
+// rewrap - переобертывание ключа данных из старого KEK в новый
+func rewrap(oldKEK, newKEK *envelope.KEK, key *wrappedKey) ([]byte, error) {
+	if oldKEK == nil {
+		return nil, fmt.Errorf("current KEK is not configured")
+	}
+	dek, err := oldKEK.Unwrap(key.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key of user %d: %w", key.userID, err)
+	}
+	return newKEK.Wrap(dek)
+}
+
+// sealedRecord - значения колонок записи для сохранения в базу
+type sealedRecord struct {
+	Type      string
+	Checksum  string
+	Data      string
+	FilePath  string
+	Name      string
+	Key       string
+	NameIndex *string
+}
+
+// recordAAD - дополнительные данные шифрования колонки: владелец и имя колонки
+func recordAAD(userID uint64, column string) string {
+	return fmt.Sprintf("data_records:%d:%s", userID, column)
+}
+
+// sealRecord - шифрование чувствительных колонок записи. Без ключа данных значения сохраняются открытыми.
+func sealRecord(dek []byte, r *models.DataRecord) (*sealedRecord, error) {
+	s := &sealedRecord{
+		Type:     string(r.Type),
+		Checksum: r.Checksum,
+		Data:     r.Data,
+		FilePath: r.FilePath,
+		Name:     r.Name,
+		Key:      r.Key,
+	}
+	if dek == nil {
+		return s, nil
+	}
+	columns := []struct {
+		name  string
+		value *string
+	}{
+		{"type", &s.Type},
+		{"checksum", &s.Checksum},
+		{"data", &s.Data},
+		{"filepath", &s.FilePath},
+		{"name", &s.Name},
+		{"key", &s.Key},
+	}
+	for _, c := range columns {
+		sealed, err := envelope.Seal(dek, *c.value, recordAAD(r.UserID, c.name))
+		if err != nil {
+			return nil, fmt.Errorf("error sealing %s: %w", c.name, err)
+		}
+		*c.value = sealed
+	}
+	nameIndex := envelope.BlindIndex(dek, r.Name)
+	s.NameIndex = &nameIndex
+	return s, nil
+}
+
+// openRecord - расшифровка колонок записи, прочитанной из базы
+func openRecord(dek []byte, r *models.DataRecord) error {
+	recordType := string(r.Type)
+	columns := []struct {
+		name  string
+		value *string
+	}{
+		{"type", &recordType},
+		{"checksum", &r.Checksum},
+		{"data", &r.Data},
+		{"filepath", &r.FilePath},
+		{"name", &r.Name},
+		{"key", &r.Key},
+	}
+	for _, c := range columns {
+		opened, err := envelope.Open(dek, *c.value, recordAAD(r.UserID, c.name))
+		if err != nil {
+			return fmt.Errorf("error opening %s of record %d: %w", c.name, r.ID, err)
+		}
+		*c.value = opened
+	}
+	r.Type = models.DataType(recordType)
+	return nil
+}
+
+// openTombstone - расшифровка типа и названия удаленной записи: они переносятся из записи без изменений
+func openTombstone(dek []byte, t *models.RecordTombstone) error {
+	r := models.DataRecord{ID: t.RecordID, UserID: t.UserID, Type: t.Type, Name: t.Name}
+	if err := openRecord(dek, &r); err != nil {
+		return err
+	}
+	t.Type, t.Name = r.Type, r.Name
+	return nil
+}
+
+// webhookSecretAAD - дополнительные данные шифрования секрета вебхука: владелец
+func webhookSecretAAD(userID uint64) string {
+	return fmt.Sprintf("webhooks:%d:secret", userID)
+}
+
+// sealWebhookSecret - шифрование секрета подписи вебхука ключом данных владельца.
+// Без ключа данных секрет сохраняется открытым.
+func sealWebhookSecret(dek []byte, userID uint64, secret string) (string, error) {
+	if dek == nil {
+		return secret, nil
+	}
+	sealed, err := envelope.Seal(dek, secret, webhookSecretAAD(userID))
+	if err != nil {
+		return "", fmt.Errorf("error sealing webhook secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// webhookSecrets - расшифровка секретов вебхуков ключами данных владельцев.
+// Ключ запрашивается один раз на пользователя и только для зашифрованных секретов.
+type webhookSecrets struct {
+	dataKey func(ctx context.Context, userID uint64) ([]byte, error)
+	keys    map[uint64][]byte
+}
+
+// newWebhookSecrets - расшифровка секретов с ключами данных из dataKey
+func newWebhookSecrets(dataKey func(ctx context.Context, userID uint64) ([]byte, error)) *webhookSecrets {
+	return &webhookSecrets{dataKey: dataKey, keys: make(map[uint64][]byte)}
+}
+
+// open - расшифровка секрета вебхука пользователя userID; сохраненный без KEK секрет не меняется
+func (s *webhookSecrets) open(ctx context.Context, userID uint64, secret *string) error {
+	if !envelope.IsSealed(*secret) {
+		return nil
+	}
+	dek, ok := s.keys[userID]
+	if !ok {
+		var err error
+		if dek, err = s.dataKey(ctx, userID); err != nil {
+			return err
+		}
+		s.keys[userID] = dek
+	}
+	opened, err := envelope.Open(dek, *secret, webhookSecretAAD(userID))
+	if err != nil {
+		return fmt.Errorf("error opening webhook secret: %w", err)
+	}
+	*secret = opened
+	return nil
+}
+
+// nameLookup - значения для поиска записи по имени: открытое имя и слепой индекс (если включено шифрование)
+func nameLookup(dek []byte, name string) *string {
+	if dek == nil {
+		return nil
+	}
+	index := envelope.BlindIndex(dek, name)
+	return &index
+}
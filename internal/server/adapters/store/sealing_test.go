@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/envelope"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKEK - случайный KEK для тестов
+func newTestKEK(t *testing.T) *envelope.KEK {
+	t.Helper()
+	key, err := envelope.GenerateKey()
+	require.NoError(t, err)
+	kek, err := envelope.NewKEK(key)
+	require.NoError(t, err)
+	return kek
+}
+
+// openTestSQLite - SQLite во временной директории с примененными миграциями
+func openTestSQLite(t *testing.T, path string, kek *envelope.KEK) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(path, kek)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	m, err := s.Migrator()
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+	return s
+}
+
+func TestSQLiteStore_SealsRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gophkeeper.db")
+	kek := newTestKEK(t)
+	s := openTestSQLite(t, path, kek)
+
+	userID, err := s.CreateUser(ctx, &models.User{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, s.PutDataRecord(ctx, &models.DataRecord{
+		UploadedAt: time.Now(), Type: models.TEXT, Data: "secret", Name: "note", UserID: userID, Key: "k",
+	}))
+
+	var name, data, key string
+	err = s.conn.QueryRowContext(ctx, `SELECT name, data, key FROM data_records WHERE user_id=$1`, userID).
+		Scan(&name, &data, &key)
+	require.NoError(t, err)
+	for _, v := range []string{name, data, key} {
+		assert.True(t, envelope.IsSealed(v), "column stored in plaintext: %q", v)
+	}
+
+	record, err := s.GetUserRecord(ctx, "note", userID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", record.Data)
+	assert.Equal(t, "k", record.Key)
+	assert.Equal(t, models.TEXT, record.Type)
+
+	err = s.PutDataRecord(ctx, &models.DataRecord{UploadedAt: time.Now(), Type: models.TEXT, Name: "note", UserID: userID})
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestSQLiteStore_RewrapDataKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gophkeeper.db")
+	oldKEK, newKEK := newTestKEK(t), newTestKEK(t)
+	s := openTestSQLite(t, path, oldKEK)
+
+	userID, err := s.CreateUser(ctx, &models.User{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, s.PutDataRecord(ctx, &models.DataRecord{
+		UploadedAt: time.Now(), Type: models.TEXT, Data: "secret", Name: "note", UserID: userID,
+	}))
+
+	n, err := s.RewrapDataKeys(ctx, newKEK)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.RewrapDataKeys(ctx, newKEK)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "keys already wrapped with the new KEK are skipped")
+
+	_, err = s.GetUserRecord(ctx, "note", userID)
+	assert.ErrorIs(t, err, envelope.ErrWrongKEK)
+
+	rotated := openTestSQLite(t, path, newKEK)
+	record, err := rotated.GetUserRecord(ctx, "note", userID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", record.Data)
+}
+
+func TestSQLiteStore_ReadsLegacyPlaintext(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gophkeeper.db")
+	plain := openTestSQLite(t, path, nil)
+
+	userID, err := plain.CreateUser(ctx, &models.User{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, plain.PutDataRecord(ctx, &models.DataRecord{
+		UploadedAt: time.Now(), Type: models.TEXT, Data: "legacy", Name: "old", UserID: userID,
+	}))
+
+	s := openTestSQLite(t, path, newTestKEK(t))
+	record, err := s.GetUserRecord(ctx, "old", userID)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", record.Data)
+
+	err = s.PutDataRecord(ctx, &models.DataRecord{UploadedAt: time.Now(), Type: models.TEXT, Data: "new", Name: "old", UserID: userID})
+	assert.ErrorIs(t, err, ErrConflict, "sealed record does not shadow the plaintext one")
+	_, err = s.PutDataRecordOnce(ctx, &models.DataRecord{UploadedAt: time.Now(), Type: models.TEXT, Data: "new", Name: "old", UserID: userID},
+		&models.IdempotencyKey{Key: "k", RequestHash: "h"})
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestSQLiteStore_SealsWebhookSecrets(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gophkeeper.db")
+	plain := openTestSQLite(t, path, nil)
+	userID, err := plain.CreateUser(ctx, &models.User{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	legacy := &models.Webhook{UserID: userID, URL: "https://example.com/old", Secret: "legacy-secret"}
+	require.NoError(t, plain.CreateWebhook(ctx, legacy))
+
+	s := openTestSQLite(t, path, newTestKEK(t))
+	w := &models.Webhook{UserID: userID, URL: "https://example.com/new", Secret: "new-secret"}
+	require.NoError(t, s.CreateWebhook(ctx, w))
+	var secret string
+	require.NoError(t, s.conn.QueryRowContext(ctx, `SELECT secret FROM webhooks WHERE id=$1`, w.ID).Scan(&secret))
+	assert.True(t, envelope.IsSealed(secret), "secret stored in plaintext")
+
+	got, err := s.GetWebhook(ctx, userID, w.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new-secret", got.Secret)
+	list, err := s.ListWebhooks(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "legacy-secret", list[0].Secret, "secret saved without KEK is read as is")
+	assert.Equal(t, "new-secret", list[1].Secret)
+
+	filtered := &models.Webhook{UserID: userID, URL: "https://example.com/logins", Secret: "login-secret",
+		Events: []string{models.WebhookAccountLogin}}
+	require.NoError(t, s.CreateWebhook(ctx, filtered))
+	n, err := s.EnqueueWebhookEvent(ctx, userID, models.WebhookRecordCreated, "{}")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "webhook subscribed to other events is skipped")
+	deliveries, err := s.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "legacy-secret", deliveries[0].Secret)
+	assert.Equal(t, "new-secret", deliveries[1].Secret)
+	assert.Equal(t, userID, deliveries[0].UserID)
+}
@@ -0,0 +1,829 @@
+// Модуль встроенного хранилища SQLite
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/migrator"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/envelope"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/migrations"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// sqliteBusyTimeout - время ожидания блокировки базы другим соединением, мс
+	sqliteBusyTimeout = 5000
+	// sqliteMaxOpenConns - SQLite допускает одного писателя, поэтому пул держим небольшим
+	sqliteMaxOpenConns = 4
+)
+
+// SQLiteStore - хранилище данных во встроенной базе SQLite.
+// Предназначено для однопользовательских и офлайн-установок без PostgreSQL.
+// Шифрование записей на сервере работает так же, как в DBStore.
+type SQLiteStore struct {
+	conn *sql.DB
+	kek  *envelope.KEK
+}
+
+// NewSQLiteStore - открытие базы SQLite по пути к файлу. Схема создается миграциями (см. Migrator).
+// kek может быть nil.
+func NewSQLiteStore(path string, kek *envelope.KEK) (*SQLiteStore, error) {
+	conn, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite database: %w", err)
+	}
+	conn.SetMaxOpenConns(sqliteMaxOpenConns)
+	return &SQLiteStore{conn: conn, kek: kek}, nil
+}
+
+// sqliteDSN - добавляет к пути базы прагмы WAL, busy_timeout и внешних ключей,
+// если они не заданы явно. Прагмы применяются к каждому соединению пула.
+func sqliteDSN(path string) string {
+	base, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		query = url.Values{}
+	}
+	pragmas := strings.Join(query["_pragma"], ",")
+	defaults := []struct{ name, value string }{
+		{"busy_timeout", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout)},
+		{"journal_mode", "journal_mode(WAL)"},
+		{"foreign_keys", "foreign_keys(1)"},
+	}
+	for _, p := range defaults {
+		if !strings.Contains(pragmas, p.name) {
+			query.Add("_pragma", p.value)
+		}
+	}
+	if query.Get("_txlock") == "" {
+		// немедленная блокировка на запись исключает SQLITE_BUSY при повышении уровня блокировки в транзакции
+		query.Set("_txlock", "immediate")
+	}
+	return base + "?" + query.Encode()
+}
+
+// Migrator - мигратор схемы SQLite
+func (s *SQLiteStore) Migrator() (*migrator.Migrator, error) {
+	source, err := fs.Sub(migrations.SQLite, "sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite migrations: %w", err)
+	}
+	return migrator.New(s.conn, migrator.SQLite, source)
+}
+
+// PoolStats - статистика пула для метрик
+func (s *SQLiteStore) PoolStats() PoolStats {
+	st := s.conn.Stats()
+	return PoolStats{
+		MaxConns:      st.MaxOpenConnections,
+		OpenConns:     st.OpenConnections,
+		IdleConns:     st.Idle,
+		InUseConns:    st.InUse,
+		WaitCount:     st.WaitCount,
+		WaitDuration:  st.WaitDuration,
+		MaxIdleClosed: st.MaxIdleClosed,
+	}
+}
+
+// Ping - проверка доступности базы
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// Close - закрытие базы
+func (s *SQLiteStore) Close() error {
+	return s.conn.Close()
+}
+
+// CreateUser - создание пользователя
+func (s *SQLiteStore) CreateUser(ctx context.Context, u *models.User) (uint64, error) {
+	hashedPassword := hashPassword(u.Password)
+	query := `INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id`
+	err := s.conn.QueryRowContext(ctx, query, u.Login, hashedPassword).Scan(&u.ID)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return 0, fmt.Errorf("error saving user to db: %w", ErrConflict)
+		}
+		return 0, fmt.Errorf("error saving user to db: %w", err)
+	}
+	return u.ID, nil
+}
+
+// GetUser - получение пользователя
+func (s *SQLiteStore) GetUser(ctx context.Context, u *models.User) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE login = $1`
+	user, err := scanUser(s.conn.QueryRowContext(ctx, query, u.Login))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error user not found in db: %w", ErrNotFound)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByID - получение пользователя по ID
+func (s *SQLiteStore) GetUserByID(ctx context.Context, userID uint64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(s.conn.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error user %d not found in db: %w", userID, ErrNotFound)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// RecordLogin - сохранение времени последнего входа
+func (s *SQLiteStore) RecordLogin(ctx context.Context, userID uint64) error {
+	return s.updateUser(ctx, `UPDATE users SET last_login_at = $1 WHERE id = $2`, time.Now().UTC(), userID)
+}
+
+// ListUsers - пользователи с количеством и объемом записей
+func (s *SQLiteStore) ListUsers(ctx context.Context) ([]models.UserStats, error) {
+	rows, err := s.conn.QueryContext(ctx, listUsersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+	users := make([]models.UserStats, 0)
+	for rows.Next() {
+		u, err := scanUserStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing users: %w", err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	return users, nil
+}
+
+// GetUsage - количество и суммарный размер записей пользователя
+func (s *SQLiteStore) GetUsage(ctx context.Context, userID uint64) (*models.Usage, error) {
+	u := models.Usage{}
+	err := s.conn.QueryRowContext(ctx, usageQuery, userID).Scan(&u.Records, &u.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error getting usage of user %d: %w", userID, err)
+	}
+	return &u, nil
+}
+
+// GetQuotaOverride - квоты, заданные пользователю администратором
+func (s *SQLiteStore) GetQuotaOverride(ctx context.Context, userID uint64) (*models.QuotaOverride, error) {
+	o := models.QuotaOverride{}
+	err := s.conn.QueryRowContext(ctx, quotaQuery, userID).Scan(&o.MaxRecords, &o.MaxBytes, &o.MaxRecordSize)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting quota of user %d: %w", userID, err)
+	}
+	return &o, nil
+}
+
+// SetQuotaOverride - квоты пользователя
+func (s *SQLiteStore) SetQuotaOverride(ctx context.Context, userID uint64, o *models.QuotaOverride) error {
+	var err error
+	if o.IsEmpty() {
+		_, err = s.conn.ExecContext(ctx, `DELETE FROM user_quotas WHERE user_id = $1`, userID)
+	} else {
+		_, err = s.conn.ExecContext(ctx, upsertQuotaQuery, userID, o.MaxRecords, o.MaxBytes, o.MaxRecordSize)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving quota of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// SetUserDisabled - блокировка или разблокировка учетной записи
+func (s *SQLiteStore) SetUserDisabled(ctx context.Context, userID uint64, disabled bool) error {
+	return s.updateUser(ctx, `UPDATE users SET disabled_at = $1 WHERE id = $2`, disabledAt(disabled), userID)
+}
+
+// RevokeSessions - принудительный выход пользователя
+func (s *SQLiteStore) RevokeSessions(ctx context.Context, userID uint64) error {
+	return s.updateUser(ctx, `UPDATE users SET sessions_revoked_at = $1 WHERE id = $2`, time.Now().UTC(), userID)
+}
+
+// SetPassword - замена пароля пользователя администратором с требованием сменить его при входе
+func (s *SQLiteStore) SetPassword(ctx context.Context, userID uint64, password string) error {
+	return s.updateUser(ctx, `UPDATE users SET password = $1, must_change_password = TRUE WHERE id = $2`,
+		hashPassword(password), userID)
+}
+
+// ChangePassword - замена пароля самим пользователем
+func (s *SQLiteStore) ChangePassword(ctx context.Context, userID uint64, password string) error {
+	return s.updateUser(ctx, `UPDATE users SET password = $1, must_change_password = FALSE WHERE id = $2`,
+		hashPassword(password), userID)
+}
+
+// updateUser - изменение пользователя запросом query с аргументами (значение, ID пользователя)
+func (s *SQLiteStore) updateUser(ctx context.Context, query string, value interface{}, userID uint64) error {
+	res, err := s.conn.ExecContext(ctx, query, value, userID)
+	if err != nil {
+		return fmt.Errorf("error updating user %d: %w", userID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("error updating user %d: %w", userID, ErrNotFound)
+	}
+	return nil
+}
+
+// PutDataRecord - сохранение данных
+func (s *SQLiteStore) PutDataRecord(ctx context.Context, data *models.DataRecord) error {
+	dek, err := s.dataKey(ctx, data.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return err
+	}
+	err = s.change(ctx, data.UserID, func(tx *sql.Tx, version uint64) error {
+		if dek != nil {
+			if err := legacyNameConflict(tx.QueryRowContext(ctx, legacyNameQuery, data.UserID, data.Name)); err != nil {
+				return err
+			}
+		}
+		data.Version = version
+		return tx.QueryRowContext(ctx, insertDataRecordQuery, data.UploadedAt, sealed.Type, sealed.Checksum,
+			sealed.Data, sealed.FilePath, sealed.Name, data.UserID, sealed.Key, sealed.NameIndex,
+			int64(len(data.Data)), version).Scan(&data.ID)
+	})
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("error saving data: %w", ErrConflict)
+		}
+		return fmt.Errorf("error saving data: %w", err)
+	}
+	return nil
+}
+
+// GetIdempotencyKey - ключ идемпотентности пользователя
+func (s *SQLiteStore) GetIdempotencyKey(ctx context.Context, userID uint64, key string) (*models.IdempotencyKey, error) {
+	k, err := scanIdempotencyKey(s.conn.QueryRowContext(ctx, idempotencyKeyQuery, userID, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error getting idempotency key: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting idempotency key: %w", err)
+	}
+	return k, nil
+}
+
+// PutDataRecordOnce - сохранение записи с ключом идемпотентности
+func (s *SQLiteStore) PutDataRecordOnce(ctx context.Context, data *models.DataRecord, k *models.IdempotencyKey) (bool, error) {
+	dek, err := s.dataKey(ctx, data.UserID)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return false, err
+	}
+	var used *models.IdempotencyKey
+	err = s.change(ctx, data.UserID, func(tx *sql.Tx, version uint64) error {
+		var err error
+		used, err = scanIdempotencyKey(tx.QueryRowContext(ctx, idempotencyKeyQuery, data.UserID, k.Key))
+		if err == nil {
+			return errKeyUsed
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if dek != nil {
+			if err := legacyNameConflict(tx.QueryRowContext(ctx, legacyNameQuery, data.UserID, data.Name)); err != nil {
+				return err
+			}
+		}
+		data.Version = version
+		err = tx.QueryRowContext(ctx, insertDataRecordQuery, data.UploadedAt, sealed.Type, sealed.Checksum,
+			sealed.Data, sealed.FilePath, sealed.Name, data.UserID, sealed.Key, sealed.NameIndex,
+			int64(len(data.Data)), version).Scan(&data.ID)
+		if err != nil {
+			return err
+		}
+		k.UserID, k.RecordID = data.UserID, data.ID
+		_, err = tx.ExecContext(ctx, insertIdempotencyKeyQuery, k.UserID, k.Key, k.RequestHash, k.RecordID,
+			k.CreatedAt)
+		return err
+	})
+	if errors.Is(err, errKeyUsed) {
+		return true, s.replayRecord(ctx, dek, data, k, used)
+	}
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return false, fmt.Errorf("error saving data: %w", ErrConflict)
+		}
+		return false, fmt.Errorf("error saving data: %w", err)
+	}
+	return false, nil
+}
+
+// PurgeIdempotencyKeys - удаление ключей идемпотентности, сохраненных до before
+func (s *SQLiteStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn.ExecContext(ctx, purgeIdempotencyKeysQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// replayRecord - запись, созданная ранее с ключом used, вместо новой записи data
+func (s *SQLiteStore) replayRecord(ctx context.Context, dek []byte, data *models.DataRecord, k, used *models.IdempotencyKey) error {
+	if err := checkReplay(k, used); err != nil {
+		return err
+	}
+	record, err := scanRecord(s.conn.QueryRowContext(ctx, recordByIDQuery, used.UserID, used.RecordID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error getting record %d: %w", used.RecordID, ErrNotFound)
+		}
+		return fmt.Errorf("error getting record %d: %w", used.RecordID, err)
+	}
+	if err := openRecord(dek, record); err != nil {
+		return err
+	}
+	*data = *record
+	return nil
+}
+
+// UpdateDataRecord - замена содержимого записи по названию
+func (s *SQLiteStore) UpdateDataRecord(ctx context.Context, data *models.DataRecord, ifVersion uint64) error {
+	dek, err := s.dataKey(ctx, data.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return err
+	}
+	err = s.change(ctx, data.UserID, func(tx *sql.Tx, version uint64) error {
+		data.Version = version
+		err := tx.QueryRowContext(ctx, updateDataRecordQuery, data.UserID, nameLookup(dek, data.Name), data.Name,
+			data.UploadedAt, sealed.Type, sealed.Checksum, sealed.Data, sealed.FilePath, sealed.Name, sealed.Key,
+			sealed.NameIndex, int64(len(data.Data)), version, ifVersion).Scan(&data.ID)
+		if errors.Is(err, sql.ErrNoRows) && ifVersion != 0 {
+			return versionConflict(tx.QueryRowContext(ctx, recordExistsQuery, data.UserID,
+				nameLookup(dek, data.Name), data.Name), err)
+		}
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error updating record %q: %w", data.Name, ErrNotFound)
+		}
+		return fmt.Errorf("error updating record: %w", err)
+	}
+	return nil
+}
+
+// DeleteDataRecord - удаление записи по названию
+func (s *SQLiteStore) DeleteDataRecord(ctx context.Context, userID uint64, name string,
+	ifVersion uint64) (*models.RecordTombstone, error) {
+	dek, err := s.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	t := &models.RecordTombstone{UserID: userID, DeletedAt: time.Now().UTC()}
+	err = s.change(ctx, userID, func(tx *sql.Tx, version uint64) error {
+		t.Version = version
+		err := tx.QueryRowContext(ctx, deleteDataRecordQuery, userID, nameLookup(dek, name), name, ifVersion).
+			Scan(&t.RecordID, &t.Type, &t.Name)
+		if errors.Is(err, sql.ErrNoRows) && ifVersion != 0 {
+			return versionConflict(tx.QueryRowContext(ctx, recordExistsQuery, userID, nameLookup(dek, name), name), err)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, insertTombstoneQuery, t.RecordID, userID, t.Type, t.Name, version, t.DeletedAt)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error deleting record %q: %w", name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error deleting record: %w", err)
+	}
+	if err := openTombstone(dek, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// change - изменение записей пользователя в транзакции под следующим номером изменения
+func (s *SQLiteStore) change(ctx context.Context, userID uint64, apply func(tx *sql.Tx, version uint64) error) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var version uint64
+	if err := tx.QueryRowContext(ctx, nextChangeQuery, userID).Scan(&version); err != nil {
+		return err
+	}
+	if err := apply(tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetUserRecord - получение данных по названию записи и ID пользователя
+func (s *SQLiteStore) GetUserRecord(ctx context.Context, recordName string, userID uint64) (*models.DataRecord, error) {
+	dek, err := s.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + recordColumns + ` FROM data_records WHERE ` + recordByName
+	record, err := scanRecord(s.conn.QueryRowContext(ctx, query, userID, nameLookup(dek, recordName), recordName))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error getting record %q: %w", recordName, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting record: %w", err)
+	}
+	if err := openRecord(dek, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetUserRecords - получение всех записей пользователя
+func (s *SQLiteStore) GetUserRecords(ctx context.Context, userID uint64) ([]models.DataRecord, error) {
+	dek, err := s.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]models.DataRecord, 0)
+	query := `SELECT ` + recordColumns + `
+              FROM data_records
+              WHERE user_id=$1
+              ORDER BY id`
+	rows, err := s.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting all user records: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error getting user record: %w", err)
+		}
+		if err := openRecord(dek, record); err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting user records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, models.ErrNoData
+	}
+	return records, nil
+}
+
+// GetRecordChanges - изменения записей пользователя после номера since
+func (s *SQLiteStore) GetRecordChanges(ctx context.Context, userID, since uint64, limit int) (*models.RecordChanges, error) {
+	dek, err := s.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var last, purged uint64
+	if err := s.conn.QueryRowContext(ctx, lastChangeQuery, userID).Scan(&last, &purged); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error getting last change: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting last change: %w", err)
+	}
+	if err := checkCursor(since, last, purged); err != nil {
+		return nil, err
+	}
+	rows, err := s.conn.QueryContext(ctx, changedRecordsQuery, userID, since, last, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error getting changed records: %w", err)
+	}
+	records, err := collectChangedRecords(rows, dek)
+	_ = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	rows, err = s.conn.QueryContext(ctx, tombstonesQuery, userID, since, last, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tombstones: %w", err)
+	}
+	defer rows.Close()
+	tombstones, err := collectTombstones(rows, dek)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRecordChanges(records, tombstones, since, last, limit), nil
+}
+
+// PurgeTombstones - удаление следов удаления, созданных до before
+func (s *SQLiteStore) PurgeTombstones(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, markPurgedTombstonesQuery, before.UTC()); err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, purgeTombstonesQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// CreateDevice - регистрация устройства пользователя
+func (s *SQLiteStore) CreateDevice(ctx context.Context, d *models.Device) error {
+	d.CreatedAt = time.Now().UTC()
+	query := `INSERT INTO devices (user_id, name, fingerprint, subject, created_at, expires_at)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id`
+	err := s.conn.QueryRowContext(ctx, query, d.UserID, d.Name, d.Fingerprint, d.Subject, d.CreatedAt, d.ExpiresAt).
+		Scan(&d.ID)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("error saving device: %w", ErrConflict)
+		}
+		return fmt.Errorf("error saving device: %w", err)
+	}
+	return nil
+}
+
+// GetDevice - получение устройства по отпечатку сертификата
+func (s *SQLiteStore) GetDevice(ctx context.Context, fingerprint string) (*models.Device, error) {
+	d := models.Device{}
+	query := `SELECT id, user_id, name, fingerprint, subject, created_at, expires_at, revoked_at
+              FROM devices
+              WHERE fingerprint=$1`
+	err := s.conn.QueryRowContext(ctx, query, fingerprint).Scan(&d.ID, &d.UserID, &d.Name, &d.Fingerprint,
+		&d.Subject, &d.CreatedAt, &d.ExpiresAt, &d.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error getting device: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting device: %w", err)
+	}
+	return &d, nil
+}
+
+// AppendAuditEvent - добавление события в журнал аудита. Транзакция SQLite берет блокировку на запись сразу
+// (_txlock=immediate), поэтому события добавляются по очереди и каждое ссылается на хэш последнего.
+func (s *SQLiteStore) AppendAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error appending audit event: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	prev := ""
+	err = tx.QueryRowContext(ctx, lastAuditHashQuery).Scan(&prev)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	sealAuditEvent(e, prev)
+	err = tx.QueryRowContext(ctx, insertAuditEventQuery, e.CreatedAt, e.UserID, e.Action, e.RecordID, e.IP,
+		e.UserAgent, e.Details, e.PrevHash, e.Hash).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("error appending audit event: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListAuditEvents - события пользователя с ID меньше beforeID (0 - с последнего) от новых к старым
+func (s *SQLiteStore) ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]models.AuditEvent, error) {
+	rows, err := s.conn.QueryContext(ctx, listAuditEventsQuery, userID, auditBefore(beforeID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+	defer rows.Close()
+	return collectAuditEvents(rows)
+}
+
+// AuditChain - события журнала по возрастанию ID для проверки цепочки
+func (s *SQLiteStore) AuditChain(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error) {
+	rows, err := s.conn.QueryContext(ctx, auditChainQuery, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer rows.Close()
+	return collectAuditEvents(rows)
+}
+
+// CreateWebhook - создание вебхука пользователя
+func (s *SQLiteStore) CreateWebhook(ctx context.Context, w *models.Webhook) error {
+	dek, err := s.dataKey(ctx, w.UserID)
+	if err != nil {
+		return err
+	}
+	secret, err := sealWebhookSecret(dek, w.UserID, w.Secret)
+	if err != nil {
+		return err
+	}
+	w.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	err = s.conn.QueryRowContext(ctx, insertWebhookQuery, w.UserID, w.URL, joinWebhookEvents(w.Events), secret,
+		w.CreatedAt).Scan(&w.ID)
+	if err != nil {
+		return fmt.Errorf("error saving webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhooks - вебхуки пользователя
+func (s *SQLiteStore) ListWebhooks(ctx context.Context, userID uint64) ([]models.Webhook, error) {
+	rows, err := s.conn.QueryContext(ctx, listWebhooksQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	defer rows.Close()
+	webhooks, err := collectWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := openWebhooks(ctx, newWebhookSecrets(s.dataKey), webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook - вебхук пользователя по ID
+func (s *SQLiteStore) GetWebhook(ctx context.Context, userID, id uint64) (*models.Webhook, error) {
+	w, err := scanWebhook(s.conn.QueryRowContext(ctx, getWebhookQuery, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error getting webhook: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting webhook: %w", err)
+	}
+	if err := newWebhookSecrets(s.dataKey).open(ctx, w.UserID, &w.Secret); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// DeleteWebhook - удаление вебхука пользователя вместе с неотправленными событиями
+func (s *SQLiteStore) DeleteWebhook(ctx context.Context, userID, id uint64) error {
+	res, err := s.conn.ExecContext(ctx, deleteWebhookQuery, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("error deleting webhook: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent - постановка события в очередь доставки подписанных на него вебхуков пользователя
+func (s *SQLiteStore) EnqueueWebhookEvent(ctx context.Context, userID uint64, event, payload string) (int64, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	res, err := s.conn.ExecContext(ctx, enqueueWebhookEventQuery, userID, event, payload, now)
+	if err != nil {
+		return 0, fmt.Errorf("error enqueueing webhook event: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ClaimWebhookDeliveries - выбор доставок к отправке и откладывание их на lease в одной транзакции
+// (транзакции SQLite берут блокировку на запись сразу, поэтому процессы не выберут одни и те же доставки)
+func (s *SQLiteStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	rows, err := tx.QueryContext(ctx, pendingWebhookDeliveriesQuery, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	deliveries, err := collectWebhookDeliveries(rows)
+	_ = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = now.Add(lease).UTC()
+		if _, err := tx.ExecContext(ctx, leaseWebhookDeliveryQuery, deliveries[i].ID, deliveries[i].NextAttemptAt); err != nil {
+			return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	if err := openWebhookDeliveries(ctx, newWebhookSecrets(s.dataKey), deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery - сохранение результата попытки доставки
+func (s *SQLiteStore) UpdateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	_, err := s.conn.ExecContext(ctx, updateWebhookDeliveryQuery, d.ID, d.Attempts, d.NextAttemptAt.UTC(), d.LastStatus,
+		d.LastError, d.DeliveredAt, d.FailedAt)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// PurgeWebhookDeliveries - удаление завершенных доставок, созданных до before
+func (s *SQLiteStore) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn.ExecContext(ctx, purgeWebhookDeliveriesQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging webhook deliveries: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// dataKey - ключ данных пользователя; nil, если шифрование на сервере выключено
+func (s *SQLiteStore) dataKey(ctx context.Context, userID uint64) ([]byte, error) {
+	return loadOrCreateDataKey(s.kek,
+		func() (*wrappedKey, error) {
+			key := wrappedKey{userID: userID}
+			err := s.conn.QueryRowContext(ctx, `SELECT kek_id, wrapped_key FROM user_keys WHERE user_id=$1`, userID).
+				Scan(&key.kekID, &key.wrapped)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return &key, err
+		},
+		func(kekID string, wrapped []byte) error {
+			query := `INSERT INTO user_keys (user_id, kek_id, wrapped_key) VALUES ($1, $2, $3)
+                      ON CONFLICT (user_id) DO NOTHING`
+			_, err := s.conn.ExecContext(ctx, query, userID, kekID, wrapped)
+			return err
+		})
+}
+
+// RewrapDataKeys - переобертывание ключей данных всех пользователей новым KEK в одной транзакции
+func (s *SQLiteStore) RewrapDataKeys(ctx context.Context, newKEK *envelope.KEK) (int, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, kek_id, wrapped_key FROM user_keys WHERE kek_id <> $1`,
+		newKEK.ID())
+	if err != nil {
+		return 0, fmt.Errorf("error reading data keys: %w", err)
+	}
+	keys := make([]wrappedKey, 0)
+	for rows.Next() {
+		var key wrappedKey
+		if err := rows.Scan(&key.userID, &key.kekID, &key.wrapped); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("error reading data keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		wrapped, err := rewrap(s.kek, newKEK, &key)
+		if err != nil {
+			return 0, err
+		}
+		query := `UPDATE user_keys SET kek_id=$1, wrapped_key=$2, rotated_at=CURRENT_TIMESTAMP WHERE user_id=$3`
+		if _, err := tx.ExecContext(ctx, query, newKEK.ID(), wrapped, key.userID); err != nil {
+			return 0, fmt.Errorf("error saving data key of user %d: %w", key.userID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// isSQLiteUniqueViolation - проверяет, что ошибка вызвана нарушением ограничения уникальности
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
@@ -2,128 +2,609 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/migrator"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/envelope"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
-	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgconn"
-	_ "github.com/lib/pq"
+	"github.com/EvgeniyBudaev/gophkeeper/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"strings"
+	"time"
 )
 
-// DBStore - хранилище данных
+// DBStore - хранилище данных в PostgreSQL.
+// Если задан KEK, чувствительные колонки записей шифруются ключом данных пользователя.
 type DBStore struct {
-	conn *sql.DB
+	pool *pgxpool.Pool
+	// sqlDB - database/sql поверх pool для мигратора, создается один раз
+	sqlDB *sql.DB
+	kek   *envelope.KEK
 }
 
 // Store - интерфейс хранилища
 type Store interface {
-	CreateUser(c *gin.Context, user *models.User) (uint64, error)
-	GetUser(c *gin.Context, u *models.User) (*models.User, error)
-	PutDataRecord(c *gin.Context, data *models.DataRecord) error
-	GetUserRecord(c *gin.Context, recordName string, userID uint64) (*models.DataRecord, error)
-	GetUserRecords(c *gin.Context, userID uint64) ([]models.DataRecord, error)
+	CreateUser(ctx context.Context, user *models.User) (uint64, error)
+	GetUser(ctx context.Context, u *models.User) (*models.User, error)
+	GetUserByID(ctx context.Context, userID uint64) (*models.User, error)
+	RecordLogin(ctx context.Context, userID uint64) error
+	// ChangePassword - замена пароля самим пользователем, снимает требование сменить пароль
+	ChangePassword(ctx context.Context, userID uint64, password string) error
+	PutDataRecord(ctx context.Context, data *models.DataRecord) error
+	GetUserRecord(ctx context.Context, recordName string, userID uint64) (*models.DataRecord, error)
+	GetUserRecords(ctx context.Context, userID uint64) ([]models.DataRecord, error)
+	// UpdateDataRecord - замена содержимого записи data.Name пользователя, ErrNotFound - записи нет.
+	// Если ifVersion не 0, запись заменяется только в этой версии, иначе ErrVersionMismatch.
+	UpdateDataRecord(ctx context.Context, data *models.DataRecord, ifVersion uint64) error
+	// DeleteDataRecord - удаление записи с сохранением следа для синхронизации, ErrNotFound - записи нет.
+	// Если ifVersion не 0, запись удаляется только в этой версии, иначе ErrVersionMismatch.
+	DeleteDataRecord(ctx context.Context, userID uint64, name string, ifVersion uint64) (*models.RecordTombstone, error)
+	// GetRecordChanges - до limit изменений записей после номера since, ErrStaleCursor - since больше последнего
+	// или следы удаления после since уже удалены
+	GetRecordChanges(ctx context.Context, userID, since uint64, limit int) (*models.RecordChanges, error)
+	// PurgeTombstones - удаление следов удаления, созданных до before
+	PurgeTombstones(ctx context.Context, before time.Time) (int64, error)
+	// GetIdempotencyKey - ключ идемпотентности пользователя, ErrNotFound - ключ не использовался
+	GetIdempotencyKey(ctx context.Context, userID uint64, key string) (*models.IdempotencyKey, error)
+	// PutDataRecordOnce - сохранение записи, создаваемой запросом с ключом идемпотентности k.
+	// Если ключ уже использован, запись не создается: data заменяется записью, созданной с этим ключом,
+	// и replayed = true. ErrIdempotencyMismatch - ключ использован запросом с другим содержимым,
+	// ErrNotFound - созданная с ключом запись уже удалена.
+	PutDataRecordOnce(ctx context.Context, data *models.DataRecord, k *models.IdempotencyKey) (replayed bool, err error)
+	// PurgeIdempotencyKeys - удаление ключей идемпотентности, сохраненных до before
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+	GetUsage(ctx context.Context, userID uint64) (*models.Usage, error)
+	GetQuotaOverride(ctx context.Context, userID uint64) (*models.QuotaOverride, error)
+	CreateDevice(ctx context.Context, d *models.Device) error
+	AppendAuditEvent(ctx context.Context, e *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]models.AuditEvent, error)
+	GetDevice(ctx context.Context, fingerprint string) (*models.Device, error)
+	Ping(ctx context.Context) error
+	Close() error
+	Webhooks
 }
 
-var ErrLoginNotFound = errors.New("login not found")
-var ErrDuplicateLogin = errors.New("login already registered")
+// UserAdmin - управление учетными записями для команд администрирования
+type UserAdmin interface {
+	// ListUsers - пользователи с количеством и объемом записей, по возрастанию ID
+	ListUsers(ctx context.Context) ([]models.UserStats, error)
+	// SetUserDisabled - блокировка или разблокировка учетной записи
+	SetUserDisabled(ctx context.Context, userID uint64, disabled bool) error
+	// RevokeSessions - принудительный выход: все выданные ранее токены пользователя становятся недействительны
+	RevokeSessions(ctx context.Context, userID uint64) error
+	// SetPassword - замена пароля пользователя администратором: войти с ним можно только для смены пароля
+	SetPassword(ctx context.Context, userID uint64, password string) error
+	// SetQuotaOverride - квоты пользователя; пустой QuotaOverride возвращает значения по умолчанию
+	SetQuotaOverride(ctx context.Context, userID uint64, o *models.QuotaOverride) error
+	// AuditChain - события журнала аудита всех пользователей с ID больше afterID по возрастанию, для проверки цепочки
+	AuditChain(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error)
+}
+
+// Migratable - хранилище, схема которого управляется встроенными миграциями
+type Migratable interface {
+	Migrator() (*migrator.Migrator, error)
+}
+
+// PoolStats - статистика пула соединений с базой
+type PoolStats struct {
+	MaxConns      int
+	OpenConns     int
+	IdleConns     int
+	InUseConns    int
+	WaitCount     int64
+	WaitDuration  time.Duration
+	MaxIdleClosed int64
+}
+
+// PoolStatter - хранилище с пулом соединений
+type PoolStatter interface {
+	PoolStats() PoolStats
+}
+
+// RecordNotifier - хранилище, через которое события записей рассылаются всем репликам сервера
+type RecordNotifier interface {
+	// NotifyRecordEvent - отправка события всем слушателям, в том числе этой реплике
+	NotifyRecordEvent(ctx context.Context, e *models.RecordEvent) error
+	// ListenRecordEvents - прием событий до отмены ctx или потери соединения с базой
+	ListenRecordEvents(ctx context.Context, handle func(e *models.RecordEvent)) error
+}
+
+var (
+	// ErrNotFound - запрошенный пользователь или запись отсутствует в хранилище
+	ErrNotFound = errors.New("not found")
+	// ErrConflict - нарушено ограничение уникальности (логин или имя записи уже заняты)
+	ErrConflict = errors.New("already exists")
+	// ErrStaleCursor - курсор синхронизации опережает изменения в хранилище
+	ErrStaleCursor = errors.New("stale sync cursor")
+	// ErrIdempotencyMismatch - ключ идемпотентности уже использован запросом с другим содержимым
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with different request")
+	// ErrVersionMismatch - запись изменена после версии, которую ожидал клиент
+	ErrVersionMismatch = errors.New("record version mismatch")
+)
 
-// NewDBStore - создание хранилища данных
-func NewStore(conn *sql.DB) Store {
-	return &DBStore{conn: conn}
+// Коды ошибок PostgreSQL, которые хранилище переводит в ErrConflict и ErrNotFound
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// queryExecModes - допустимые значения DB_QUERY_EXEC_MODE
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
 }
 
-// NewPostgresConnection - создание подключения к PostgreSQL
-func NewPostgresConnection(c *config.ServerConfig) (*sql.DB, error) {
-	fmt.Println("c.DatabaseDSN: ", c.DatabaseDSN)
-	return sql.Open("postgres", c.DatabaseDSN)
+// NewStore - создание хранилища данных поверх пула соединений. kek может быть nil.
+func NewStore(pool *pgxpool.Pool, kek *envelope.KEK) *DBStore {
+	return &DBStore{pool: pool, sqlDB: stdlib.OpenDBFromPool(pool), kek: kek}
 }
 
-func (db *DBStore) CreateUser(c *gin.Context, u *models.User) (uint64, error) {
+// NewPostgresPool - создание пула соединений к PostgreSQL.
+// Параметры пула из конфигурации переопределяют заданные в DSN (pool_max_conns и т.п.), если они не нулевые.
+func NewPostgresPool(ctx context.Context, c *config.ServerConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(c.DatabaseDSN)
+	if err != nil {
+		// текст ошибки pgx может содержать DSN вместе с паролем
+		return nil, errors.New("error parsing postgres DSN")
+	}
+	if c.DBMaxConns > 0 {
+		poolConfig.MaxConns = c.DBMaxConns
+	}
+	if c.DBMinConns > 0 {
+		poolConfig.MinConns = c.DBMinConns
+	}
+	if c.DBMaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = c.DBMaxConnLifetime
+	}
+	if c.DBMaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = c.DBMaxConnIdleTime
+	}
+	if c.DBStatementCacheCapacity > 0 {
+		poolConfig.ConnConfig.StatementCacheCapacity = c.DBStatementCacheCapacity
+	}
+	if c.DBQueryExecMode != "" {
+		mode, ok := queryExecModes[c.DBQueryExecMode]
+		if !ok {
+			return nil, fmt.Errorf("unknown query exec mode %q", c.DBQueryExecMode)
+		}
+		poolConfig.ConnConfig.DefaultQueryExecMode = mode
+	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating postgres pool: %w", err)
+	}
+	return pool, nil
+}
+
+// Open - создание хранилища по схеме DSN из конфигурации:
+// sqlite://path/to/file.db - встроенная база SQLite, memory:// - хранилище в памяти,
+// иначе DSN передается драйверу PostgreSQL (postgres://... или host=... user=...).
+// KEK для шифрования на сервере загружается из KEK_FILE или KEK.
+func Open(ctx context.Context, c *config.ServerConfig) (Store, error) {
+	kek, err := envelope.LoadKEK(c.KEKFile, c.KEK)
+	if err != nil {
+		return nil, err
+	}
+	scheme, rest, _ := strings.Cut(c.DatabaseDSN, ":")
+	switch strings.ToLower(scheme) {
+	case "sqlite", "sqlite3":
+		path := strings.TrimPrefix(rest, "//")
+		if path == "" {
+			return nil, fmt.Errorf("empty sqlite database path in DSN")
+		}
+		return NewSQLiteStore(path, kek)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		pool, err := NewPostgresPool(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return NewStore(pool, kek), nil
+	}
+}
+
+// Migrator - мигратор схемы PostgreSQL. Работает через database/sql поверх того же пула.
+func (db *DBStore) Migrator() (*migrator.Migrator, error) {
+	return migrator.New(db.sqlDB, migrator.Postgres, migrations.Postgres)
+}
+
+// Stat - статистика пула соединений
+func (db *DBStore) Stat() *pgxpool.Stat {
+	return db.pool.Stat()
+}
+
+// PoolStats - статистика пула для метрик
+func (db *DBStore) PoolStats() PoolStats {
+	st := db.pool.Stat()
+	return PoolStats{
+		MaxConns:      int(st.MaxConns()),
+		OpenConns:     int(st.TotalConns()),
+		IdleConns:     int(st.IdleConns()),
+		InUseConns:    int(st.AcquiredConns()),
+		WaitCount:     st.EmptyAcquireCount(),
+		WaitDuration:  st.AcquireDuration(),
+		MaxIdleClosed: st.MaxIdleDestroyCount(),
+	}
+}
+
+// Ping - проверка доступности базы
+func (db *DBStore) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
+
+// Close - закрытие пула соединений
+func (db *DBStore) Close() error {
+	err := db.sqlDB.Close()
+	db.pool.Close()
+	return err
+}
+
+// CreateUser - создание пользователя
+func (db *DBStore) CreateUser(ctx context.Context, u *models.User) (uint64, error) {
 	hashedPassword := hashPassword(u.Password)
 	query := `INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id`
-	err := db.conn.QueryRowContext(c, query, &u.Login, hashedPassword).Scan(&u.ID)
+	err := db.pool.QueryRow(ctx, query, u.Login, hashedPassword).Scan(&u.ID)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23505" {
-				return 0, fmt.Errorf("error saving user to db: %w", err)
-			}
-		}
+		return 0, fmt.Errorf("error saving user to db: %w", mapPgError(err))
 	}
-	return u.ID, err
+	return u.ID, nil
 }
 
 // GetUser - получение пользователя
-func (db *DBStore) GetUser(c *gin.Context, u *models.User) (*models.User, error) {
-	user := models.User{}
-	query := `SELECT id, login, password FROM users WHERE login = $1`
-	err := db.conn.QueryRowContext(c, query, u.Login).Scan(&user.ID, &user.Login, &user.Password)
+func (db *DBStore) GetUser(ctx context.Context, u *models.User) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE login = $1`
+	user, err := scanUser(db.pool.QueryRow(ctx, query, u.Login))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("error user not found in db: %w", err)
+		return nil, fmt.Errorf("error getting user from db: %w", mapPgError(err))
+	}
+	return user, nil
+}
+
+// GetUserByID - получение пользователя по ID
+func (db *DBStore) GetUserByID(ctx context.Context, userID uint64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(db.pool.QueryRow(ctx, query, userID))
+	if err != nil {
+		return nil, fmt.Errorf("error getting user %d from db: %w", userID, mapPgError(err))
+	}
+	return user, nil
+}
+
+// RecordLogin - сохранение времени последнего входа
+func (db *DBStore) RecordLogin(ctx context.Context, userID uint64) error {
+	return db.updateUser(ctx, `UPDATE users SET last_login_at = $1 WHERE id = $2`, time.Now().UTC(), userID)
+}
+
+// ListUsers - пользователи с количеством и объемом записей
+func (db *DBStore) ListUsers(ctx context.Context) ([]models.UserStats, error) {
+	rows, err := db.pool.Query(ctx, listUsersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+	users := make([]models.UserStats, 0)
+	for rows.Next() {
+		u, err := scanUserStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing users: %w", err)
 		}
-		return nil, err
+		users = append(users, *u)
 	}
-	return &user, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	return users, nil
+}
+
+// GetUsage - количество и суммарный размер записей пользователя
+func (db *DBStore) GetUsage(ctx context.Context, userID uint64) (*models.Usage, error) {
+	u := models.Usage{}
+	err := db.pool.QueryRow(ctx, usageQuery, userID).Scan(&u.Records, &u.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error getting usage of user %d: %w", userID, err)
+	}
+	return &u, nil
+}
+
+// GetQuotaOverride - квоты, заданные пользователю администратором
+func (db *DBStore) GetQuotaOverride(ctx context.Context, userID uint64) (*models.QuotaOverride, error) {
+	o := models.QuotaOverride{}
+	err := db.pool.QueryRow(ctx, quotaQuery, userID).Scan(&o.MaxRecords, &o.MaxBytes, &o.MaxRecordSize)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("error getting quota of user %d: %w", userID, err)
+	}
+	return &o, nil
+}
+
+// SetQuotaOverride - квоты пользователя
+func (db *DBStore) SetQuotaOverride(ctx context.Context, userID uint64, o *models.QuotaOverride) error {
+	var err error
+	if o.IsEmpty() {
+		_, err = db.pool.Exec(ctx, `DELETE FROM user_quotas WHERE user_id = $1`, userID)
+	} else {
+		_, err = db.pool.Exec(ctx, upsertQuotaQuery, userID, o.MaxRecords, o.MaxBytes, o.MaxRecordSize)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving quota of user %d: %w", userID, mapPgError(err))
+	}
+	return nil
+}
+
+// SetUserDisabled - блокировка или разблокировка учетной записи
+func (db *DBStore) SetUserDisabled(ctx context.Context, userID uint64, disabled bool) error {
+	return db.updateUser(ctx, `UPDATE users SET disabled_at = $1 WHERE id = $2`, disabledAt(disabled), userID)
+}
+
+// RevokeSessions - принудительный выход пользователя
+func (db *DBStore) RevokeSessions(ctx context.Context, userID uint64) error {
+	return db.updateUser(ctx, `UPDATE users SET sessions_revoked_at = $1 WHERE id = $2`, time.Now().UTC(), userID)
+}
+
+// SetPassword - замена пароля пользователя администратором с требованием сменить его при входе
+func (db *DBStore) SetPassword(ctx context.Context, userID uint64, password string) error {
+	return db.updateUser(ctx, `UPDATE users SET password = $1, must_change_password = TRUE WHERE id = $2`,
+		hashPassword(password), userID)
+}
+
+// ChangePassword - замена пароля самим пользователем
+func (db *DBStore) ChangePassword(ctx context.Context, userID uint64, password string) error {
+	return db.updateUser(ctx, `UPDATE users SET password = $1, must_change_password = FALSE WHERE id = $2`,
+		hashPassword(password), userID)
+}
+
+// updateUser - изменение пользователя запросом query с аргументами (значение, ID пользователя)
+func (db *DBStore) updateUser(ctx context.Context, query string, value interface{}, userID uint64) error {
+	tag, err := db.pool.Exec(ctx, query, value, userID)
+	if err != nil {
+		return fmt.Errorf("error updating user %d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error updating user %d: %w", userID, ErrNotFound)
+	}
+	return nil
 }
 
 // PutDataRecord - сохранение данных
-func (db *DBStore) PutDataRecord(c *gin.Context, data *models.DataRecord) error {
-	query := `
-		INSERT INTO data_records 
-		(uploaded_at, type, checksum, data, filepath, name, user_id, key)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		RETURNING id
-	`
-	err := db.conn.QueryRowContext(c, query, &data.UploadedAt, &data.Type, &data.Checksum, &data.Data, &data.FilePath,
-		&data.Name, &data.UserID, &data.Key).Scan(&data.ID)
-	if err != nil {
-		return fmt.Errorf("error saving data: %w", err)
+func (db *DBStore) PutDataRecord(ctx context.Context, data *models.DataRecord) error {
+	dek, err := db.dataKey(ctx, data.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return err
+	}
+	err = db.change(ctx, data.UserID, func(tx pgx.Tx, version uint64) error {
+		if dek != nil {
+			if err := legacyNameConflict(tx.QueryRow(ctx, legacyNameQuery, data.UserID, data.Name)); err != nil {
+				return err
+			}
+		}
+		data.Version = version
+		return tx.QueryRow(ctx, insertDataRecordQuery, data.UploadedAt, sealed.Type, sealed.Checksum, sealed.Data,
+			sealed.FilePath, sealed.Name, data.UserID, sealed.Key, sealed.NameIndex, int64(len(data.Data)), version).
+			Scan(&data.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving data: %w", mapPgError(err))
 	}
 	return nil
 }
 
+// GetIdempotencyKey - ключ идемпотентности пользователя
+func (db *DBStore) GetIdempotencyKey(ctx context.Context, userID uint64, key string) (*models.IdempotencyKey, error) {
+	k, err := scanIdempotencyKey(db.pool.QueryRow(ctx, idempotencyKeyQuery, userID, key))
+	if err != nil {
+		return nil, fmt.Errorf("error getting idempotency key: %w", mapPgError(err))
+	}
+	return k, nil
+}
+
+// PutDataRecordOnce - сохранение записи с ключом идемпотентности
+func (db *DBStore) PutDataRecordOnce(ctx context.Context, data *models.DataRecord, k *models.IdempotencyKey) (bool, error) {
+	dek, err := db.dataKey(ctx, data.UserID)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return false, err
+	}
+	var used *models.IdempotencyKey
+	err = db.change(ctx, data.UserID, func(tx pgx.Tx, version uint64) error {
+		var err error
+		used, err = scanIdempotencyKey(tx.QueryRow(ctx, idempotencyKeyQuery, data.UserID, k.Key))
+		if err == nil {
+			return errKeyUsed
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if dek != nil {
+			if err := legacyNameConflict(tx.QueryRow(ctx, legacyNameQuery, data.UserID, data.Name)); err != nil {
+				return err
+			}
+		}
+		data.Version = version
+		err = tx.QueryRow(ctx, insertDataRecordQuery, data.UploadedAt, sealed.Type, sealed.Checksum, sealed.Data,
+			sealed.FilePath, sealed.Name, data.UserID, sealed.Key, sealed.NameIndex, int64(len(data.Data)), version).
+			Scan(&data.ID)
+		if err != nil {
+			return err
+		}
+		k.UserID, k.RecordID = data.UserID, data.ID
+		_, err = tx.Exec(ctx, insertIdempotencyKeyQuery, k.UserID, k.Key, k.RequestHash, k.RecordID, k.CreatedAt)
+		return err
+	})
+	if errors.Is(err, errKeyUsed) {
+		return true, db.replayRecord(ctx, dek, data, k, used)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error saving data: %w", mapPgError(err))
+	}
+	return false, nil
+}
+
+// PurgeIdempotencyKeys - удаление ключей идемпотентности, сохраненных до before
+func (db *DBStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := db.pool.Exec(ctx, purgeIdempotencyKeysQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// replayRecord - запись, созданная ранее с ключом used, вместо новой записи data
+func (db *DBStore) replayRecord(ctx context.Context, dek []byte, data *models.DataRecord, k, used *models.IdempotencyKey) error {
+	if err := checkReplay(k, used); err != nil {
+		return err
+	}
+	record, err := scanRecord(db.pool.QueryRow(ctx, recordByIDQuery, used.UserID, used.RecordID))
+	if err != nil {
+		return fmt.Errorf("error getting record %d: %w", used.RecordID, mapPgError(err))
+	}
+	if err := openRecord(dek, record); err != nil {
+		return err
+	}
+	*data = *record
+	return nil
+}
+
+// UpdateDataRecord - замена содержимого записи по названию
+func (db *DBStore) UpdateDataRecord(ctx context.Context, data *models.DataRecord, ifVersion uint64) error {
+	dek, err := db.dataKey(ctx, data.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealRecord(dek, data)
+	if err != nil {
+		return err
+	}
+	err = db.change(ctx, data.UserID, func(tx pgx.Tx, version uint64) error {
+		data.Version = version
+		err := tx.QueryRow(ctx, updateDataRecordQuery, data.UserID, nameLookup(dek, data.Name), data.Name,
+			data.UploadedAt, sealed.Type, sealed.Checksum, sealed.Data, sealed.FilePath, sealed.Name, sealed.Key,
+			sealed.NameIndex, int64(len(data.Data)), version, ifVersion).Scan(&data.ID)
+		if errors.Is(err, pgx.ErrNoRows) && ifVersion != 0 {
+			return versionConflict(tx.QueryRow(ctx, recordExistsQuery, data.UserID, nameLookup(dek, data.Name),
+				data.Name), err)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error updating record %q: %w", data.Name, mapPgError(err))
+	}
+	return nil
+}
+
+// DeleteDataRecord - удаление записи по названию
+func (db *DBStore) DeleteDataRecord(ctx context.Context, userID uint64, name string,
+	ifVersion uint64) (*models.RecordTombstone, error) {
+	dek, err := db.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	t := &models.RecordTombstone{UserID: userID, DeletedAt: time.Now().UTC()}
+	err = db.change(ctx, userID, func(tx pgx.Tx, version uint64) error {
+		t.Version = version
+		err := tx.QueryRow(ctx, deleteDataRecordQuery, userID, nameLookup(dek, name), name, ifVersion).
+			Scan(&t.RecordID, &t.Type, &t.Name)
+		if errors.Is(err, pgx.ErrNoRows) && ifVersion != 0 {
+			return versionConflict(tx.QueryRow(ctx, recordExistsQuery, userID, nameLookup(dek, name), name), err)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, insertTombstoneQuery, t.RecordID, userID, t.Type, t.Name, version, t.DeletedAt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error deleting record %q: %w", name, mapPgError(err))
+	}
+	if err := openTombstone(dek, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// change - изменение записей пользователя в транзакции под следующим номером изменения
+func (db *DBStore) change(ctx context.Context, userID uint64, apply func(tx pgx.Tx, version uint64) error) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	var version uint64
+	if err := tx.QueryRow(ctx, nextChangeQuery, userID).Scan(&version); err != nil {
+		return err
+	}
+	if err := apply(tx, version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 // GetUserRecord- получение данных по названию записи и ID пользователя
-func (db *DBStore) GetUserRecord(c *gin.Context, recordName string, userID uint64) (*models.DataRecord, error) {
-	record := models.DataRecord{}
-	query := `SELECT id, uploaded_at, type, checksum, data, filepath, name, user_id, key
-              FROM data_records
-              WHERE user_id=$1 AND name=$2`
-	row := db.conn.QueryRowContext(c, query, userID, recordName)
-	if row == nil {
-		return nil, fmt.Errorf("no rows found")
+func (db *DBStore) GetUserRecord(ctx context.Context, recordName string, userID uint64) (*models.DataRecord, error) {
+	dek, err := db.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-	err := row.Scan(&record.ID, &record.UploadedAt, &record.Type, &record.Checksum, &record.Data, &record.FilePath,
-		&record.Name, &record.UserID, &record.Key)
+	query := `SELECT ` + recordColumns + ` FROM data_records WHERE ` + recordByName
+	record, err := scanRecord(db.pool.QueryRow(ctx, query, userID, nameLookup(dek, recordName), recordName))
 	if err != nil {
-		return nil, fmt.Errorf("error getting order: %w", err)
+		return nil, fmt.Errorf("error getting record %q: %w", recordName, mapPgError(err))
+	}
+	if err := openRecord(dek, record); err != nil {
+		return nil, err
 	}
-	return &record, nil
+	return record, nil
 }
 
 // GetUserRecords - получение всех записей пользователя
-func (db *DBStore) GetUserRecords(c *gin.Context, userID uint64) ([]models.DataRecord, error) {
+func (db *DBStore) GetUserRecords(ctx context.Context, userID uint64) ([]models.DataRecord, error) {
+	dek, err := db.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 	records := make([]models.DataRecord, 0)
-	query := `SELECT id, uploaded_at, type, checksum, data, filepath, name, user_id, key
+	query := `SELECT ` + recordColumns + `
               FROM data_records
-              WHERE user_id=$1`
-	rows, err := db.conn.QueryContext(c, query, userID)
+              WHERE user_id=$1
+              ORDER BY id`
+	rows, err := db.pool.Query(ctx, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("error getting all user records: %w", err)
+		return nil, fmt.Errorf("error getting all user records: %w", mapPgError(err))
 	}
 	defer rows.Close()
 	for rows.Next() {
-		record := models.DataRecord{}
-		err := rows.Scan(&record.ID, &record.UploadedAt, &record.Type, &record.Checksum, &record.Data, &record.FilePath,
-			&record.Name, &record.UserID, &record.Key)
+		record, err := scanRecord(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error getting user record: %w", err)
 		}
-		records = append(records, record)
+		if err := openRecord(dek, record); err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting user records: %w", mapPgError(err))
 	}
 	if len(records) == 0 {
 		return nil, models.ErrNoData
@@ -131,6 +612,438 @@ func (db *DBStore) GetUserRecords(c *gin.Context, userID uint64) ([]models.DataR
 	return records, nil
 }
 
+// GetRecordChanges - изменения записей пользователя после номера since
+func (db *DBStore) GetRecordChanges(ctx context.Context, userID, since uint64, limit int) (*models.RecordChanges, error) {
+	dek, err := db.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var last, purged uint64
+	if err := db.pool.QueryRow(ctx, lastChangeQuery, userID).Scan(&last, &purged); err != nil {
+		return nil, fmt.Errorf("error getting last change: %w", mapPgError(err))
+	}
+	if err := checkCursor(since, last, purged); err != nil {
+		return nil, err
+	}
+	rows, err := db.pool.Query(ctx, changedRecordsQuery, userID, since, last, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error getting changed records: %w", err)
+	}
+	records, err := collectChangedRecords(rows, dek)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	rows, err = db.pool.Query(ctx, tombstonesQuery, userID, since, last, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tombstones: %w", err)
+	}
+	defer rows.Close()
+	tombstones, err := collectTombstones(rows, dek)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRecordChanges(records, tombstones, since, last, limit), nil
+}
+
+// PurgeTombstones - удаление следов удаления, созданных до before
+func (db *DBStore) PurgeTombstones(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if _, err := tx.Exec(ctx, markPurgedTombstonesQuery, before.UTC()); err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	tag, err := tx.Exec(ctx, purgeTombstonesQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error purging tombstones: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CreateDevice - регистрация устройства пользователя
+func (db *DBStore) CreateDevice(ctx context.Context, d *models.Device) error {
+	d.CreatedAt = time.Now().UTC()
+	query := `INSERT INTO devices (user_id, name, fingerprint, subject, created_at, expires_at)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id`
+	err := db.pool.QueryRow(ctx, query, d.UserID, d.Name, d.Fingerprint, d.Subject, d.CreatedAt, d.ExpiresAt).
+		Scan(&d.ID)
+	if err != nil {
+		return fmt.Errorf("error saving device: %w", mapPgError(err))
+	}
+	return nil
+}
+
+// GetDevice - получение устройства по отпечатку сертификата
+func (db *DBStore) GetDevice(ctx context.Context, fingerprint string) (*models.Device, error) {
+	d := models.Device{}
+	query := `SELECT id, user_id, name, fingerprint, subject, created_at, expires_at, revoked_at
+              FROM devices
+              WHERE fingerprint=$1`
+	err := db.pool.QueryRow(ctx, query, fingerprint).Scan(&d.ID, &d.UserID, &d.Name, &d.Fingerprint, &d.Subject,
+		&d.CreatedAt, &d.ExpiresAt, &d.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error getting device: %w", mapPgError(err))
+	}
+	return &d, nil
+}
+
+// AppendAuditEvent - добавление события в журнал аудита. Добавления выполняются по очереди под advisory lock,
+// чтобы каждое событие ссылалось на хэш последнего.
+func (db *DBStore) AppendAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error appending audit event: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, auditLockID); err != nil {
+		return fmt.Errorf("error locking audit log: %w", err)
+	}
+	prev := ""
+	err = tx.QueryRow(ctx, lastAuditHashQuery).Scan(&prev)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	sealAuditEvent(e, prev)
+	err = tx.QueryRow(ctx, insertAuditEventQuery, e.CreatedAt, e.UserID, e.Action, e.RecordID, e.IP, e.UserAgent,
+		e.Details, e.PrevHash, e.Hash).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("error appending audit event: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// ListAuditEvents - события пользователя с ID меньше beforeID (0 - с последнего) от новых к старым
+func (db *DBStore) ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]models.AuditEvent, error) {
+	rows, err := db.pool.Query(ctx, listAuditEventsQuery, userID, auditBefore(beforeID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+	defer rows.Close()
+	return collectAuditEvents(rows)
+}
+
+// AuditChain - события журнала по возрастанию ID для проверки цепочки
+func (db *DBStore) AuditChain(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error) {
+	rows, err := db.pool.Query(ctx, auditChainQuery, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer rows.Close()
+	return collectAuditEvents(rows)
+}
+
+// CreateWebhook - создание вебхука пользователя
+func (db *DBStore) CreateWebhook(ctx context.Context, w *models.Webhook) error {
+	dek, err := db.dataKey(ctx, w.UserID)
+	if err != nil {
+		return err
+	}
+	secret, err := sealWebhookSecret(dek, w.UserID, w.Secret)
+	if err != nil {
+		return err
+	}
+	w.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	err = db.pool.QueryRow(ctx, insertWebhookQuery, w.UserID, w.URL, joinWebhookEvents(w.Events), secret,
+		w.CreatedAt).Scan(&w.ID)
+	if err != nil {
+		return fmt.Errorf("error saving webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhooks - вебхуки пользователя
+func (db *DBStore) ListWebhooks(ctx context.Context, userID uint64) ([]models.Webhook, error) {
+	rows, err := db.pool.Query(ctx, listWebhooksQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	defer rows.Close()
+	webhooks, err := collectWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := openWebhooks(ctx, newWebhookSecrets(db.dataKey), webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook - вебхук пользователя по ID
+func (db *DBStore) GetWebhook(ctx context.Context, userID, id uint64) (*models.Webhook, error) {
+	w, err := scanWebhook(db.pool.QueryRow(ctx, getWebhookQuery, id, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("error getting webhook: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting webhook: %w", err)
+	}
+	if err := newWebhookSecrets(db.dataKey).open(ctx, w.UserID, &w.Secret); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// DeleteWebhook - удаление вебхука пользователя вместе с неотправленными событиями
+func (db *DBStore) DeleteWebhook(ctx context.Context, userID, id uint64) error {
+	tag, err := db.pool.Exec(ctx, deleteWebhookQuery, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error deleting webhook: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent - постановка события в очередь доставки подписанных на него вебхуков пользователя
+func (db *DBStore) EnqueueWebhookEvent(ctx context.Context, userID uint64, event, payload string) (int64, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	tag, err := db.pool.Exec(ctx, enqueueWebhookEventQuery, userID, event, payload, now)
+	if err != nil {
+		return 0, fmt.Errorf("error enqueueing webhook event: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ClaimWebhookDeliveries - выбор доставок к отправке. Строки, выбранные другой репликой, пропускаются
+// (SKIP LOCKED), выбранные откладываются на lease в той же транзакции.
+func (db *DBStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	rows, err := tx.Query(ctx, pendingWebhookDeliveriesQuery+` FOR UPDATE OF d SKIP LOCKED`, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	deliveries, err := collectWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = now.Add(lease).UTC()
+		if _, err := tx.Exec(ctx, leaseWebhookDeliveryQuery, deliveries[i].ID, deliveries[i].NextAttemptAt); err != nil {
+			return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	if err := openWebhookDeliveries(ctx, newWebhookSecrets(db.dataKey), deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery - сохранение результата попытки доставки
+func (db *DBStore) UpdateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	_, err := db.pool.Exec(ctx, updateWebhookDeliveryQuery, d.ID, d.Attempts, d.NextAttemptAt.UTC(), d.LastStatus,
+		d.LastError, d.DeliveredAt, d.FailedAt)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// PurgeWebhookDeliveries - удаление завершенных доставок, созданных до before
+func (db *DBStore) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := db.pool.Exec(ctx, purgeWebhookDeliveriesQuery, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging webhook deliveries: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// recordEventsChannel - канал LISTEN/NOTIFY событий записей
+const recordEventsChannel = "gophkeeper_record_events"
+
+// NotifyRecordEvent - рассылка события записи всем репликам через NOTIFY
+func (db *DBStore) NotifyRecordEvent(ctx context.Context, e *models.RecordEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding record event: %w", err)
+	}
+	if _, err := db.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, recordEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("error notifying record event: %w", err)
+	}
+	return nil
+}
+
+// ListenRecordEvents - прием событий записей от всех реплик. Слушает отдельное соединение, изъятое из пула,
+// чтобы подписка LISTEN не досталась другим запросам.
+func (db *DBStore) ListenRecordEvents(ctx context.Context, handle func(e *models.RecordEvent)) error {
+	pooled, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring listen connection: %w", err)
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "LISTEN "+recordEventsChannel); err != nil {
+		return fmt.Errorf("error listening record events: %w", err)
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("error waiting record events: %w", err)
+		}
+		var e models.RecordEvent
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			return fmt.Errorf("error decoding record event: %w", err)
+		}
+		handle(&e)
+	}
+}
+
+// dataKey - ключ данных пользователя; nil, если шифрование на сервере выключено
+func (db *DBStore) dataKey(ctx context.Context, userID uint64) ([]byte, error) {
+	return loadOrCreateDataKey(db.kek,
+		func() (*wrappedKey, error) {
+			key := wrappedKey{userID: userID}
+			err := db.pool.QueryRow(ctx, `SELECT kek_id, wrapped_key FROM user_keys WHERE user_id=$1`, userID).
+				Scan(&key.kekID, &key.wrapped)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, nil
+			}
+			return &key, err
+		},
+		func(kekID string, wrapped []byte) error {
+			query := `INSERT INTO user_keys (user_id, kek_id, wrapped_key) VALUES ($1, $2, $3)
+                      ON CONFLICT (user_id) DO NOTHING`
+			_, err := db.pool.Exec(ctx, query, userID, kekID, wrapped)
+			return err
+		})
+}
+
+// RewrapDataKeys - переобертывание ключей данных всех пользователей новым KEK в одной транзакции.
+// Ключи, уже обернутые новым KEK, пропускаются, поэтому команду можно безопасно повторить.
+func (db *DBStore) RewrapDataKeys(ctx context.Context, newKEK *envelope.KEK) (int, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	rows, err := tx.Query(ctx, `SELECT user_id, kek_id, wrapped_key FROM user_keys WHERE kek_id <> $1 FOR UPDATE`,
+		newKEK.ID())
+	if err != nil {
+		return 0, fmt.Errorf("error reading data keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (wrappedKey, error) {
+		var key wrappedKey
+		err := row.Scan(&key.userID, &key.kekID, &key.wrapped)
+		return key, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error reading data keys: %w", err)
+	}
+	for _, key := range keys {
+		wrapped, err := rewrap(db.kek, newKEK, &key)
+		if err != nil {
+			return 0, err
+		}
+		query := `UPDATE user_keys SET kek_id=$1, wrapped_key=$2, rotated_at=now() WHERE user_id=$3`
+		if _, err := tx.Exec(ctx, query, newKEK.ID(), wrapped, key.userID); err != nil {
+			return 0, fmt.Errorf("error saving data key of user %d: %w", key.userID, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// mapPgError - перевод ошибок pgx в ошибки хранилища.
+// Исходная ошибка сохраняется в цепочке, чтобы ее код был виден в логах.
+func mapPgError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case pgForeignKeyViolation:
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+	}
+	return err
+}
+
+// userColumns - колонки пользователя в порядке scanUser
+const userColumns = `id, login, password, disabled_at, last_login_at, sessions_revoked_at, must_change_password`
+
+// rowScanner - строка результата запроса pgx или database/sql
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser - чтение пользователя из строки с колонками userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	user := models.User{}
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.DisabledAt, &user.LastLoginAt,
+		&user.SessionsRevokedAt, &user.MustChangePassword)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// listUsersQuery - запрос ListUsers, общий для PostgreSQL и SQLite
+const listUsersQuery = `SELECT u.id, u.login, u.password, u.disabled_at, u.last_login_at, u.sessions_revoked_at,
+                               u.must_change_password, COUNT(r.id), COALESCE(SUM(r.size), 0)
+                          FROM users u
+                          LEFT JOIN data_records r ON r.user_id = u.id
+                         GROUP BY u.id, u.login, u.password, u.disabled_at, u.last_login_at, u.sessions_revoked_at,
+                                  u.must_change_password
+                         ORDER BY u.id`
+
+// Запросы квот, общие для PostgreSQL и SQLite
+const (
+	usageQuery       = `SELECT COUNT(id), COALESCE(SUM(size), 0) FROM data_records WHERE user_id = $1`
+	quotaQuery       = `SELECT max_records, max_bytes, max_record_size FROM user_quotas WHERE user_id = $1`
+	upsertQuotaQuery = `INSERT INTO user_quotas (user_id, max_records, max_bytes, max_record_size)
+                        VALUES ($1, $2, $3, $4)
+                        ON CONFLICT (user_id) DO UPDATE
+                        SET max_records = excluded.max_records, max_bytes = excluded.max_bytes,
+                            max_record_size = excluded.max_record_size`
+)
+
+// scanUserStats - чтение строки ListUsers
+func scanUserStats(row rowScanner) (*models.UserStats, error) {
+	u := models.UserStats{}
+	err := row.Scan(&u.ID, &u.Login, &u.Password, &u.DisabledAt, &u.LastLoginAt, &u.SessionsRevokedAt,
+		&u.MustChangePassword, &u.Records, &u.DataSize)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// disabledAt - значение disabled_at для блокировки (текущее время) или разблокировки (NULL)
+func disabledAt(disabled bool) *time.Time {
+	if !disabled {
+		return nil
+	}
+	now := time.Now().UTC()
+	return &now
+}
+
 // hashPassword — вспомогательная функция для хеширования пароля с использованием SHA-256.
 func hashPassword(password string) string {
 	hash := sha256.Sum256([]byte(password))
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// benchRecordsPerUser - количество записей пользователя в бенчмарке GetUserRecords
+const benchRecordsPerUser = 50
+
+// benchStores - DSN хранилищ для бенчмарков. PostgreSQL подключается,
+// если задана переменная GOPHKEEPER_BENCH_DATABASE_DSN (база должна быть пустой или размеченной миграциями).
+func benchStores(b *testing.B) map[string]string {
+	dsns := map[string]string{
+		"memory": "memory://",
+		"sqlite": "sqlite://" + filepath.Join(b.TempDir(), "bench.db"),
+	}
+	if dsn := os.Getenv("GOPHKEEPER_BENCH_DATABASE_DSN"); dsn != "" {
+		dsns["postgres"] = dsn
+	}
+	return dsns
+}
+
+// openBenchStore - открытие хранилища с примененными миграциями и пользователем с benchRecordsPerUser записями
+func openBenchStore(b *testing.B, dsn string) (Store, uint64) {
+	b.Helper()
+	ctx := context.Background()
+	s, err := Open(ctx, &config.ServerConfig{DatabaseDSN: dsn, DBMaxConns: 16})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = s.Close()
+	})
+	if ms, ok := s.(Migratable); ok {
+		m, err := ms.Migrator()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := m.Up(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+	login := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	userID, err := s.CreateUser(ctx, &models.User{Login: login, Password: "password"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchRecordsPerUser; i++ {
+		err := s.PutDataRecord(ctx, &models.DataRecord{
+			UploadedAt: time.Now(),
+			Type:       models.PASS,
+			Checksum:   "checksum",
+			Data:       "login:password",
+			Name:       fmt.Sprintf("%s-record-%d", login, i),
+			UserID:     userID,
+			Key:        "key",
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s, userID
+}
+
+// BenchmarkGetUserRecords - пропускная способность GetUserRecords при конкурентной нагрузке
+func BenchmarkGetUserRecords(b *testing.B) {
+	for name, dsn := range benchStores(b) {
+		b.Run(name, func(b *testing.B) {
+			s, userID := openBenchStore(b, dsn)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					records, err := s.GetUserRecords(ctx, userID)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					if len(records) != benchRecordsPerUser {
+						b.Errorf("got %d records, want %d", len(records), benchRecordsPerUser)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Модуль трассировки запросов к PostgreSQL
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName - имя трассировщика хранилища
+const tracerName = "github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+
+// queryTracer - дочерний спан на каждый запрос пула pgx. В спан попадает текст SQL без аргументов,
+// чтобы значения колонок (в том числе секреты) не уходили в коллектор.
+type queryTracer struct{}
+
+// TraceQueryStart - реализация pgx.QueryTracer
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, "postgres "+sqlOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(strings.TrimSpace(data.SQL)),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd - реализация pgx.QueryTracer
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+}
+
+// sqlOperation - первое слово запроса (SELECT, INSERT, ...) для имени спана
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
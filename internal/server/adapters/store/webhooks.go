@@ -0,0 +1,144 @@
+// Модуль вебхуков и очереди их доставки, общий для хранилищ
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+// Webhooks - вебхуки пользователей и очередь доставки событий (outbox)
+type Webhooks interface {
+	CreateWebhook(ctx context.Context, w *models.Webhook) error
+	ListWebhooks(ctx context.Context, userID uint64) ([]models.Webhook, error)
+	// GetWebhook - вебхук пользователя userID, ErrNotFound для чужого или удаленного
+	GetWebhook(ctx context.Context, userID, id uint64) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, id uint64) error
+	// EnqueueWebhookEvent - постановка события в очередь доставки всех вебхуков пользователя, подписанных на него.
+	// Секреты вебхуков при этом не читаются. Возвращает количество поставленных в очередь доставок.
+	EnqueueWebhookEvent(ctx context.Context, userID uint64, event, payload string) (int64, error)
+	// ClaimWebhookDeliveries - до limit доставок, время отправки которых наступило к now. Выбранные доставки
+	// откладываются на lease, чтобы другие реплики не отправили их одновременно; итог отправки
+	// сохраняет UpdateWebhookDelivery.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error
+	// PurgeWebhookDeliveries - удаление доставленных и окончательно не доставленных событий, созданных до before
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Запросы вебхуков, общие для PostgreSQL и SQLite
+const (
+	webhookColumns     = `id, user_id, url, events, secret, created_at`
+	insertWebhookQuery = `INSERT INTO webhooks (user_id, url, events, secret, created_at)
+                          VALUES ($1, $2, $3, $4, $5)
+                          RETURNING id`
+	listWebhooksQuery = `SELECT ` + webhookColumns + ` FROM webhooks
+                         WHERE user_id = $1
+                         ORDER BY id`
+	getWebhookQuery = `SELECT ` + webhookColumns + ` FROM webhooks
+                       WHERE id = $1 AND user_id = $2`
+	deleteWebhookQuery = `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`
+	// enqueueWebhookEventQuery - доставки события $2 во все вебхуки пользователя $1, подписанные на него
+	// (см. models.Webhook.Matches). Названия событий не содержат запятых, а '_' в шаблоне LIKE среди
+	// допустимых событий совпадает только с самим собой.
+	enqueueWebhookEventQuery = `INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+                                SELECT id, CAST($2 AS TEXT), $3, $4, $4 FROM webhooks
+                                WHERE user_id = $1
+                                  AND (events = '' OR ',' || events || ',' LIKE '%,' || CAST($2 AS TEXT) || ',%')`
+	// pendingWebhookDeliveriesQuery - доставки к отправке; в PostgreSQL дополняется блокировкой строк
+	pendingWebhookDeliveriesQuery = `SELECT d.id, d.webhook_id, d.event, d.payload, d.attempts, d.next_attempt_at,
+                                            d.created_at, w.url, w.secret, w.user_id
+                                     FROM webhook_deliveries d
+                                     JOIN webhooks w ON w.id = d.webhook_id
+                                     WHERE d.delivered_at IS NULL AND d.failed_at IS NULL AND d.next_attempt_at <= $1
+                                     ORDER BY d.next_attempt_at, d.id
+                                     LIMIT $2`
+	leaseWebhookDeliveryQuery  = `UPDATE webhook_deliveries SET next_attempt_at = $2 WHERE id = $1`
+	updateWebhookDeliveryQuery = `UPDATE webhook_deliveries
+                                  SET attempts = $2, next_attempt_at = $3, last_status = $4, last_error = $5,
+                                      delivered_at = $6, failed_at = $7
+                                  WHERE id = $1`
+	purgeWebhookDeliveriesQuery = `DELETE FROM webhook_deliveries
+                                   WHERE (delivered_at IS NOT NULL OR failed_at IS NOT NULL) AND created_at < $1`
+)
+
+// joinWebhookEvents - события вебхука для колонки events
+func joinWebhookEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+// splitWebhookEvents - события вебхука из колонки events
+func splitWebhookEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+// scanWebhook - чтение вебхука из строки с колонками webhookColumns
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	w := models.Webhook{}
+	events := ""
+	if err := row.Scan(&w.ID, &w.UserID, &w.URL, &events, &w.Secret, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = splitWebhookEvents(events)
+	return &w, nil
+}
+
+// collectWebhooks - чтение вебхуков из строк результата
+func collectWebhooks(rows resultRows) ([]models.Webhook, error) {
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook: %w", err)
+		}
+		webhooks = append(webhooks, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// collectWebhookDeliveries - чтение доставок из строк pendingWebhookDeliveriesQuery
+func collectWebhookDeliveries(rows resultRows) ([]models.WebhookDelivery, error) {
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d := models.WebhookDelivery{}
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt,
+			&d.URL, &d.Secret, &d.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// openWebhooks - расшифровка секретов вебхуков
+func openWebhooks(ctx context.Context, secrets *webhookSecrets, webhooks []models.Webhook) error {
+	for i := range webhooks {
+		if err := secrets.open(ctx, webhooks[i].UserID, &webhooks[i].Secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openWebhookDeliveries - расшифровка секретов вебхуков выбранных доставок
+func openWebhookDeliveries(ctx context.Context, secrets *webhookSecrets, deliveries []models.WebhookDelivery) error {
+	for i := range deliveries {
+		if err := secrets.open(ctx, deliveries[i].UserID, &deliveries[i].Secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// login - вызов Login с логином и паролем
+func login(app *App, login, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.User{Login: login, Password: password})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBuffer(body))
+	app.Login(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// changePassword - вызов ChangePassword
+func changePassword(app *App, login, password, newPassword string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.PasswordChangeRequest{Login: login, Password: password, NewPassword: newPassword})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/password", bytes.NewBuffer(body))
+	app.ChangePassword(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// authorized - запрос через AuthMiddleware с токеном token
+func authorized(app *App, token string) int {
+	r := gin.New()
+	r.GET("/records", auth.AuthMiddleware(app.logger, app.checkSession), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set(auth.AuthorizationHeader, "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAccountAdministration(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		ctx := context.Background()
+		admin, ok := app.store.(store.UserAdmin)
+		require.True(t, ok)
+
+		w := login(app, "testuser", "testpassword")
+		require.Equal(t, http.StatusOK, w.Code)
+		var token models.TokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+		assert.Equal(t, http.StatusOK, authorized(app, token.Token))
+
+		users, err := admin.ListUsers(ctx)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.Equal(t, "testuser", users[0].Login)
+		assert.Equal(t, 1, users[0].Records)
+		assert.Positive(t, users[0].DataSize)
+		assert.NotNil(t, users[0].LastLoginAt)
+		assert.Equal(t, 0, users[1].Records)
+		assert.Nil(t, users[1].LastLoginAt)
+
+		require.NoError(t, admin.SetUserDisabled(ctx, 1, true))
+		assert.Equal(t, http.StatusForbidden, authorized(app, token.Token))
+		assert.Equal(t, http.StatusForbidden, login(app, "testuser", "testpassword").Code)
+		require.NoError(t, admin.SetUserDisabled(ctx, 1, false))
+		assert.Equal(t, http.StatusOK, authorized(app, token.Token))
+
+		require.NoError(t, admin.RevokeSessions(ctx, 1))
+		assert.Equal(t, http.StatusUnauthorized, authorized(app, token.Token), "token issued before forced logout")
+		w = login(app, "testuser", "testpassword")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+		assert.Equal(t, http.StatusOK, authorized(app, token.Token), "token issued right after forced logout")
+
+		require.NoError(t, admin.SetPassword(ctx, 1, "one-time"))
+		assert.Equal(t, http.StatusUnauthorized, login(app, "testuser", "testpassword").Code)
+		w = login(app, "testuser", "one-time")
+		assert.Equal(t, http.StatusForbidden, w.Code, "password set by administrator only allows a change")
+		assert.Contains(t, w.Body.String(), auth.ErrPasswordChangeRequired.Error())
+		assert.Equal(t, http.StatusBadRequest, changePassword(app, "testuser", "one-time", "one-time").Code)
+		assert.Equal(t, http.StatusUnauthorized, changePassword(app, "testuser", "wrong", "mine").Code)
+		assert.Equal(t, http.StatusNoContent, changePassword(app, "testuser", "one-time", "mine").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(app, "testuser", "one-time").Code)
+		assert.Equal(t, http.StatusOK, login(app, "testuser", "mine").Code)
+
+		assert.ErrorIs(t, admin.SetUserDisabled(ctx, 42, true), store.ErrNotFound)
+	})
+}
@@ -3,6 +3,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,34 +11,75 @@ import (
 	"errors"
 	"fmt"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/auditsink"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/certs"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/events"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/webhooks"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // App - структура приложения
 type App struct {
-	config *config.ServerConfig
-	store  store.Store
-	logger *zap.SugaredLogger
+	config  *config.ServerConfig
+	store   store.Store
+	logger  *zap.SugaredLogger
+	metrics *metrics.Metrics
+	// auditSinks - экспорт событий аудита во внешние приемники, nil - не настроен
+	auditSinks *auditsink.Dispatcher
+	// webhooks - доставка событий вебхукам из очереди, запускается RunWebhooks
+	webhooks *webhooks.Deliverer
+	// events - рассылка событий записей подключенным клиентам, между репликами - через RunEvents
+	events *events.Hub
+	// deviceCA - CA для подписи сертификатов устройств, загружается при включенном mTLS
+	deviceCA *certs.Authority
+	// quota - квоты по умолчанию, меняются Reload
+	quota atomic.Pointer[models.Quota]
 }
 
 const (
 	maxExpiresIn = 3600 * 24 * 30
 )
 
-// NewApp - конструктор приложения
-func NewApp(config *config.ServerConfig, store store.Store, logger *zap.SugaredLogger) *App {
-	return &App{
-		config: config,
-		store:  store,
-		logger: logger,
+// NewApp - конструктор приложения. metrics и auditSinks могут быть nil.
+func NewApp(config *config.ServerConfig, store store.Store, logger *zap.SugaredLogger, metrics *metrics.Metrics,
+	auditSinks *auditsink.Dispatcher) *App {
+	a := &App{
+		config:     config,
+		store:      store,
+		logger:     logger,
+		metrics:    metrics,
+		auditSinks: auditSinks,
+		webhooks:   webhooks.NewDeliverer(store, logger.Named("webhooks"), metrics, webhookOptions(config)),
+		events:     newEventHub(store, logger.Named("events"), metrics),
 	}
+	quota := config.Quota()
+	a.quota.Store(&quota)
+	return a
+}
+
+// Reload - применение квот по умолчанию и настроек доставки вебхуков из новой конфигурации без перезапуска.
+// Остальные настройки c не применяются.
+func (a *App) Reload(c *config.ServerConfig) {
+	quota := c.Quota()
+	a.quota.Store(&quota)
+	a.webhooks.SetOptions(webhookOptions(c))
+}
+
+// webhookOptions - настройки доставки вебхуков из конфигурации
+func webhookOptions(c *config.ServerConfig) webhooks.Options {
+	return webhooks.Options{MaxAttempts: c.WebhookMaxAttempts, AllowPrivate: c.WebhookAllowPrivate}
 }
 
 // NewServer - конструктор сервера
@@ -46,30 +88,24 @@ func (a *App) NewServer() (*http.Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error init router: %w", err)
 	}
-	return &http.Server{
+	srv := &http.Server{
 		Addr:    a.config.RunAddr,
 		Handler: r,
-	}, nil
-}
-
-// RecordNotFoundError - ошибка запись не найдена в БД
-type RecordNotFoundError struct {
-	Message string
-}
-
-// Error - возвращает ошибку
-func (e *RecordNotFoundError) Error() string {
-	return e.Message
+	}
+	// потоки событий не завершаются сами, без этого Shutdown ждал бы их до таймаута
+	srv.RegisterOnShutdown(a.events.Close)
+	return srv, nil
 }
 
 // Login - логин пользователя
 func (a *App) Login(c *gin.Context) {
-	a.logger.Info("/api/user/login")
+	l := requestid.Logger(c, a.logger)
+	l.Info("/api/user/login")
 	req := c.Request
 	res := c.Writer
 	userCreds := models.User{}
 	if err := json.NewDecoder(req.Body).Decode(&userCreds); err != nil {
-		a.logger.Debug("user credentials cannot be decoded: %v", zap.Error(err))
+		l.Debug("user credentials cannot be decoded: %v", zap.Error(err))
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -77,45 +113,137 @@ func (a *App) Login(c *gin.Context) {
 		Login:    userCreds.Login,
 		Password: userCreds.Password,
 	}
-	u, err := a.store.GetUser(c, &models.User{Login: userReq.Login})
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{Login: userReq.Login})
 	if err != nil {
-		if errors.Is(err, store.ErrLoginNotFound) {
-			a.logger.Debug("login not found: %v", zap.Error(err))
+		if errors.Is(err, store.ErrNotFound) {
+			l.Debug("login not found: %v", zap.Error(err))
+			a.metrics.LoginAttempt(false)
+			a.audit(c, models.AuditEvent{Action: models.AuditLoginFailure, Details: "unknown login " + userReq.Login})
 			res.WriteHeader(http.StatusUnauthorized)
 			return
 		} else {
-			a.logger.Debug("cannot get user: %v", zap.Error(err))
+			l.Debug("cannot get user: %v", zap.Error(err))
 			res.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 	ok := verifyPassword(userReq.Password, u.Password)
 	if !ok {
-		a.logger.Debug("cannot verifyPassword: %v", zap.Error(err))
+		l.Debug("cannot verifyPassword: %v", zap.Error(err))
+		a.metrics.LoginAttempt(false)
+		a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditLoginFailure, Details: "wrong password"})
 		res.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if u.DisabledAt != nil {
+		l.Infow("login of disabled user", "user_id", u.ID)
+		a.metrics.LoginAttempt(false)
+		a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditLoginFailure, Details: "account disabled"})
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: auth.ErrUserDisabled.Error(), RequestID: requestid.Get(c)})
+		return
+	}
+	if u.MustChangePassword {
+		l.Infow("login with password set by administrator", "user_id", u.ID)
+		a.metrics.LoginAttempt(false)
+		a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditLoginFailure, Details: "password change required"})
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: auth.ErrPasswordChangeRequired.Error(),
+			RequestID: requestid.Get(c)})
+		return
+	}
 	userReq.ID = u.ID
+	if err := a.store.RecordLogin(c.Request.Context(), u.ID); err != nil {
+		l.Warnw("cannot record last login", zap.Error(err))
+	}
 	jwt, err := auth.BuildJWTString(userReq.ID)
 	if err != nil {
-		a.logger.Debug("cannot build jwt string for authorized user: %v", zap.Error(err))
+		l.Debug("cannot build jwt string for authorized user: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	a.metrics.LoginAttempt(true)
+	a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditLoginSuccess})
+	a.notify(c, u.ID, models.WebhookAccountLogin, models.WebhookPayload{})
 	c.JSON(http.StatusOK, models.TokenResponse{
 		Token:     jwt,
 		ExpiresIn: maxExpiresIn,
 	})
 }
 
+// ChangePassword - смена пароля по текущему, в том числе по паролю, заданному администратором
+func (a *App) ChangePassword(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/api/user/password")
+	res := c.Writer
+	var req models.PasswordChangeRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		l.Debugw("password change cannot be decoded", zap.Error(err))
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == "" || req.NewPassword == req.Password {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "new password must be set and differ from the current one",
+			RequestID: requestid.Get(c)})
+		return
+	}
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{Login: req.Login})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			a.metrics.LoginAttempt(false)
+			a.audit(c, models.AuditEvent{Action: models.AuditLoginFailure, Details: "unknown login " + req.Login})
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		l.Errorw("cannot get user", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !verifyPassword(req.Password, u.Password) {
+		a.metrics.LoginAttempt(false)
+		a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditLoginFailure, Details: "wrong password"})
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if u.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: auth.ErrUserDisabled.Error(), RequestID: requestid.Get(c)})
+		return
+	}
+	if err := a.store.ChangePassword(c.Request.Context(), u.ID, req.NewPassword); err != nil {
+		l.Errorw("cannot change password", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.audit(c, models.AuditEvent{UserID: u.ID, Action: models.AuditPasswordChange})
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// checkSession - проверка для auth.AuthMiddleware: учетная запись существует и не заблокирована,
+// токен выдан после последнего принудительного выхода
+func (a *App) checkSession(ctx context.Context, userID uint64, issuedAt time.Time) error {
+	u, err := a.store.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return auth.ErrTokenNotValid
+		}
+		return err
+	}
+	if u.DisabledAt != nil {
+		return auth.ErrUserDisabled
+	}
+	if u.SessionsRevokedAt != nil && auth.IssuedBefore(issuedAt, *u.SessionsRevokedAt) {
+		return auth.ErrSessionRevoked
+	}
+	return nil
+}
+
 // Register - регистрация пользователя
 func (a *App) Register(c *gin.Context) {
-	a.logger.Info("/api/user/register")
+	l := requestid.Logger(c, a.logger)
+	l.Info("/api/user/register")
 	req := c.Request
 	res := c.Writer
 	userCreds := models.User{}
 	if err := json.NewDecoder(req.Body).Decode(&userCreds); err != nil {
-		a.logger.Debug("body cannot be decoded: %v", zap.Error(err))
+		l.Debug("body cannot be decoded: %v", zap.Error(err))
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -123,25 +251,25 @@ func (a *App) Register(c *gin.Context) {
 		Login:    userCreds.Login,
 		Password: userCreds.Password,
 	}
-	if _, err := a.store.CreateUser(c, &userReq); err != nil {
-		if errors.Is(err, store.ErrDuplicateLogin) {
-			a.logger.Debug("login already taken: %v", zap.Error(err))
+	if _, err := a.store.CreateUser(c.Request.Context(), &userReq); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			l.Debug("login already taken: %v", zap.Error(err))
 			res.WriteHeader(http.StatusConflict)
 			return
 		} else {
-			a.logger.Debug("cannot operate user creds: %v", zap.Error(err))
+			l.Debug("cannot operate user creds: %v", zap.Error(err))
 			res.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 	if err := os.MkdirAll(fmt.Sprintf("./userdata/%s-%d/", userReq.Login, userReq.ID), 0700); err != nil {
-		a.logger.Debug("cannot create user folder: %v", zap.Error(err))
+		l.Debug("cannot create user folder: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	jwt, err := auth.BuildJWTString(userReq.ID)
 	if err != nil {
-		a.logger.Debug("cannot build jwt string: %v", zap.Error(err))
+		l.Debug("cannot build jwt string: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -151,34 +279,35 @@ func (a *App) Register(c *gin.Context) {
 	})
 }
 
-// PutDataRecord - запись данных
+// PutDataRecord - запись данных.
+// С заголовком Idempotency-Key повтор запроса возвращает уже созданную им запись вместо 409.
 func (a *App) PutDataRecord(c *gin.Context) {
-	a.logger.Info("/")
+	l := requestid.Logger(c, a.logger)
+	l.Info("/")
 	userID := c.GetUint64(auth.UserIDKey.ToString())
-	req := c.Request
 	res := c.Writer
 	if userID == 0 {
-		a.logger.Debug("user unauthorized")
+		l.Debug("user unauthorized")
 		res.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	var record models.DataRecordRequest
-	if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
-		a.logger.Debug("cannot decode body: %w", zap.Error(err))
-		res.WriteHeader(http.StatusBadRequest)
+	record, ok := decodeRecord(c, l)
+	if !ok {
 		return
 	}
-	parts := bytes.Split([]byte(record.Data), []byte(":"))
-	if len(parts) <= 1 {
-		a.logger.Debug("cannot parts <= 1")
-		res.WriteHeader(http.StatusBadRequest)
+	k, ok := idempotencyKey(c, l, userID, record)
+	if !ok {
 		return
 	}
-	if record.Type == models.PASS || record.Type == models.TEXT {
-		checksum := fmt.Sprintf("%x", md5.Sum([]byte(record.Data)))
-		if record.Checksum != checksum {
-			a.logger.Debug("wrong checksum from request, corrupted data")
-			res.WriteHeader(http.StatusBadRequest)
+	used, err := a.idempotencyKeyUsed(c.Request.Context(), k)
+	if err != nil {
+		l.Errorw("cannot check idempotency key", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !used {
+		if err := a.checkQuota(c.Request.Context(), userID, int64(len(record.Data)), nil); err != nil {
+			a.quotaError(c, l, err)
 			return
 		}
 	}
@@ -195,58 +324,244 @@ func (a *App) PutDataRecord(c *gin.Context) {
 	if record.ID != 0 {
 		data.ID = record.ID
 	}
-	if err := a.store.PutDataRecord(c, data); err != nil {
-		a.logger.Debug("unhandled error: %v", zap.Error(err))
+	replayed := false
+	if k == nil {
+		err = a.store.PutDataRecord(c.Request.Context(), data)
+	} else {
+		replayed, err = a.store.PutDataRecordOnce(c.Request.Context(), data, k)
+	}
+	if err != nil {
+		if replayed && replayError(c, l, err) {
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			l.Debug("record name already taken: %v", zap.Error(err))
+			res.WriteHeader(http.StatusConflict)
+			return
+		}
+		l.Debug("unhandled error: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if replayed {
+		// запись уже создана этим запросом: события и метрики создания не повторяются
+		l.Debugw("idempotent request replayed", "record_id", data.ID)
+		c.Header(models.IdempotentReplayedHeader, "true")
+		c.JSON(http.StatusCreated, data)
+		return
+	}
+	a.metrics.RecordsCreated(1)
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditRecordCreate, RecordID: data.ID})
+	a.notify(c, userID, models.WebhookRecordCreated, models.WebhookPayload{RecordID: data.ID, RecordType: data.Type})
+	a.publish(c, models.RecordEvent{Type: models.RecordCreated, UserID: userID, RecordID: data.ID, RecordType: data.Type})
 	c.JSON(http.StatusCreated, data)
 }
 
+// UpdateDataRecord - замена содержимого записи с названием из пути
+func (a *App) UpdateDataRecord(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/:name")
+	recordName := c.Param("name")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	record, ok := decodeRecord(c, l)
+	if !ok {
+		return
+	}
+	ifVersion, ok := ifMatchVersion(c, l)
+	if !ok {
+		return
+	}
+	if record.Name != "" && record.Name != recordName {
+		l.Debug("record name in body differs from path")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	current, err := a.store.GetUserRecord(c.Request.Context(), recordName, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Errorw("error getting user record", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if err := a.checkQuota(c.Request.Context(), userID, int64(len(record.Data)), current); err != nil {
+		a.quotaError(c, l, err)
+		return
+	}
+	data := &models.DataRecord{
+		UploadedAt: time.Now(),
+		Type:       record.Type,
+		Checksum:   fmt.Sprintf("%x", md5.Sum([]byte(record.Data))),
+		Data:       record.Data,
+		UserID:     userID,
+		Name:       recordName,
+		Key:        record.Key,
+	}
+	if err := a.store.UpdateDataRecord(c.Request.Context(), data, ifVersion); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrVersionMismatch) {
+			versionMismatch(c, l, ifVersion)
+			return
+		}
+		l.Errorw("error updating user record", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.RecordsUpdated(1)
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditRecordUpdate, RecordID: data.ID})
+	a.notify(c, userID, models.WebhookRecordUpdated, models.WebhookPayload{RecordID: data.ID, RecordType: data.Type})
+	a.publish(c, models.RecordEvent{Type: models.RecordUpdated, UserID: userID, RecordID: data.ID, RecordType: data.Type})
+	c.JSON(http.StatusOK, data)
+}
+
+// DeleteDataRecord - удаление записи с названием из пути
+func (a *App) DeleteDataRecord(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/:name")
+	recordName := c.Param("name")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	ifVersion, ok := ifMatchVersion(c, l)
+	if !ok {
+		return
+	}
+	t, err := a.store.DeleteDataRecord(c.Request.Context(), userID, recordName, ifVersion)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrVersionMismatch) {
+			versionMismatch(c, l, ifVersion)
+			return
+		}
+		l.Errorw("error deleting user record", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.RecordsDeleted(1)
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditRecordDelete, RecordID: t.RecordID})
+	a.notify(c, userID, models.WebhookRecordDeleted, models.WebhookPayload{RecordID: t.RecordID, RecordType: t.Type})
+	a.publish(c, models.RecordEvent{Type: models.RecordDeleted, UserID: userID, RecordID: t.RecordID, RecordType: t.Type})
+	c.Status(http.StatusNoContent)
+}
+
+// decodeRecord - чтение записи из тела запроса с проверкой формата данных и контрольной суммы.
+// false - запрос некорректен, ответ 400 уже отправлен.
+func decodeRecord(c *gin.Context, l *zap.SugaredLogger) (*models.DataRecordRequest, bool) {
+	var record models.DataRecordRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&record); err != nil {
+		l.Debug("cannot decode body: %w", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return nil, false
+	}
+	parts := bytes.Split([]byte(record.Data), []byte(":"))
+	if len(parts) <= 1 {
+		l.Debug("cannot parts <= 1")
+		c.Status(http.StatusBadRequest)
+		return nil, false
+	}
+	if record.Type == models.PASS || record.Type == models.TEXT {
+		checksum := fmt.Sprintf("%x", md5.Sum([]byte(record.Data)))
+		if record.Checksum != checksum {
+			l.Debug("wrong checksum from request, corrupted data")
+			c.Status(http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return &record, true
+}
+
+// ifMatchVersion - версия записи из заголовка If-Match, 0 - заголовка нет.
+// При некорректном значении ответ 400 уже отправлен и ok = false.
+func ifMatchVersion(c *gin.Context, l *zap.SugaredLogger) (version uint64, ok bool) {
+	value := c.GetHeader(models.IfMatchHeader)
+	if value == "" {
+		return 0, true
+	}
+	version, err := strconv.ParseUint(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version == 0 {
+		l.Debug("invalid If-Match header")
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:     "invalid " + models.IfMatchHeader + " header, record version expected",
+			RequestID: requestid.Get(c),
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+// versionMismatch - ответ 412: запись изменена после версии ifVersion
+func versionMismatch(c *gin.Context, l *zap.SugaredLogger, ifVersion uint64) {
+	l.Debugw("record version mismatch", "if_version", ifVersion)
+	c.JSON(http.StatusPreconditionFailed, models.ErrorResponse{
+		Error:     fmt.Sprintf("record was changed after version %d", ifVersion),
+		RequestID: requestid.Get(c),
+	})
+}
+
 // GetDataRecord - получение записи
 func (a *App) GetDataRecord(c *gin.Context) {
-	a.logger.Info("/:name")
+	l := requestid.Logger(c, a.logger)
+	l.Info("/:name")
 	res := c.Writer
 	recordName := c.Param("name")
 	userID := c.GetUint64(auth.UserIDKey.ToString())
 	if userID == 0 {
-		a.logger.Debug("user unauthorized")
+		l.Debug("user unauthorized")
 		res.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	record, err := a.store.GetUserRecord(c, recordName, userID)
+	record, err := a.store.GetUserRecord(c.Request.Context(), recordName, userID)
 	if err != nil {
-		var recordNotFoundError *RecordNotFoundError
-		if errors.As(err, &recordNotFoundError) {
+		if errors.Is(err, store.ErrNotFound) {
 			res.WriteHeader(http.StatusNotFound)
 			return
 		}
-		a.logger.Debug("error getting user record: %v", zap.Error(err))
+		l.Debug("error getting user record: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	a.metrics.RecordsFetched(1)
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditRecordRead, RecordID: record.ID})
 	c.JSON(http.StatusOK, record)
 }
 
 // GetDataRecords - получение записей пользователя
 func (a *App) GetDataRecords(c *gin.Context) {
-	a.logger.Info("/list")
+	l := requestid.Logger(c, a.logger)
+	l.Info("/list")
 	userID := c.GetUint64(auth.UserIDKey.ToString())
 	res := c.Writer
 	if userID == 0 {
 		res.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	records, err := a.store.GetUserRecords(c, userID)
+	records, err := a.store.GetUserRecords(c.Request.Context(), userID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoData) {
 			res.WriteHeader(http.StatusNoContent)
 			return
 		}
-		a.logger.Debug("error getting user records: %v", zap.Error(err))
+		l.Debug("error getting user records: %v", zap.Error(err))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	a.metrics.RecordsFetched(len(records))
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditRecordList,
+		Details: fmt.Sprintf("%d records", len(records))})
 	c.JSON(http.StatusOK, records)
 }
 
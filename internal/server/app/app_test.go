@@ -2,275 +2,312 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
-func TestRegister(t *testing.T) {
-	l, _ := logger.NewLogger()
-	c, err := config.Load(l)
-	if err != nil {
-		fmt.Errorf("failed config load: %w", err)
-		return
-	}
-	conn, err := store.NewPostgresConnection(c)
-	if err != nil {
-		fmt.Errorf("failed new postgres connection: %w", err)
-		return
+// testStores - хранилища, на которых прогоняется весь набор тестов приложения
+var testStores = map[string]func(t *testing.T) store.Store{
+	"memory": func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	},
+	"sqlite": func(t *testing.T) store.Store {
+		return openSQLiteStore(t, &config.ServerConfig{})
+	},
+	"sqlite-encrypted": func(t *testing.T) store.Store {
+		return openSQLiteStore(t, &config.ServerConfig{KEK: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	},
+}
+
+// openSQLiteStore - хранилище SQLite во временной директории с примененными миграциями
+func openSQLiteStore(t *testing.T, c *config.ServerConfig) store.Store {
+	c.DatabaseDSN = "sqlite://" + filepath.Join(t.TempDir(), "gophkeeper.db")
+	s, err := store.Open(context.Background(), c)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	m, err := s.(store.Migratable).Migrator()
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+	return s
+}
+
+// forEachStore - запускает тест для каждого хранилища из testStores
+func forEachStore(t *testing.T, test func(t *testing.T, app *App)) {
+	for name, newStore := range testStores {
+		t.Run(name, func(t *testing.T) {
+			test(t, newTestApp(t, newStore(t)))
+		})
 	}
-	app := NewApp(&config.ServerConfig{}, store.NewStore(conn), l)
-	testCases := []struct {
-		name           string
-		requestBody    models.User
-		expectedStatus int
-	}{
-		{
-			name: "Successful user registration",
-			requestBody: models.User{
-				Login:    "testuser",
-				Password: "testpassword",
+}
+
+// newTestApp - создает приложение поверх хранилища с тестовыми данными:
+// пользователи testuser (ID 1, с записью testrecord) и duplicateuser (ID 2, без записей).
+// Рабочая директория переключается во временную, чтобы не засорять репозиторий папками userdata.
+func newTestApp(t *testing.T, s store.Store) *App {
+	t.Helper()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	l, err := logger.NewLogger()
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = s.CreateUser(ctx, &models.User{Login: "testuser", Password: "testpassword"})
+	require.NoError(t, err)
+	_, err = s.CreateUser(ctx, &models.User{Login: "duplicateuser", Password: "testpassword"})
+	require.NoError(t, err)
+	require.NoError(t, s.PutDataRecord(ctx, &models.DataRecord{
+		UploadedAt: time.Now(),
+		Type:       models.TEXT,
+		Data:       "test:data",
+		Name:       "testrecord",
+		UserID:     1,
+	}))
+	return NewApp(&config.ServerConfig{}, s, l, nil, nil)
+}
+
+func TestRegister(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		testCases := []struct {
+			name           string
+			requestBody    models.User
+			expectedStatus int
+		}{
+			{
+				name: "Successful user registration",
+				requestBody: models.User{
+					Login:    "newuser",
+					Password: "testpassword",
+				},
+				expectedStatus: http.StatusCreated,
 			},
-			expectedStatus: http.StatusCreated,
-		},
-		{
-			name: "Duplicate login error",
-			requestBody: models.User{
-				Login:    "duplicateuser",
-				Password: "testpassword",
+			{
+				name: "Duplicate login error",
+				requestBody: models.User{
+					Login:    "duplicateuser",
+					Password: "testpassword",
+				},
+				expectedStatus: http.StatusConflict,
 			},
-			expectedStatus: http.StatusConflict,
-		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			reqBody, _ := json.Marshal(tc.requestBody)
-			req, _ := http.NewRequest("POST", "/api/user/register", bytes.NewBuffer(reqBody))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request = req
-			app.Register(c)
-			assert.Equal(t, tc.expectedStatus, w.Code)
-		})
-	}
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				reqBody, _ := json.Marshal(tc.requestBody)
+				req, _ := http.NewRequest("POST", "/api/user/register", bytes.NewBuffer(reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = req
+				app.Register(c)
+				c.Writer.WriteHeaderNow()
+				assert.Equal(t, tc.expectedStatus, w.Code)
+			})
+		}
+	})
 }
 
 func TestLogin(t *testing.T) {
-	l, _ := logger.NewLogger()
-	c, err := config.Load(l)
-	if err != nil {
-		fmt.Errorf("failed config load: %w", err)
-		return
-	}
-	conn, err := store.NewPostgresConnection(c)
-	if err != nil {
-		fmt.Errorf("failed new postgres connection: %w", err)
-		return
-	}
-	app := NewApp(&config.ServerConfig{}, store.NewStore(conn), l)
-	testCases := []struct {
-		name           string
-		requestBody    models.User
-		expectedStatus int
-	}{
-		{
-			name: "Successful login",
-			requestBody: models.User{
-				Login:    "testuser",
-				Password: "testpassword",
+	forEachStore(t, func(t *testing.T, app *App) {
+		testCases := []struct {
+			name           string
+			requestBody    models.User
+			expectedStatus int
+		}{
+			{
+				name: "Successful login",
+				requestBody: models.User{
+					Login:    "testuser",
+					Password: "testpassword",
+				},
+				expectedStatus: http.StatusOK,
 			},
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name: "Incorrect credentials",
-			requestBody: models.User{
-				Login:    "testuser",
-				Password: "wrongpassword",
+			{
+				name: "Incorrect credentials",
+				requestBody: models.User{
+					Login:    "testuser",
+					Password: "wrongpassword",
+				},
+				expectedStatus: http.StatusUnauthorized,
 			},
-			expectedStatus: http.StatusUnauthorized,
-		},
-		{
-			name: "Login not found",
-			requestBody: models.User{
-				Login:    "nonexistentuser",
-				Password: "testpassword",
+			{
+				name: "Login not found",
+				requestBody: models.User{
+					Login:    "nonexistentuser",
+					Password: "testpassword",
+				},
+				expectedStatus: http.StatusUnauthorized,
 			},
-			expectedStatus: http.StatusUnauthorized,
-		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			reqBody, _ := json.Marshal(tc.requestBody)
-			req, _ := http.NewRequest("POST", "/api/user/login", bytes.NewBuffer(reqBody))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request = req
-			app.Login(c)
-			assert.Equal(t, tc.expectedStatus, w.Code)
-		})
-	}
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				reqBody, _ := json.Marshal(tc.requestBody)
+				req, _ := http.NewRequest("POST", "/api/user/login", bytes.NewBuffer(reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = req
+				app.Login(c)
+				c.Writer.WriteHeaderNow()
+				assert.Equal(t, tc.expectedStatus, w.Code)
+			})
+		}
+	})
 }
 
 func TestPutDataRecord(t *testing.T) {
-	l, _ := logger.NewLogger()
-	c, err := config.Load(l)
-	if err != nil {
-		fmt.Errorf("failed config load: %w", err)
-		return
-	}
-	conn, err := store.NewPostgresConnection(c)
-	if err != nil {
-		fmt.Errorf("failed new postgres connection: %w", err)
-		return
-	}
-	app := NewApp(&config.ServerConfig{}, store.NewStore(conn), l)
-	testCases := []struct {
-		name           string
-		requestBody    models.DataRecordRequest
-		expectedStatus int
-	}{
-		{
-			name: "Successful data record creation",
-			requestBody: models.DataRecordRequest{
-				Type:     models.TEXT,
-				Data:     "test:data",
-				Checksum: "94ee059335e587e501cc4bf90613e081",
-				Name:     "Test Record",
+	forEachStore(t, func(t *testing.T, app *App) {
+		testCases := []struct {
+			name           string
+			requestBody    models.DataRecordRequest
+			expectedStatus int
+		}{
+			{
+				name: "Successful data record creation",
+				requestBody: models.DataRecordRequest{
+					Type:     models.TEXT,
+					Data:     "test:data",
+					Checksum: "6681a96ff3ec7263ba55963bc91f5c72",
+					Name:     "Test Record",
+				},
+				expectedStatus: http.StatusCreated,
 			},
-			expectedStatus: http.StatusCreated,
-		},
-		{
-			name: "Invalid checksum",
-			requestBody: models.DataRecordRequest{
-				Type:     models.TEXT,
-				Data:     "test:data",
-				Checksum: "invalid_checksum",
-				Name:     "Test Record",
+			{
+				name: "Invalid checksum",
+				requestBody: models.DataRecordRequest{
+					Type:     models.TEXT,
+					Data:     "test:data",
+					Checksum: "invalid_checksum",
+					Name:     "Test Record",
+				},
+				expectedStatus: http.StatusBadRequest,
 			},
-			expectedStatus: http.StatusBadRequest,
-		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			reqBody, _ := json.Marshal(tc.requestBody)
-			req, _ := http.NewRequest("POST", "/data-record", bytes.NewBuffer(reqBody))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request = req
-			c.Set("userID", uint64(1))
-			app.PutDataRecord(c)
-			assert.Equal(t, tc.expectedStatus, w.Code)
-		})
-	}
+			{
+				name: "Duplicate record name",
+				requestBody: models.DataRecordRequest{
+					Type:     models.TEXT,
+					Data:     "test:data",
+					Checksum: "6681a96ff3ec7263ba55963bc91f5c72",
+					Name:     "testrecord",
+				},
+				expectedStatus: http.StatusConflict,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				reqBody, _ := json.Marshal(tc.requestBody)
+				req, _ := http.NewRequest("POST", "/data-record", bytes.NewBuffer(reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = req
+				c.Set(auth.UserIDKey.ToString(), uint64(1))
+				app.PutDataRecord(c)
+				c.Writer.WriteHeaderNow()
+				assert.Equal(t, tc.expectedStatus, w.Code)
+			})
+		}
+	})
 }
 
 func TestGetDataRecord(t *testing.T) {
-	l, _ := logger.NewLogger()
-	c, err := config.Load(l)
-	if err != nil {
-		fmt.Errorf("failed config load: %w", err)
-		return
-	}
-	conn, err := store.NewPostgresConnection(c)
-	if err != nil {
-		fmt.Errorf("failed new postgres connection: %w", err)
-		return
-	}
-	app := NewApp(&config.ServerConfig{}, store.NewStore(conn), l)
-	testCases := []struct {
-		name           string
-		requestPath    string
-		userID         uint64
-		expectedStatus int
-	}{
-		{
-			name:           "Successful data record retrieval",
-			requestPath:    "/testrecord",
-			userID:         1,
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Unauthorized access",
-			requestPath:    "/testrecord",
-			userID:         0,
-			expectedStatus: http.StatusUnauthorized,
-		},
-		{
-			name:           "Record not found",
-			requestPath:    "/nonexistentrecord",
-			userID:         1,
-			expectedStatus: http.StatusNotFound,
-		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			req, _ := http.NewRequest("GET", tc.requestPath, nil)
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request = req
-			c.Set("userID", tc.userID)
-			app.GetDataRecord(c)
-			assert.Equal(t, tc.expectedStatus, w.Code)
-		})
-	}
+	forEachStore(t, func(t *testing.T, app *App) {
+		testCases := []struct {
+			name           string
+			recordName     string
+			userID         uint64
+			expectedStatus int
+		}{
+			{
+				name:           "Successful data record retrieval",
+				recordName:     "testrecord",
+				userID:         1,
+				expectedStatus: http.StatusOK,
+			},
+			{
+				name:           "Unauthorized access",
+				recordName:     "testrecord",
+				userID:         0,
+				expectedStatus: http.StatusUnauthorized,
+			},
+			{
+				name:           "Record not found",
+				recordName:     "nonexistentrecord",
+				userID:         1,
+				expectedStatus: http.StatusNotFound,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req, _ := http.NewRequest("GET", "/"+tc.recordName, nil)
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = req
+				c.Params = gin.Params{{Key: "name", Value: tc.recordName}}
+				c.Set(auth.UserIDKey.ToString(), tc.userID)
+				app.GetDataRecord(c)
+				c.Writer.WriteHeaderNow()
+				assert.Equal(t, tc.expectedStatus, w.Code)
+			})
+		}
+	})
 }
 
 func TestGetDataRecords(t *testing.T) {
-	l, _ := logger.NewLogger()
-	c, err := config.Load(l)
-	if err != nil {
-		fmt.Errorf("failed config load: %w", err)
-		return
-	}
-	conn, err := store.NewPostgresConnection(c)
-	if err != nil {
-		fmt.Errorf("failed new postgres connection: %w", err)
-		return
-	}
-	app := NewApp(&config.ServerConfig{}, store.NewStore(conn), l)
-	testCases := []struct {
-		name           string
-		userID         uint64
-		expectedStatus int
-	}{
-		{
-			name:           "Successful data records retrieval",
-			userID:         1,
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Unauthorized access",
-			userID:         0,
-			expectedStatus: http.StatusUnauthorized,
-		},
-		{
-			name:           "No data found",
-			userID:         2,
-			expectedStatus: http.StatusNoContent,
-		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			req, _ := http.NewRequest("GET", "/list", nil)
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request = req
-			c.Set("userID", tc.userID)
-			app.GetDataRecords(c)
-			assert.Equal(t, tc.expectedStatus, w.Code)
-		})
-	}
+	forEachStore(t, func(t *testing.T, app *App) {
+		testCases := []struct {
+			name           string
+			userID         uint64
+			expectedStatus int
+		}{
+			{
+				name:           "Successful data records retrieval",
+				userID:         1,
+				expectedStatus: http.StatusOK,
+			},
+			{
+				name:           "Unauthorized access",
+				userID:         0,
+				expectedStatus: http.StatusUnauthorized,
+			},
+			{
+				name:           "No data found",
+				userID:         2,
+				expectedStatus: http.StatusNoContent,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req, _ := http.NewRequest("GET", "/list", nil)
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = req
+				c.Set(auth.UserIDKey.ToString(), tc.userID)
+				app.GetDataRecords(c)
+				c.Writer.WriteHeaderNow()
+				assert.Equal(t, tc.expectedStatus, w.Code)
+			})
+		}
+	})
 }
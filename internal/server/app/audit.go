@@ -0,0 +1,65 @@
+// Модуль журнала аудита
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultAuditPageSize - размер страницы журнала аудита по умолчанию
+	defaultAuditPageSize = 50
+	// maxAuditPageSize - максимальный размер страницы журнала аудита
+	maxAuditPageSize = 500
+)
+
+// audit - запись события в журнал аудита с IP и User-Agent запроса и отправка во внешние приемники.
+// Ошибка записи не прерывает запрос, а попадает в лог; событие все равно экспортируется.
+func (a *App) audit(c *gin.Context, e models.AuditEvent) {
+	e.IP = c.ClientIP()
+	e.UserAgent = c.Request.UserAgent()
+	if err := a.store.AppendAuditEvent(c.Request.Context(), &e); err != nil {
+		requestid.Logger(c, a.logger).Errorw("cannot write audit event", "action", e.Action, zap.Error(err))
+	}
+	a.auditSinks.Publish(&e)
+}
+
+// GetAuditEvents - журнал аудита пользователя от новых событий к старым.
+// Параметры: before - ID события, с которого начинается страница (из next_before), limit - размер страницы.
+func (a *App) GetAuditEvents(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/audit")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	before, err := strconv.ParseUint(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || limit <= 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxAuditPageSize)
+	events, err := a.store.ListAuditEvents(c.Request.Context(), userID, before, limit)
+	if err != nil {
+		l.Errorw("error listing audit events", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	page := models.AuditPage{Events: events}
+	if len(events) == limit {
+		page.NextBefore = events[len(events)-1].ID
+	}
+	c.JSON(http.StatusOK, page)
+}
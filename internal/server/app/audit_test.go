@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getAudit - вызов GetAuditEvents от имени пользователя userID с параметрами query
+func getAudit(t *testing.T, app *App, userID uint64, query string) models.AuditPage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/user/audit?"+query, nil)
+	c.Request.Header.Set("User-Agent", "audit-test")
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.GetAuditEvents(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page models.AuditPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+// actions - действия событий журнала
+func actions(events []models.AuditEvent) []string {
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.Action)
+	}
+	return result
+}
+
+func TestAuditLog(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		require.Equal(t, http.StatusUnauthorized, login(app, "duplicateuser", "wrong").Code)
+		require.Equal(t, http.StatusUnauthorized, login(app, "nobody", "wrong").Code)
+		require.Equal(t, http.StatusOK, login(app, "duplicateuser", "testpassword").Code)
+		w := putRecord(app, 2, "audited", "a:1")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var record models.DataRecord
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+
+		page := getAudit(t, app, 2, "")
+		assert.Equal(t, []string{models.AuditRecordCreate, models.AuditLoginSuccess, models.AuditLoginFailure},
+			actions(page.Events), "events of other users are not listed")
+		assert.Zero(t, page.NextBefore)
+		assert.Equal(t, record.ID, page.Events[0].RecordID)
+		assert.Equal(t, "wrong password", page.Events[2].Details)
+
+		page = getAudit(t, app, 2, "limit=2")
+		require.Len(t, page.Events, 2)
+		assert.Equal(t, page.Events[1].ID, page.NextBefore)
+		page = getAudit(t, app, 2, "limit=2&before="+strconv.FormatUint(page.NextBefore, 10))
+		assert.Equal(t, []string{models.AuditLoginFailure}, actions(page.Events))
+
+		count, last, err := store.VerifyAuditChain(context.Background(), app.store.(store.UserAdmin))
+		require.NoError(t, err)
+		assert.Equal(t, 4, count, "unknown login is logged without a user")
+		assert.Equal(t, models.AuditRecordCreate, last.Action)
+	})
+}
+
+func TestGetAuditEvents_BadRequest(t *testing.T) {
+	app := newTestApp(t, store.NewMemoryStore())
+	for _, query := range []string{"limit=0", "limit=x", "before=-1"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/user/audit?"+query, nil)
+		c.Set(auth.UserIDKey.ToString(), uint64(1))
+		app.GetAuditEvents(c)
+		c.Writer.WriteHeaderNow()
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestAuditClientIP(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trustedProxies string
+		expectedIP     string
+	}{
+		{name: "forwarded header is ignored by default", expectedIP: "192.0.2.1"},
+		{name: "forwarded header from trusted proxy", trustedProxies: "192.0.2.0/24", expectedIP: "203.0.113.7"},
+		{name: "forwarded header from other address", trustedProxies: "10.0.0.1", expectedIP: "192.0.2.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newTestApp(t, store.NewMemoryStore())
+			app.config.TrustedProxies = tc.trustedProxies
+			router, err := app.SetupRouter()
+			require.NoError(t, err)
+			body, _ := json.Marshal(models.User{Login: "testuser", Password: "testpassword"})
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(body))
+			req.RemoteAddr = "192.0.2.1:40000"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			page := getAudit(t, app, 1, "")
+			require.NotEmpty(t, page.Events)
+			assert.Equal(t, tc.expectedIP, page.Events[0].IP)
+		})
+	}
+}
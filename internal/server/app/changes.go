@@ -0,0 +1,98 @@
+// Модуль разностной синхронизации записей
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultChangesPageSize - размер страницы изменений записей по умолчанию
+	defaultChangesPageSize = 500
+	// maxChangesPageSize - максимальный размер страницы изменений записей
+	maxChangesPageSize = 1000
+	// defaultTombstoneTTL - сколько хранятся следы удаления, если TOMBSTONE_TTL не задан
+	defaultTombstoneTTL = 90 * 24 * time.Hour
+	// tombstonePurgeInterval - как часто удаляются устаревшие следы удаления
+	tombstonePurgeInterval = time.Hour
+)
+
+// RunTombstonePurge - удаление устаревших следов удаления раз в tombstonePurgeInterval до отмены ctx
+func (a *App) RunTombstonePurge(ctx context.Context) {
+	ticker := time.NewTicker(tombstonePurgeInterval)
+	defer ticker.Stop()
+	for {
+		a.purgeTombstones(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTombstones - удаление следов удаления старше TOMBSTONE_TTL
+func (a *App) purgeTombstones(ctx context.Context) {
+	ttl := a.config.TombstoneTTL
+	if ttl == 0 {
+		ttl = defaultTombstoneTTL
+	}
+	n, err := a.store.PurgeTombstones(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		if ctx.Err() == nil {
+			a.logger.Errorw("cannot purge tombstones", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		a.logger.Infof("purged %d expired tombstones", n)
+	}
+}
+
+// GetRecordChanges - созданные, измененные и удаленные записи пользователя после курсора.
+// Параметры: since - cursor из предыдущего ответа (0 - все записи), limit - размер страницы.
+// 410 - курсор опережает изменения на сервере (например, после восстановления из резервной копии)
+// или следы удаления после него уже удалены: клиенту нужно начать с since=0.
+func (a *App) GetRecordChanges(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/changes")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultChangesPageSize)))
+	if err != nil || limit <= 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxChangesPageSize)
+	changes, err := a.store.GetRecordChanges(c.Request.Context(), userID, since, limit)
+	if err != nil {
+		if errors.Is(err, store.ErrStaleCursor) {
+			l.Infow("stale sync cursor", zap.Error(err))
+			c.JSON(http.StatusGone, models.ErrorResponse{Error: err.Error(), RequestID: requestid.Get(c)})
+			return
+		}
+		l.Errorw("error getting record changes", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.RecordsFetched(len(changes.Changes))
+	c.JSON(http.StatusOK, changes)
+}
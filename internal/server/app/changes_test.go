@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordRequest - вызов обработчика записи name от имени пользователя userID
+func recordRequest(app *App, handler gin.HandlerFunc, method string, userID uint64, name, data string) *httptest.ResponseRecorder {
+	return ifMatchRequest(app, handler, method, userID, name, data, "")
+}
+
+// ifMatchRequest - recordRequest с заголовком If-Match, пустой ifMatch - без заголовка
+func ifMatchRequest(app *App, handler gin.HandlerFunc, method string, userID uint64, name, data,
+	ifMatch string) *httptest.ResponseRecorder {
+	var body []byte
+	if data != "" {
+		body, _ = json.Marshal(models.DataRecordRequest{
+			Type:     models.TEXT,
+			Data:     data,
+			Checksum: fmt.Sprintf("%x", md5.Sum([]byte(data))),
+		})
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(method, "/api/user/records/"+name, bytes.NewBuffer(body))
+	if ifMatch != "" {
+		c.Request.Header.Set(models.IfMatchHeader, ifMatch)
+	}
+	c.Params = gin.Params{{Key: "name", Value: name}}
+	c.Set(auth.UserIDKey.ToString(), userID)
+	handler(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// getChanges - вызов GetRecordChanges от имени пользователя userID
+func getChanges(app *App, userID uint64, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/user/records/changes?"+query, nil)
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.GetRecordChanges(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// changesPage - успешный ответ GetRecordChanges
+func changesPage(t *testing.T, app *App, userID uint64, query string) models.RecordChanges {
+	t.Helper()
+	w := getChanges(app, userID, query)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page models.RecordChanges
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+func TestRecordChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		page := changesPage(t, app, 1, "")
+		require.Len(t, page.Changes, 1)
+		assert.Equal(t, models.ChangeCreated, page.Changes[0].Op)
+		assert.Equal(t, "testrecord", page.Changes[0].Record.Name)
+		cursor := page.Cursor
+
+		require.Equal(t, http.StatusCreated, putRecord(app, 1, "extra", "a:b").Code)
+		w := recordRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "testrecord", "new:data")
+		require.Equal(t, http.StatusOK, w.Code)
+		w = recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "extra", "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, int64(1), getUsage(t, app, 1).Records)
+
+		page = changesPage(t, app, 1, fmt.Sprintf("since=%d", cursor))
+		require.Len(t, page.Changes, 2, "record created and deleted after cursor is reported once")
+		assert.Equal(t, models.ChangeUpdated, page.Changes[0].Op)
+		assert.Equal(t, "new:data", page.Changes[0].Record.Data)
+		assert.Equal(t, models.ChangeDeleted, page.Changes[1].Op)
+		assert.Equal(t, "extra", page.Changes[1].Record.Name)
+
+		first := changesPage(t, app, 1, "since=0&limit=1")
+		require.Len(t, first.Changes, 1)
+		assert.True(t, first.More)
+		rest := changesPage(t, app, 1, fmt.Sprintf("since=%d", first.Cursor))
+		require.Len(t, rest.Changes, 1)
+		assert.False(t, rest.More)
+		assert.Equal(t, page.Cursor, rest.Cursor)
+
+		empty := changesPage(t, app, 1, fmt.Sprintf("since=%d", page.Cursor))
+		assert.Empty(t, empty.Changes)
+		assert.Equal(t, page.Cursor, empty.Cursor)
+		assert.Empty(t, changesPage(t, app, 2, "").Changes, "changes of other users are not visible")
+
+		assert.Equal(t, http.StatusGone, getChanges(app, 1, fmt.Sprintf("since=%d", page.Cursor+1)).Code)
+		assert.Equal(t, http.StatusBadRequest, getChanges(app, 1, "since=-1").Code)
+		assert.Equal(t, http.StatusBadRequest, getChanges(app, 1, "limit=0").Code)
+
+		assert.Equal(t, http.StatusNotFound,
+			recordRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "extra", "a:b").Code)
+		assert.Equal(t, http.StatusNotFound,
+			recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "extra", "").Code)
+		assert.Equal(t, http.StatusNotFound,
+			recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 2, "testrecord", "").Code)
+		assert.Equal(t, http.StatusBadRequest,
+			recordRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "testrecord", "nocolon").Code)
+	})
+}
+
+func TestUpdateDataRecord_Quota(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		app.config.QuotaMaxRecords = 1
+		app.config.QuotaMaxBytes = 6
+		app.Reload(app.config)
+		require.Equal(t, http.StatusCreated, putRecord(app, 2, "only", "a:1234").Code)
+		assert.Equal(t, http.StatusOK,
+			recordRequest(app, app.UpdateDataRecord, http.MethodPut, 2, "only", "b:5678").Code,
+			"replaced record does not count against quota")
+		assert.Equal(t, http.StatusInsufficientStorage,
+			recordRequest(app, app.UpdateDataRecord, http.MethodPut, 2, "only", "c:12345").Code)
+	})
+}
+
+func TestUpdateDataRecord_IfMatch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		w := putRecord(app, 1, "shared", "a:b")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created models.DataRecord
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		base := fmt.Sprintf("%q", fmt.Sprint(created.Version))
+
+		w = ifMatchRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "shared", "c:d", base)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = ifMatchRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "shared", "e:f", base)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "record was changed by another device")
+		w = ifMatchRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "shared", "", base)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = ifMatchRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "shared", "", "latest")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		page := changesPage(t, app, 1, "")
+		last := page.Changes[len(page.Changes)-1]
+		assert.Equal(t, "c:d", last.Record.Data, "rejected requests change nothing")
+		w = ifMatchRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "shared", "", fmt.Sprint(last.Version))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = ifMatchRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "shared", "", fmt.Sprint(last.Version))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestPurgeTombstones(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		cursor := changesPage(t, app, 1, "").Cursor
+		require.Equal(t, http.StatusCreated, putRecord(app, 1, "extra", "a:b").Code)
+		w := recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "extra", "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+		latest := changesPage(t, app, 1, "").Cursor
+
+		app.purgeTombstones(context.Background())
+		assert.Len(t, changesPage(t, app, 1, fmt.Sprintf("since=%d", cursor)).Changes, 1, "fresh tombstone is kept")
+
+		time.Sleep(time.Millisecond)
+		app.config.TombstoneTTL = time.Nanosecond
+		app.purgeTombstones(context.Background())
+		assert.Equal(t, http.StatusGone, getChanges(app, 1, fmt.Sprintf("since=%d", cursor)).Code,
+			"client with an older cursor would miss the deletion")
+		assert.Empty(t, changesPage(t, app, 1, fmt.Sprintf("since=%d", latest)).Changes)
+		assert.Len(t, changesPage(t, app, 1, "since=0").Changes, 1, "full resync is always possible")
+	})
+}
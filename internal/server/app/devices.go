@@ -0,0 +1,175 @@
+// Модуль аутентификации устройств клиентскими сертификатами (mTLS)
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/certs"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DeviceIDKey - ключ ID устройства в контексте запроса
+const DeviceIDKey = "device_id"
+
+// maxDeviceNameLen - ограничение длины названия устройства
+const maxDeviceNameLen = 255
+
+// mtlsCAPaths - файлы CA устройств: из конфигурации или локальный CA сервера
+func mtlsCAPaths(c *config.ServerConfig) (string, string) {
+	caCert, caKey := certs.CAPaths(c.TLSCertPath)
+	if c.MTLSCACert != "" {
+		caCert = c.MTLSCACert
+	}
+	if c.MTLSCAKey != "" {
+		caKey = c.MTLSCAKey
+	}
+	return caCert, caKey
+}
+
+// ClientTLS - настройка проверки клиентских сертификатов в TLS конфигурации сервера.
+// Сертификат запрашивается, но не обязателен на уровне TLS: без него клиент должен иметь возможность
+// войти и зарегистрировать устройство, а доступ к записям в режиме require закрывает DeviceAuth.
+func ClientTLS(c *config.ServerConfig, cfg *tls.Config) error {
+	if !c.MTLSEnabled() {
+		cfg.ClientAuth = tls.NoClientCert
+		return nil
+	}
+	caCert, _ := mtlsCAPaths(c)
+	data, err := os.ReadFile(caCert)
+	if err != nil {
+		return fmt.Errorf("error reading mTLS CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", caCert)
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	cfg.ClientCAs = pool
+	return nil
+}
+
+// loadDeviceCA - загрузка CA для подписи сертификатов устройств
+func (a *App) loadDeviceCA() error {
+	caCert, caKey := mtlsCAPaths(a.config)
+	ca, err := certs.LoadCA(caCert, caKey)
+	if err != nil {
+		return fmt.Errorf("error loading mTLS CA: %w", err)
+	}
+	a.deviceCA = ca
+	return nil
+}
+
+// EnrollDevice - выпуск сертификата устройства по CSR для вошедшего пользователя
+func (a *App) EnrollDevice(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/devices")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req models.EnrollRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		l.Debugw("cannot decode body", zap.Error(err))
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxDeviceNameLen {
+		l.Debug("invalid device name")
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	csr, err := certs.ParseCSR([]byte(req.CSR))
+	if err != nil {
+		l.Debugw("invalid CSR", zap.Error(err))
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	subject := pkix.Name{CommonName: fmt.Sprintf("user-%d", userID), OrganizationalUnit: []string{req.Name}}
+	cert, err := a.deviceCA.SignClient(csr, subject, 0)
+	if err != nil {
+		l.Errorw("error signing device certificate", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	device := &models.Device{
+		UserID:      userID,
+		Name:        req.Name,
+		Fingerprint: certs.CertFingerprint(cert),
+		Subject:     cert.Subject.String(),
+		ExpiresAt:   cert.NotAfter,
+	}
+	if err := a.store.CreateDevice(c.Request.Context(), device); err != nil {
+		l.Errorw("error saving device", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	l.Infow("device enrolled", "device_id", device.ID, "device", device.Name)
+	a.audit(c, models.AuditEvent{UserID: userID, Action: models.AuditDeviceEnroll,
+		Details: fmt.Sprintf("device %d %s", device.ID, device.Name)})
+	c.JSON(http.StatusCreated, models.EnrollResponse{
+		Certificate: string(certs.EncodeCertificate(cert.Raw)),
+		CA:          string(certs.EncodeCertificate(a.deviceCA.Cert.Raw)),
+	})
+}
+
+// DeviceAuth - проверка клиентского сертификата запроса: сертификат должен принадлежать
+// зарегистрированному и не отозванному устройству того же пользователя, что и токен.
+// В режиме optional запросы без сертификата пропускаются.
+func (a *App) DeviceAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := requestid.Logger(c, a.logger)
+		if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+			if a.config.MTLSMode == config.MTLSRequire {
+				a.denyDevice(c, "client certificate required: run `gclient login` to enroll this device")
+				return
+			}
+			c.Next()
+			return
+		}
+		fingerprint := certs.CertFingerprint(c.Request.TLS.PeerCertificates[0])
+		device, err := a.store.GetDevice(c.Request.Context(), fingerprint)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				a.denyDevice(c, "unknown device certificate")
+				return
+			}
+			l.Errorw("error getting device", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			c.Abort()
+			return
+		}
+		if device.RevokedAt != nil {
+			a.denyDevice(c, "device certificate is revoked")
+			return
+		}
+		if device.UserID != c.GetUint64(auth.UserIDKey.ToString()) {
+			a.denyDevice(c, "device certificate belongs to another user")
+			return
+		}
+		c.Set(DeviceIDKey, device.ID)
+		c.Next()
+	}
+}
+
+// denyDevice - отказ в доступе с причиной в теле ответа
+func (a *App) denyDevice(c *gin.Context, reason string) {
+	requestid.Logger(c, a.logger).Warnw("device rejected", "reason", reason)
+	c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{Error: reason, RequestID: requestid.Get(c)})
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/certs"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSR - CSR в PEM с новым ключом ECDSA
+func newCSR(t *testing.T, cn string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+// enroll - вызов EnrollDevice от имени пользователя userID
+func enroll(t *testing.T, app *App, userID uint64, req models.EnrollRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/devices", bytes.NewBuffer(body))
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.EnrollDevice(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// withDeviceCA - включает mTLS в режиме mode с новым CA
+func withDeviceCA(t *testing.T, app *App, mode string) {
+	t.Helper()
+	ca, err := certs.NewCA(certs.Options{})
+	require.NoError(t, err)
+	app.config = &config.ServerConfig{MTLSMode: mode}
+	app.deviceCA = ca
+}
+
+// deviceRequest - запрос через DeviceAuth от пользователя userID с клиентским сертификатом cert (может быть nil)
+func deviceRequest(app *App, userID uint64, cert *x509.Certificate) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/records", func(c *gin.Context) {
+		c.Set(auth.UserIDKey.ToString(), userID)
+	}, app.DeviceAuth(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEnrollDevice(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		withDeviceCA(t, app, config.MTLSRequire)
+
+		w := enroll(t, app, 1, models.EnrollRequest{Name: "laptop", CSR: newCSR(t, "someone-else")})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.EnrollResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		cert, err := certs.ParseCertificate([]byte(resp.Certificate))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", cert.Subject.CommonName, "subject is set by the server, not by the CSR")
+		assert.Equal(t, []string{"laptop"}, cert.Subject.OrganizationalUnit)
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(resp.CA))
+		_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, deviceRequest(app, 1, cert).Code)
+		assert.Equal(t, http.StatusForbidden, deviceRequest(app, 2, cert).Code, "device of another user")
+		assert.Equal(t, http.StatusForbidden, deviceRequest(app, 1, nil).Code, "certificate is required")
+
+		other, err := certs.NewCA(certs.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, deviceRequest(app, 1, other.Cert).Code, "unknown device")
+
+		app.config.MTLSMode = config.MTLSOptional
+		assert.Equal(t, http.StatusOK, deviceRequest(app, 1, nil).Code)
+	})
+}
+
+func TestEnrollDeviceBadRequest(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		withDeviceCA(t, app, config.MTLSRequire)
+		assert.Equal(t, http.StatusBadRequest, enroll(t, app, 1, models.EnrollRequest{Name: "laptop", CSR: "junk"}).Code)
+		assert.Equal(t, http.StatusBadRequest, enroll(t, app, 1, models.EnrollRequest{CSR: newCSR(t, "x")}).Code)
+		assert.Equal(t, http.StatusUnauthorized, enroll(t, app, 0, models.EnrollRequest{Name: "laptop"}).Code)
+	})
+}
+
+func TestRouterRequiresDevice(t *testing.T) {
+	app := newTestApp(t, store.NewMemoryStore())
+	paths := certs.Paths{CACert: "ca.crt", CAKey: "ca.key", Cert: "server.crt", Key: "server.key"}
+	_, err := certs.Init(paths, certs.Options{}, certs.Options{}, false)
+	require.NoError(t, err)
+	app.config = &config.ServerConfig{MTLSMode: config.MTLSRequire, MTLSCACert: paths.CACert, MTLSCAKey: paths.CAKey}
+	router, err := app.SetupRouter()
+	require.NoError(t, err)
+	var token models.TokenResponse
+	require.NoError(t, json.Unmarshal(login(app, "testuser", "testpassword").Body.Bytes(), &token))
+
+	request := func(method, target string, body []byte) int {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set(auth.AuthorizationHeader, "Bearer "+token.Token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	for _, route := range []struct{ method, target string }{
+		{http.MethodGet, "/api/user/usage"},
+		{http.MethodGet, "/api/user/audit"},
+		{http.MethodGet, "/api/user/events"},
+		{http.MethodGet, "/api/user/webhooks/"},
+		{http.MethodPost, "/api/user/webhooks/"},
+		{http.MethodDelete, "/api/user/webhooks/1"},
+		{http.MethodPost, "/api/user/webhooks/1/test"},
+		{http.MethodGet, "/api/user/records/list"},
+		{http.MethodGet, "/api/user/records/testrecord"},
+	} {
+		assert.Equal(t, http.StatusForbidden, request(route.method, route.target, nil), route.target)
+	}
+	body, _ := json.Marshal(models.EnrollRequest{Name: "laptop", CSR: newCSR(t, "laptop")})
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/api/user/devices", body),
+		"certificate is issued without one")
+}
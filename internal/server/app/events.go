@@ -0,0 +1,105 @@
+// Модуль потока событий записей (Server-Sent Events)
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/events"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxEventStreamsPerUser - сколько потоков событий пользователь может держать одновременно
+	maxEventStreamsPerUser = 5
+	// eventsHeartbeat - интервал комментариев, по которым прокси и клиент видят, что поток жив
+	eventsHeartbeat = 25 * time.Second
+	// eventsRetry - через сколько клиенту переподключаться после обрыва
+	eventsRetry = 5 * time.Second
+)
+
+// newEventHub - рассылка событий записей; между репликами - через хранилище, если оно это поддерживает
+func newEventHub(s store.Store, logger *zap.SugaredLogger, m *metrics.Metrics) *events.Hub {
+	notifier, _ := s.(store.RecordNotifier)
+	return events.NewHub(notifier, logger, m)
+}
+
+// RunEvents - прием событий записей от других реплик до отмены ctx
+func (a *App) RunEvents(ctx context.Context) {
+	a.events.Run(ctx)
+}
+
+// publish - рассылка события записи подключенным клиентам пользователя
+func (a *App) publish(c *gin.Context, e models.RecordEvent) {
+	a.events.Publish(c.Request.Context(), e)
+}
+
+// StreamEvents - поток событий записей пользователя в формате Server-Sent Events.
+// Поток закрывается при отставании клиента, при остановке сервера, а также если с открытия потока учетную
+// запись заблокировали или завершили ее сеансы (проверяется с каждым heartbeat). После переподключения
+// клиенту нужно синхронизировать записи, так как события за время обрыва не повторяются.
+func (a *App) StreamEvents(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/events")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	sub, err := a.events.Subscribe(userID, maxEventStreamsPerUser)
+	if err != nil {
+		if errors.Is(err, events.ErrTooManyStreams) {
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{Error: err.Error(), RequestID: requestid.Get(c)})
+			return
+		}
+		c.Status(http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+	opened := time.Now()
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", eventsRetry.Milliseconds()); err != nil {
+		return
+	}
+	c.Writer.Flush()
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := a.checkSession(c.Request.Context(), userID, opened); err != nil {
+				l.Infow("closing event stream", "user_id", userID, zap.Error(err))
+				return
+			}
+			_, err = fmt.Fprint(c.Writer, ": ping\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			_, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err != nil {
+			l.Debugw("event stream closed", zap.Error(err))
+			return
+		}
+		c.Writer.Flush()
+	}
+}
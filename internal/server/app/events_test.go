@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openEvents - запрос потока событий с токеном token
+func openEvents(t *testing.T, url, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url+"/api/user/events", nil)
+	require.NoError(t, err)
+	req.Header.Set(auth.AuthorizationHeader, "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	return resp
+}
+
+// readFrame - строки очередного события потока до пустой строки
+func readFrame(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// readRecordEvent - очередное событие записи из потока
+func readRecordEvent(t *testing.T, r *bufio.Reader) models.RecordEvent {
+	t.Helper()
+	frame := readFrame(t, r)
+	require.Len(t, frame, 2)
+	var e models.RecordEvent
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data: ")), &e))
+	assert.Equal(t, "event: "+e.Type, frame[0])
+	return e
+}
+
+func TestStreamEvents(t *testing.T) {
+	app := newTestApp(t, store.NewMemoryStore())
+	router, err := app.SetupRouter()
+	require.NoError(t, err)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	var token models.TokenResponse
+	require.NoError(t, json.Unmarshal(login(app, "testuser", "testpassword").Body.Bytes(), &token))
+
+	resp := openEvents(t, srv.URL, token.Token)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	stream := bufio.NewReader(resp.Body)
+	assert.Equal(t, []string{"retry: 5000"}, readFrame(t, stream))
+
+	w := putRecord(app, 2, "other", "b:2")
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = putRecord(app, 1, "watched", "a:1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var record models.DataRecord
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+	e := readRecordEvent(t, stream)
+	assert.Equal(t, models.RecordCreated, e.Type, "events of other users are not sent")
+	assert.Equal(t, record.ID, e.RecordID)
+	assert.Equal(t, uint64(1), e.UserID)
+	assert.Equal(t, models.TEXT, e.RecordType)
+
+	for i := 1; i < maxEventStreamsPerUser; i++ {
+		require.Equal(t, http.StatusOK, openEvents(t, srv.URL, token.Token).StatusCode)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, openEvents(t, srv.URL, token.Token).StatusCode)
+
+	app.events.Close()
+	_, err = io.ReadAll(stream)
+	assert.NoError(t, err, "stream ends on shutdown")
+	assert.Equal(t, http.StatusServiceUnavailable, openEvents(t, srv.URL, token.Token).StatusCode)
+}
@@ -0,0 +1,134 @@
+// Модуль идемпотентного создания записей
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxIdempotencyKeyLength - максимальная длина ключа идемпотентности
+	maxIdempotencyKeyLength = 255
+	// defaultIdempotencyKeyTTL - сколько хранятся ключи идемпотентности, если IDEMPOTENCY_KEY_TTL не задан
+	defaultIdempotencyKeyTTL = 7 * 24 * time.Hour
+	// idempotencyPurgeInterval - как часто удаляются устаревшие ключи идемпотентности
+	idempotencyPurgeInterval = time.Hour
+)
+
+// RunIdempotencyPurge - удаление устаревших ключей идемпотентности раз в idempotencyPurgeInterval до отмены ctx
+func (a *App) RunIdempotencyPurge(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+	for {
+		a.purgeIdempotencyKeys(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeIdempotencyKeys - удаление ключей идемпотентности старше IDEMPOTENCY_KEY_TTL
+func (a *App) purgeIdempotencyKeys(ctx context.Context) {
+	ttl := a.config.IdempotencyKeyTTL
+	if ttl == 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+	n, err := a.store.PurgeIdempotencyKeys(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		if ctx.Err() == nil {
+			a.logger.Errorw("cannot purge idempotency keys", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		a.logger.Infof("purged %d expired idempotency keys", n)
+	}
+}
+
+// idempotencyKey - ключ идемпотентности из заголовка запроса создания записи record, nil - заголовка нет.
+// При некорректном ключе ответ 400 уже отправлен и ok = false.
+func idempotencyKey(c *gin.Context, l *zap.SugaredLogger, userID uint64, record *models.DataRecordRequest) (
+	k *models.IdempotencyKey, ok bool) {
+	key := c.GetHeader(models.IdempotencyKeyHeader)
+	if key == "" {
+		return nil, true
+	}
+	if !validIdempotencyKey(key) {
+		l.Debug("invalid idempotency key")
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:     "invalid " + models.IdempotencyKeyHeader + " header",
+			RequestID: requestid.Get(c),
+		})
+		return nil, false
+	}
+	return &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash(record),
+		CreatedAt:   time.Now().UTC(),
+	}, true
+}
+
+// validIdempotencyKey - ключ не длиннее maxIdempotencyKeyLength из печатных ASCII-символов
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash - хэш содержимого запроса создания записи
+func requestHash(record *models.DataRecordRequest) string {
+	b, _ := json.Marshal(record)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyKeyUsed - запрос с ключом k уже создал запись: повтор не проверяет квоту, иначе он получил бы
+// отказ из-за записи, которую сам и создал
+func (a *App) idempotencyKeyUsed(ctx context.Context, k *models.IdempotencyKey) (bool, error) {
+	if k == nil {
+		return false, nil
+	}
+	_, err := a.store.GetIdempotencyKey(ctx, k.UserID, k.Key)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// replayError - ответ на ошибку повтора запроса с ключом идемпотентности; false - ошибка не связана с ключом
+func replayError(c *gin.Context, l *zap.SugaredLogger, err error) bool {
+	var status int
+	switch {
+	case errors.Is(err, store.ErrIdempotencyMismatch):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, store.ErrNotFound):
+		// запись, созданная с этим ключом, с тех пор удалена
+		status = http.StatusGone
+	default:
+		return false
+	}
+	l.Infow("idempotent request cannot be replayed", zap.Error(err))
+	c.JSON(status, models.ErrorResponse{Error: err.Error(), RequestID: requestid.Get(c)})
+	return true
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putRecordOnce - вызов PutDataRecord с ключом идемпотентности key от имени пользователя userID
+func putRecordOnce(app *App, userID uint64, key, name, data string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.DataRecordRequest{
+		Type:     models.TEXT,
+		Name:     name,
+		Data:     data,
+		Checksum: fmt.Sprintf("%x", md5.Sum([]byte(data))),
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/records/", bytes.NewBuffer(body))
+	c.Request.Header.Set(models.IdempotencyKeyHeader, key)
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.PutDataRecord(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// createdRecord - запись из ответа 201
+func createdRecord(t *testing.T, w *httptest.ResponseRecorder) models.DataRecord {
+	t.Helper()
+	require.Equal(t, http.StatusCreated, w.Code)
+	var r models.DataRecord
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	return r
+}
+
+func TestPutDataRecord_IdempotencyKey(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		first := putRecordOnce(app, 1, "key-1", "offline", "a:b")
+		created := createdRecord(t, first)
+		assert.Empty(t, first.Header().Get(models.IdempotentReplayedHeader))
+
+		app.config.QuotaMaxRecords = 2
+		app.Reload(app.config)
+		replay := putRecordOnce(app, 1, "key-1", "offline", "a:b")
+		replayed := createdRecord(t, replay)
+		assert.Equal(t, "true", replay.Header().Get(models.IdempotentReplayedHeader))
+		assert.Equal(t, created.ID, replayed.ID, "replay returns the record created by the first request")
+		assert.Equal(t, "a:b", replayed.Data)
+		assert.Equal(t, int64(2), getUsage(t, app, 1).Records, "replay does not create a duplicate")
+		assert.Len(t, changesPage(t, app, 1, "").Changes, 2, "replay does not add a change")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, putRecordOnce(app, 1, "key-1", "offline", "c:d").Code,
+			"key reused with different content")
+		app.config.QuotaMaxRecords = 0
+		app.Reload(app.config)
+		assert.Equal(t, http.StatusConflict, putRecordOnce(app, 1, "key-2", "offline", "a:b").Code,
+			"new key does not hide name conflicts")
+		createdRecord(t, putRecordOnce(app, 2, "key-1", "other", "a:b"))
+
+		require.Equal(t, http.StatusNoContent,
+			recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "offline", "").Code)
+		assert.Equal(t, http.StatusGone, putRecordOnce(app, 1, "key-1", "offline", "a:b").Code,
+			"record created with the key was deleted")
+
+		assert.Equal(t, http.StatusBadRequest, putRecordOnce(app, 1, strings.Repeat("k", 256), "long", "a:b").Code)
+		assert.Equal(t, http.StatusBadRequest, putRecordOnce(app, 1, "ключ", "unicode", "a:b").Code)
+	})
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		createdRecord(t, putRecordOnce(app, 1, "key-1", "offline", "a:b"))
+
+		app.purgeIdempotencyKeys(context.Background())
+		assert.Equal(t, "true", putRecordOnce(app, 1, "key-1", "offline", "a:b").Header().Get(models.IdempotentReplayedHeader),
+			"fresh key is kept")
+
+		time.Sleep(time.Millisecond)
+		app.config.IdempotencyKeyTTL = time.Nanosecond
+		app.purgeIdempotencyKeys(context.Background())
+		assert.Equal(t, http.StatusConflict, putRecordOnce(app, 1, "key-1", "offline", "a:b").Code,
+			"request with a purged key is a new request")
+	})
+}
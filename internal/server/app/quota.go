@@ -0,0 +1,103 @@
+// Модуль квот хранилища пользователей
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRecordTooLarge - запись больше квоты на размер одной записи
+	ErrRecordTooLarge = errors.New("record is too large")
+	// ErrQuotaExceeded - превышена квота на количество или суммарный размер записей
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// usage - использование хранилища и квоты пользователя с учетом заданных администратором
+func (a *App) usage(ctx context.Context, userID uint64) (*models.Usage, error) {
+	usage, err := a.store.GetUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	override, err := a.store.GetQuotaOverride(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage.Limits = a.quota.Load().Apply(override)
+	return usage, nil
+}
+
+// checkQuota - можно ли сохранить еще одну запись размером size байт или заменить ею запись replaced.
+// Проверка выполняется до записи, поэтому одновременные загрузки могут немного превысить квоту.
+func (a *App) checkQuota(ctx context.Context, userID uint64, size int64, replaced *models.DataRecord) error {
+	usage, err := a.usage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if replaced != nil {
+		usage.Records--
+		usage.Bytes -= int64(len(replaced.Data))
+	}
+	limits := usage.Limits
+	if limits.MaxRecordSize > 0 && size > limits.MaxRecordSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrRecordTooLarge, size, limits.MaxRecordSize)
+	}
+	if limits.MaxRecords > 0 && usage.Records >= limits.MaxRecords {
+		return fmt.Errorf("%w: %d of %d records used", ErrQuotaExceeded, usage.Records, limits.MaxRecords)
+	}
+	if limits.MaxBytes > 0 && usage.Bytes+size > limits.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used, record needs %d", ErrQuotaExceeded, usage.Bytes,
+			limits.MaxBytes, size)
+	}
+	return nil
+}
+
+// quotaStatus - код ответа для ошибки checkQuota: 413 для слишком большой записи, 507 для исчерпанной квоты
+func quotaStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRecordTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// quotaError - ответ на ошибку checkQuota
+func (a *App) quotaError(c *gin.Context, l *zap.SugaredLogger, err error) {
+	status := quotaStatus(err)
+	if status == http.StatusInternalServerError {
+		l.Errorw("cannot check quota", zap.Error(err))
+		c.Status(status)
+		return
+	}
+	l.Infow("quota exceeded", zap.Error(err))
+	c.JSON(status, models.ErrorResponse{Error: err.Error(), RequestID: requestid.Get(c)})
+}
+
+// GetUsage - использование хранилища пользователем и его квоты
+func (a *App) GetUsage(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/usage")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	usage, err := a.usage(c.Request.Context(), userID)
+	if err != nil {
+		l.Errorw("error getting usage", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putRecord - вызов PutDataRecord от имени пользователя userID
+func putRecord(app *App, userID uint64, name, data string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.DataRecordRequest{
+		Type:     models.TEXT,
+		Name:     name,
+		Data:     data,
+		Checksum: fmt.Sprintf("%x", md5.Sum([]byte(data))),
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/records/", bytes.NewBuffer(body))
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.PutDataRecord(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+// getUsage - вызов GetUsage от имени пользователя userID
+func getUsage(t *testing.T, app *App, userID uint64) models.Usage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/user/usage", nil)
+	c.Set(auth.UserIDKey.ToString(), userID)
+	app.GetUsage(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usage models.Usage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	return usage
+}
+
+func TestQuotas(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		app.config.QuotaMaxRecords = 2
+		app.config.QuotaMaxBytes = 15
+		app.config.QuotaMaxRecordSize = 10
+		app.Reload(app.config)
+
+		w := putRecord(app, 2, "big", "a:123456789")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "record is too large")
+
+		require.Equal(t, http.StatusCreated, putRecord(app, 2, "first", "a:12345678").Code)
+		w = putRecord(app, 2, "second", "b:1234")
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code, "total size over quota")
+		assert.Contains(t, w.Body.String(), "storage quota exceeded")
+		require.Equal(t, http.StatusCreated, putRecord(app, 2, "second", "b:123").Code)
+		assert.Equal(t, http.StatusInsufficientStorage, putRecord(app, 2, "third", "c:").Code, "records over quota")
+
+		assert.Equal(t, models.Usage{Records: 2, Bytes: 15, Limits: app.config.Quota()}, getUsage(t, app, 2))
+
+		unlimited, maxBytes := int64(0), int64(100)
+		admin := app.store.(store.UserAdmin)
+		require.NoError(t, admin.SetQuotaOverride(context.Background(), 2,
+			&models.QuotaOverride{MaxRecords: &unlimited, MaxBytes: &maxBytes}))
+		require.Equal(t, http.StatusCreated, putRecord(app, 2, "third", "c:").Code)
+		assert.Equal(t, models.Quota{MaxBytes: 100, MaxRecordSize: 10}, getUsage(t, app, 2).Limits)
+
+		require.NoError(t, admin.SetQuotaOverride(context.Background(), 2, &models.QuotaOverride{}))
+		assert.Equal(t, app.config.Quota(), getUsage(t, app, 2).Limits, "reset to defaults")
+
+		app.Reload(&config.ServerConfig{QuotaMaxRecords: 10})
+		assert.Equal(t, models.Quota{MaxRecords: 10}, getUsage(t, app, 2).Limits, "defaults are reloaded")
+	})
+}
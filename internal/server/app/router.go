@@ -3,35 +3,119 @@ package app
 
 import (
 	"fmt"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/health"
 	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
 	ginLogger "github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/logger"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"time"
 )
 
+// ServiceName - имя сервиса в трассировке
+const ServiceName = "gophkeeper"
+
 const (
 	rootRoute    = "/"
 	userAPIRoute = "/api/user"
+	metricsRoute = "/metrics"
+	healthzRoute = "/healthz"
+	readyzRoute  = "/readyz"
+	// userDataDir - каталог файлов пользователей, место на диске под него проверяет /readyz
+	userDataDir = "./userdata"
+	// значения по умолчанию порогов /readyz
+	defaultReadyCertMinDays   = 14
+	defaultReadyMinDiskFreeMB = 100
 )
 
 // SetupRouter Инициализация роутера
 func (a *App) SetupRouter() (*gin.Engine, error) {
 	r := gin.New()
-	ginLoggerMiddleware, err := ginLogger.Logger(a.logger)
+	// без доверенных прокси ClientIP - адрес соединения, иначе клиент подставил бы любой IP в X-Forwarded-For
+	if err := r.SetTrustedProxies(a.config.TrustedProxyList()); err != nil {
+		return nil, fmt.Errorf("error setting trusted proxies: %w", err)
+	}
+	r.Use(requestid.RequestID())
+	r.Use(otelgin.Middleware(ServiceName))
+	ginLoggerMiddleware, err := ginLogger.Logger(a.logger, ginLogger.Options{
+		LogBody:     a.config.LogRequestBody,
+		MaxBodySize: a.config.LogBodyMaxSize,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating middleware logger func: %w", err)
 	}
 	r.Use(ginLoggerMiddleware)
+	r.Use(a.metrics.Middleware())
+	if a.metrics != nil && a.config.MetricsAddr == "" {
+		r.GET(metricsRoute, gin.WrapH(a.metrics.Handler()))
+	}
+	readiness, err := a.readinessChecker()
+	if err != nil {
+		return nil, fmt.Errorf("error creating readiness checks: %w", err)
+	}
+	r.GET(healthzRoute, health.Healthz)
+	r.GET(readyzRoute, readiness.Readyz)
 	userAPI := r.Group(userAPIRoute)
 	{
 		userAPI.POST("register", a.Register)
 		userAPI.POST("login", a.Login)
-		recordsAPI := userAPI.Group("records")
-		recordsAPI.Use(auth.AuthMiddleware(a.logger))
+		userAPI.POST("password", a.ChangePassword)
+		authAPI := userAPI.Group("")
+		authAPI.Use(auth.AuthMiddleware(a.logger, a.checkSession))
+		// сертификат устройства нужен на всех маршрутах с токеном, кроме выпуска сертификата
+		if a.config.MTLSEnabled() {
+			if err := a.loadDeviceCA(); err != nil {
+				return nil, err
+			}
+			authAPI.POST("devices", a.EnrollDevice)
+			authAPI = authAPI.Group("")
+			authAPI.Use(a.DeviceAuth())
+		}
+		authAPI.GET("usage", a.GetUsage)
+		authAPI.GET("audit", a.GetAuditEvents)
+		authAPI.GET("events", a.StreamEvents)
+		webhooksAPI := authAPI.Group("webhooks")
+		{
+			webhooksAPI.POST(rootRoute, a.CreateWebhook)
+			webhooksAPI.GET(rootRoute, a.ListWebhooks)
+			webhooksAPI.DELETE(":id", a.DeleteWebhook)
+			webhooksAPI.POST(":id/test", a.TestWebhook)
+		}
+		recordsAPI := authAPI.Group("records")
 		{
 			recordsAPI.POST(rootRoute, a.PutDataRecord)
 			recordsAPI.GET("list", a.GetDataRecords)
+			recordsAPI.GET("changes", a.GetRecordChanges)
 			recordsAPI.GET(":name", a.GetDataRecord)
+			recordsAPI.PUT(":name", a.UpdateDataRecord)
+			recordsAPI.DELETE(":name", a.DeleteDataRecord)
 		}
 	}
 	return r, nil
 }
+
+// readinessChecker - проверки /readyz: база, версия схемы, срок действия TLS сертификата и место на диске
+func (a *App) readinessChecker() (*health.Checker, error) {
+	checks := []health.Check{health.PingCheck(a.store.Ping)}
+	if ms, ok := a.store.(store.Migratable); ok {
+		m, err := ms.Migrator()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, health.SchemaCheck(m))
+	}
+	if a.config.EnableHTTPS {
+		days := a.config.ReadyCertMinDays
+		if days == 0 {
+			days = defaultReadyCertMinDays
+		}
+		checks = append(checks, health.CertCheck(a.config.TLSCertPath, time.Duration(days)*24*time.Hour))
+	}
+	minFreeMB := a.config.ReadyMinDiskFreeMB
+	if minFreeMB == 0 {
+		minFreeMB = defaultReadyMinDiskFreeMB
+	}
+	checks = append(checks, health.DiskCheck(userDataDir, uint64(minFreeMB)<<20))
+	return health.NewChecker(checks...), nil
+}
@@ -0,0 +1,163 @@
+// Модуль вебхуков пользователя
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/webhooks"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxWebhooksPerUser - сколько вебхуков может зарегистрировать пользователь
+const maxWebhooksPerUser = 10
+
+// RunWebhooks - доставка событий вебхукам до отмены ctx
+func (a *App) RunWebhooks(ctx context.Context) {
+	a.webhooks.Run(ctx)
+}
+
+// notify - постановка события в очередь вебхуков пользователя. Ошибка не прерывает запрос, а попадает в лог.
+func (a *App) notify(c *gin.Context, userID uint64, event string, p models.WebhookPayload) {
+	n, err := webhooks.Enqueue(c.Request.Context(), a.store, userID, event, p)
+	if err != nil {
+		requestid.Logger(c, a.logger).Errorw("cannot enqueue webhook event", "event", event, zap.Error(err))
+	}
+	if n > 0 {
+		a.webhooks.Notify()
+	}
+}
+
+// CreateWebhook - регистрация вебхука. Секрет подписи возвращается только в ответе на этот запрос.
+func (a *App) CreateWebhook(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/webhooks")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		l.Debugw("cannot decode body", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if err := errors.Join(webhooks.ValidateURL(req.URL), webhooks.ValidateEvents(req.Events)); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error(), RequestID: requestid.Get(c)})
+		return
+	}
+	existing, err := a.store.ListWebhooks(c.Request.Context(), userID)
+	if err != nil {
+		l.Errorw("error listing webhooks", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxWebhooksPerUser {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "too many webhooks", RequestID: requestid.Get(c)})
+		return
+	}
+	w := &models.Webhook{UserID: userID, URL: req.URL, Events: req.Events, Secret: req.Secret}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	if w.Secret == "" {
+		if w.Secret, err = webhooks.NewSecret(); err != nil {
+			l.Errorw("error creating webhook secret", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := a.store.CreateWebhook(c.Request.Context(), w); err != nil {
+		l.Errorw("error saving webhook", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	l.Infow("webhook created", "webhook_id", w.ID)
+	c.JSON(http.StatusCreated, w)
+}
+
+// ListWebhooks - вебхуки пользователя без секретов
+func (a *App) ListWebhooks(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/webhooks")
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	list, err := a.store.ListWebhooks(c.Request.Context(), userID)
+	if err != nil {
+		l.Errorw("error listing webhooks", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteWebhook - удаление вебхука вместе с неотправленными событиями
+func (a *App) DeleteWebhook(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/webhooks/:id")
+	w, ok := a.userWebhook(c)
+	if !ok {
+		return
+	}
+	if err := a.store.DeleteWebhook(c.Request.Context(), w.UserID, w.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Errorw("error deleting webhook", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	l.Infow("webhook deleted", "webhook_id", w.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// TestWebhook - отправка проверочного события сразу, без очереди; в ответе код ответа получателя или ошибка
+func (a *App) TestWebhook(c *gin.Context) {
+	l := requestid.Logger(c, a.logger)
+	l.Info("/webhooks/:id/test")
+	w, ok := a.userWebhook(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, a.webhooks.SendTest(c.Request.Context(), w))
+}
+
+// userWebhook - вебхук пользователя из параметра :id. Если его нет, ответ уже записан.
+func (a *App) userWebhook(c *gin.Context) (*models.Webhook, bool) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	if userID == 0 {
+		c.Status(http.StatusUnauthorized)
+		return nil, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return nil, false
+	}
+	w, err := a.store.GetWebhook(c.Request.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return nil, false
+		}
+		requestid.Logger(c, a.logger).Errorw("error getting webhook", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+	return w, true
+}
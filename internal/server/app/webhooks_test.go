@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/webhooks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRequest - вызов обработчика вебхуков от имени пользователя userID
+func webhookRequest(app *App, handler gin.HandlerFunc, userID uint64, id string, body any) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	data, _ := json.Marshal(body)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/user/webhooks/", bytes.NewReader(data))
+	c.Set(auth.UserIDKey.ToString(), userID)
+	if id != "" {
+		c.Params = gin.Params{{Key: "id", Value: id}}
+	}
+	handler(c)
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func TestWebhooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *App) {
+		ctx := context.Background()
+		received := make(chan *http.Request, 10)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r
+		}))
+		defer receiver.Close()
+		app.webhooks = webhooks.NewDeliverer(app.store, app.logger, nil, webhooks.Options{AllowPrivate: true})
+
+		w := webhookRequest(app, app.CreateWebhook, 1, "", models.WebhookRequest{URL: "ftp://example.com"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = webhookRequest(app, app.CreateWebhook, 1, "", models.WebhookRequest{URL: receiver.URL,
+			Events: []string{"record.renamed"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = webhookRequest(app, app.CreateWebhook, 1, "", models.WebhookRequest{URL: receiver.URL,
+			Events: []string{models.WebhookRecordCreated}})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created models.Webhook
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Len(t, created.Secret, 64, "secret is generated")
+		id := strconv.FormatUint(created.ID, 10)
+
+		w = webhookRequest(app, app.ListWebhooks, 1, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var list []models.Webhook
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list, 1)
+		assert.Equal(t, []string{models.WebhookRecordCreated}, list[0].Events)
+		assert.Empty(t, list[0].Secret, "secret is not listed")
+		w = webhookRequest(app, app.ListWebhooks, 2, "", nil)
+		assert.Equal(t, "[]", w.Body.String())
+
+		assert.Equal(t, http.StatusNotFound, webhookRequest(app, app.TestWebhook, 2, id, nil).Code,
+			"webhooks of other users are not accessible")
+		w = webhookRequest(app, app.TestWebhook, 1, id, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":200}`, w.Body.String())
+		r := <-received
+		assert.Equal(t, models.WebhookTest, r.Header.Get(webhooks.HeaderEvent))
+
+		require.Equal(t, http.StatusOK, login(app, "testuser", "testpassword").Code)
+		require.Equal(t, http.StatusCreated, putRecord(app, 1, "hooked", "a:1").Code)
+		deliveries, err := app.store.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Minute), time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1, "login is not subscribed")
+		assert.Equal(t, models.WebhookRecordCreated, deliveries[0].Event)
+		assert.NotContains(t, deliveries[0].Payload, "hooked", "record names are not sent")
+		assert.Equal(t, created.Secret, deliveries[0].Secret)
+
+		assert.Equal(t, http.StatusNoContent, webhookRequest(app, app.DeleteWebhook, 1, id, nil).Code)
+		assert.Equal(t, http.StatusNotFound, webhookRequest(app, app.DeleteWebhook, 1, id, nil).Code)
+		deliveries, err = app.store.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries, "deliveries are deleted with the webhook")
+
+		w = webhookRequest(app, app.CreateWebhook, 1, "", models.WebhookRequest{URL: receiver.URL,
+			Events: []string{models.WebhookRecordUpdated, models.WebhookRecordDeleted}})
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.Equal(t, http.StatusOK,
+			recordRequest(app, app.UpdateDataRecord, http.MethodPut, 1, "hooked", "b:2").Code)
+		require.Equal(t, http.StatusNoContent,
+			recordRequest(app, app.DeleteDataRecord, http.MethodDelete, 1, "hooked", "").Code)
+		deliveries, err = app.store.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, models.WebhookRecordUpdated, deliveries[0].Event)
+		assert.Equal(t, models.WebhookRecordDeleted, deliveries[1].Event)
+		assert.NotContains(t, deliveries[1].Payload, "hooked", "record names are not sent")
+	})
+}
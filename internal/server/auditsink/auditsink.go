@@ -0,0 +1,192 @@
+// Модуль экспорта событий аудита во внешние приемники (syslog, файлы JSON Lines)
+package auditsink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/config"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultQueueSize - очередь событий приемника по умолчанию
+	defaultQueueSize = 1024
+	// причины потери события для метрики audit_events_dropped_total
+	reasonQueueFull  = "queue_full"
+	reasonWriteError = "write_error"
+)
+
+// Sink - приемник событий аудита. Write вызывается из одной горутины.
+type Sink interface {
+	// Name - имя приемника в логах и метриках
+	Name() string
+	Write(e *Event) error
+	Close() error
+}
+
+// Event - событие аудита для экспорта: в отличие от ответа API содержит пользователя и хэши цепочки
+type Event struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint64    `json:"user_id"`
+	Action    string    `json:"action"`
+	RecordID  uint64    `json:"record_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// newEvent - событие для экспорта из события журнала
+func newEvent(e *models.AuditEvent) *Event {
+	return &Event{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		UserID:    e.UserID,
+		Action:    e.Action,
+		RecordID:  e.RecordID,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Details:   e.Details,
+		PrevHash:  e.PrevHash,
+		Hash:      e.Hash,
+	}
+}
+
+// queue - очередь событий одного приемника
+type queue struct {
+	sink   Sink
+	events chan *Event
+}
+
+// Dispatcher - асинхронная отправка событий в приемники. У каждого приемника своя ограниченная очередь
+// и горутина, поэтому медленный приемник не задерживает запросы и другие приемники: при переполнении
+// очереди событие отбрасывается и учитывается в метриках. Методы безопасно вызывать у nil.
+type Dispatcher struct {
+	logger  *zap.SugaredLogger
+	metrics *metrics.Metrics
+	queues  []queue
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewDispatcher - запуск отправки в sinks с очередью queueSize (0 - 1024) на приемник. metrics может быть nil.
+func NewDispatcher(logger *zap.SugaredLogger, m *metrics.Metrics, queueSize int, sinks ...Sink) *Dispatcher {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	d := &Dispatcher{logger: logger, metrics: m}
+	for _, s := range sinks {
+		q := queue{sink: s, events: make(chan *Event, queueSize)}
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go d.run(q)
+	}
+	return d
+}
+
+// FromConfig - приемники из конфигурации; nil, если ни один не настроен
+func FromConfig(c *config.ServerConfig, logger *zap.SugaredLogger, m *metrics.Metrics) (*Dispatcher, error) {
+	var sinks []Sink
+	if c.AuditSyslogAddr != "" {
+		network, address, err := config.ParseSyslogAddress(c.AuditSyslogAddr)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, NewSyslog(network, address))
+	}
+	if c.AuditFile != "" {
+		f, err := NewFile(c.AuditFile, int64(c.AuditFileMaxSizeMB)<<20, c.AuditFileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, f)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return NewDispatcher(logger, m, c.AuditQueueSize, sinks...), nil
+}
+
+// Publish - постановка события в очереди приемников без ожидания
+func (d *Dispatcher) Publish(e *models.AuditEvent) {
+	if d == nil {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	event := newEvent(e)
+	for _, q := range d.queues {
+		select {
+		case q.events <- event:
+		default:
+			d.metrics.AuditDropped(q.sink.Name(), reasonQueueFull)
+		}
+	}
+}
+
+// run - запись событий очереди в приемник
+func (d *Dispatcher) run(q queue) {
+	defer d.wg.Done()
+	for e := range q.events {
+		err := q.sink.Write(e)
+		if errors.Is(err, ErrRotate) {
+			d.logger.Errorw("audit file rotation failed, writing to the current file", "sink", q.sink.Name(),
+				zap.Error(err))
+			err = nil
+		}
+		if err != nil {
+			d.logger.Errorw("cannot export audit event", "sink", q.sink.Name(), "event_id", e.ID, zap.Error(err))
+			d.metrics.AuditDropped(q.sink.Name(), reasonWriteError)
+			continue
+		}
+		d.metrics.AuditExported(q.sink.Name())
+	}
+}
+
+// Close - отправка оставшихся в очередях событий и закрытие приемников. Если ctx завершится раньше,
+// неотправленные события теряются.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, q := range d.queues {
+		close(q.events)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	var errs []error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("audit events are not flushed: %w", ctx.Err()))
+	}
+	for _, q := range d.queues {
+		if err := q.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing audit sink %s: %w", q.sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package auditsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testEvent - событие журнала для тестов
+func testEvent(id uint64, action string) *models.AuditEvent {
+	return &models.AuditEvent{
+		ID:        id,
+		CreatedAt: time.Date(2026, 10, 19, 14, 0, 0, 123456000, time.UTC),
+		UserID:    7,
+		Action:    action,
+		RecordID:  3,
+		IP:        "10.0.0.5",
+		UserAgent: `agent "quoted" [x]`,
+		Details:   "wrong password",
+		Hash:      "abc",
+	}
+}
+
+// blockingSink - приемник, который ждет release перед каждой записью
+type blockingSink struct {
+	release chan struct{}
+	written chan *Event
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(e *Event) error {
+	<-s.release
+	s.written <- e
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestDispatcher_DropsWhenQueueIsFull(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{}), written: make(chan *Event, 10)}
+	d := NewDispatcher(zap.NewNop().Sugar(), nil, 1, sink)
+
+	start := time.Now()
+	for i := uint64(1); i <= 5; i++ {
+		d.Publish(testEvent(i, models.AuditRecordRead))
+	}
+	assert.Less(t, time.Since(start), time.Second, "publish does not wait for the sink")
+
+	close(sink.release)
+	require.NoError(t, d.Close(context.Background()))
+	close(sink.written)
+	var ids []uint64
+	for e := range sink.written {
+		ids = append(ids, e.ID)
+	}
+	assert.Contains(t, ids, uint64(1))
+	assert.Less(t, len(ids), 5, "events over the queue size are dropped")
+
+	d.Publish(testEvent(6, models.AuditRecordRead))
+	var nilDispatcher *Dispatcher
+	nilDispatcher.Publish(testEvent(7, models.AuditRecordRead))
+	assert.NoError(t, nilDispatcher.Close(context.Background()))
+}
+
+func TestFile_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	f, err := NewFile(path, 300, 2)
+	require.NoError(t, err)
+	for i := uint64(1); i <= 6; i++ {
+		require.NoError(t, f.Write(newEvent(testEvent(i, models.AuditLoginSuccess))))
+	}
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var e Event
+	require.NoError(t, json.Unmarshal([]byte(strings.Split(string(data), "\n")[0]), &e))
+	assert.Equal(t, uint64(7), e.UserID)
+	assert.Equal(t, "abc", e.Hash)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(filePerm), info.Mode().Perm())
+	assert.FileExists(t, path+".1")
+	assert.FileExists(t, path+".2")
+	assert.NoFileExists(t, path+".3", "only maxBackups files are kept")
+}
+
+func TestFile_RotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := NewFile(path, 100, 1)
+	require.NoError(t, err)
+	// каталог на месте path.1 не дает переименовать файл
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0700))
+	require.NoError(t, f.Write(newEvent(testEvent(1, models.AuditLoginSuccess))))
+	assert.ErrorIs(t, f.Write(newEvent(testEvent(2, models.AuditLoginSuccess))), ErrRotate)
+	assert.ErrorIs(t, f.Write(newEvent(testEvent(3, models.AuditLoginSuccess))), ErrRotate)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3, "events are kept in the current file")
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	require.NoError(t, f.Write(newEvent(testEvent(4, models.AuditLoginSuccess))), "rotation is retried")
+	assert.FileExists(t, path+".1")
+	require.NoError(t, f.Close())
+	assert.Error(t, f.Write(newEvent(testEvent(5, models.AuditLoginSuccess))))
+}
+
+func TestSyslog_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s := NewSyslog("udp", conn.LocalAddr().String())
+	defer s.Close()
+	require.NoError(t, s.Write(newEvent(testEvent(42, models.AuditLoginFailure))))
+
+	buf := make([]byte, 2048)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<84>1 2026-10-19T14:00:00.123456Z "), msg)
+	assert.Contains(t, msg, " gophkeeper ")
+	assert.Contains(t, msg, ` login_failure [audit@32473 id="42" user_id="7" record_id="3" ip="10.0.0.5" `+
+		`user_agent="agent \"quoted\" [x\]" hash="abc"] wrong password`)
+}
+
+func TestSyslog_TCPFraming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		prefix, _ := r.ReadString(' ')
+		length, err := strconv.Atoi(strings.TrimSpace(prefix))
+		if err != nil {
+			received <- prefix
+			return
+		}
+		msg := make([]byte, length)
+		_, _ = io.ReadFull(r, msg)
+		received <- string(msg)
+	}()
+
+	s := NewSyslog("tcp", l.Addr().String())
+	defer s.Close()
+	require.NoError(t, s.Write(newEvent(testEvent(1, models.AuditRecordCreate))))
+	select {
+	case msg := <-received:
+		assert.True(t, strings.HasPrefix(msg, "<85>1 "), "octet counting framing: %s", msg)
+		assert.True(t, strings.HasSuffix(msg, "wrong password"), msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("syslog message is not received")
+	}
+}
@@ -0,0 +1,143 @@
+// Модуль приемника файлов JSON Lines
+package auditsink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// defaultFileMaxSize - размер файла, после которого он ротируется, по умолчанию
+	defaultFileMaxSize = 100 << 20
+	// defaultFileMaxBackups - сколько ротированных файлов хранится по умолчанию
+	defaultFileMaxBackups = 5
+	// filePerm - права файлов журнала: в них IP и логины пользователей
+	filePerm = 0600
+)
+
+// ErrRotate - событие записано, но файл не ротирован; ротация повторяется со следующим событием
+var ErrRotate = errors.New("error rotating audit file")
+
+// File - приемник, пишущий события по одному JSON на строку. Когда файл превышает maxSize, он переименовывается
+// в path.1 (старые path.N сдвигаются, лишние удаляются) и запись продолжается в новый файл.
+// Если файл не удалось открыть заново, попытка повторяется при следующей записи.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// closed - приемник закрыт Close, f не открывается заново
+	closed bool
+}
+
+// NewFile - открытие файла path на дозапись. maxSize 0 - 100 МБ, maxBackups 0 - 5.
+func NewFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	if maxSize <= 0 {
+		maxSize = defaultFileMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultFileMaxBackups
+	}
+	s := &File{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating audit file directory: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name - реализация Sink
+func (s *File) Name() string {
+	return "file"
+}
+
+// open - открытие файла на дозапись
+func (s *File) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("error opening audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error opening audit file: %w", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+// Write - реализация Sink
+func (s *File) Write(e *Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("audit file is closed")
+	}
+	var rotateErr error
+	if s.f != nil && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		rotateErr = s.rotate()
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// rotate - сдвиг ротированных файлов и открытие нового. Если файл не переименован, запись продолжается
+// в него же: файл открывается заново, а ошибка оборачивает ErrRotate.
+func (s *File) rotate() error {
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRotate, err)
+	}
+	for i := s.maxBackups; i > 0; i-- {
+		from := s.path
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", s.path, i-1)
+		}
+		err := os.Rename(from, fmt.Sprintf("%s.%d", s.path, i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %w", ErrRotate, err)
+		}
+	}
+	if err := s.open(); err != nil {
+		return fmt.Errorf("%w: %w", ErrRotate, err)
+	}
+	return nil
+}
+
+// Close - реализация Sink
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
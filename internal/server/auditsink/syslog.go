@@ -0,0 +1,155 @@
+// Модуль приемника syslog (RFC 5424)
+package auditsink
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+)
+
+const (
+	// syslogAppName - APP-NAME сообщений
+	syslogAppName = "gophkeeper"
+	// syslogFacility - facility authpriv: сообщения безопасности и авторизации
+	syslogFacility = 10
+	// важность сообщений: warning для неудачного входа, notice для остальных событий
+	syslogWarning = 4
+	syslogNotice  = 5
+	// syslogSDID - идентификатор структурированных данных, 32473 - номер предприятия для примеров (RFC 5612)
+	syslogSDID = "audit@32473"
+	// syslogTimeout - таймаут подключения и записи
+	syslogTimeout = 5 * time.Second
+)
+
+// sdEscaper - экранирование значений параметров структурированных данных
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// Syslog - приемник syslog. Подключение устанавливается при первой записи и восстанавливается после ошибки,
+// поэтому недоступный сервер syslog не мешает запуску.
+type Syslog struct {
+	network  string
+	address  string
+	hostname string
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+	// stream - потоковое соединение: сообщения разделяются по RFC 6587
+	stream bool
+}
+
+// NewSyslog - приемник syslog по сети udp или tcp; пустая network - unix сокет (датаграммный, затем потоковый)
+func NewSyslog(network, address string) *Syslog {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Syslog{network: network, address: address, hostname: hostname, pid: os.Getpid()}
+}
+
+// Name - реализация Sink
+func (s *Syslog) Name() string {
+	return "syslog"
+}
+
+// Write - реализация Sink. При ошибке записи выполняется одна попытка переподключения.
+func (s *Syslog) Write(e *Event) error {
+	msg := s.format(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write(msg)
+	if err != nil && s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		err = s.write(msg)
+	}
+	return err
+}
+
+// write - отправка сообщения с подключением при необходимости
+func (s *Syslog) write(msg string) error {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout)); err != nil {
+		return err
+	}
+	if s.stream {
+		if s.network == "tcp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		} else {
+			msg += "\n"
+		}
+	}
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+// dial - подключение к серверу syslog
+func (s *Syslog) dial() error {
+	networks := []string{s.network}
+	if s.network == "" {
+		networks = []string{"unixgram", "unix"}
+	}
+	var errs []error
+	for _, network := range networks {
+		conn, err := net.DialTimeout(network, s.address, syslogTimeout)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.conn = conn
+		s.stream = network == "tcp" || network == "unix"
+		return nil
+	}
+	return fmt.Errorf("error connecting to syslog %s: %w", s.address, errors.Join(errs...))
+}
+
+// format - сообщение RFC 5424: действие в MSGID, поля события в структурированных данных, подробности в MSG
+func (s *Syslog) format(e *Event) string {
+	severity := syslogNotice
+	if e.Action == models.AuditLoginFailure {
+		severity = syslogWarning
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s [%s", syslogFacility*8+severity,
+		e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, syslogAppName, s.pid,
+		e.Action, syslogSDID)
+	params := []struct{ name, value string }{
+		{"id", strconv.FormatUint(e.ID, 10)},
+		{"user_id", strconv.FormatUint(e.UserID, 10)},
+		{"record_id", strconv.FormatUint(e.RecordID, 10)},
+		{"ip", e.IP},
+		{"user_agent", e.UserAgent},
+		{"hash", e.Hash},
+	}
+	for _, p := range params {
+		fmt.Fprintf(&b, ` %s="%s"`, p.name, sdEscaper.Replace(p.value))
+	}
+	b.WriteString("]")
+	if e.Details != "" {
+		b.WriteString(" " + e.Details)
+	}
+	return b.String()
+}
+
+// Close - реализация Sink
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
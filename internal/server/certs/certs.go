@@ -0,0 +1,309 @@
+// Модуль выпуска TLS сертификатов сервера.
+// Создает локальный удостоверяющий центр (CA) и подписанный им сертификат сервера, чтобы клиенты
+// могли доверять CA (--ca-cert), а не отключать проверку сертификата.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// KeyECDSA - ключ ECDSA P-256 (по умолчанию)
+	KeyECDSA = "ecdsa"
+	// KeyRSA - ключ RSA
+	KeyRSA = "rsa"
+	// rsaBits - длина ключа RSA
+	rsaBits = 4096
+	// serialBits - длина случайного серийного номера
+	serialBits = 128
+	// filePerm - права на файлы ключей и сертификатов
+	filePerm = 0600
+	// dirPerm - права на каталог сертификатов
+	dirPerm = 0700
+	// organization - владелец сертификатов
+	organization = "GophKeeper"
+)
+
+var (
+	// DefaultHosts - имена и адреса в сертификате сервера по умолчанию
+	DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+	// DefaultValidity - срок действия сертификата сервера по умолчанию
+	DefaultValidity = 365 * 24 * time.Hour
+	// DefaultCAValidity - срок действия CA по умолчанию
+	DefaultCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultRenewBefore - за сколько до истечения сертификат перевыпускается
+	DefaultRenewBefore = 30 * 24 * time.Hour
+)
+
+// ErrNoCA - файлы CA не найдены
+var ErrNoCA = errors.New("CA not found: run `gophkeeper certs init` first")
+
+// Options - параметры выпуска сертификата
+type Options struct {
+	// Hosts - DNS имена и IP адреса (SAN), пусто - DefaultHosts
+	Hosts []string
+	// KeyType - KeyECDSA (по умолчанию) или KeyRSA
+	KeyType string
+	// Validity - срок действия, 0 - DefaultValidity для сервера и DefaultCAValidity для CA
+	Validity time.Duration
+}
+
+// Authority - удостоверяющий центр: сертификат и ключ
+type Authority struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// Paths - пути к файлам CA и сертификата сервера
+type Paths struct {
+	CACert string
+	CAKey  string
+	Cert   string
+	Key    string
+}
+
+// CAPaths - пути к файлам CA рядом с сертификатом сервера
+func CAPaths(certPath string) (caCert, caKey string) {
+	dir := filepath.Dir(certPath)
+	return filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+}
+
+// GenerateKey - создание закрытого ключа выбранного типа
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "", KeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyRSA:
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	default:
+		return nil, fmt.Errorf("unknown key type %q: use %s or %s", keyType, KeyECDSA, KeyRSA)
+	}
+}
+
+// randomSerial - случайный серийный номер сертификата
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialBits))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// NewCA - создание нового CA
+func NewCA(opts Options) (*Authority, error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultCAValidity
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{organization}, CommonName: "GophKeeper local CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// LoadCA - загрузка CA из файлов
+func LoadCA(certPath, keyPath string) (*Authority, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoCA
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %w", err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoCA
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA key: %w", err)
+	}
+	key, err := ParseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// Issue - выпуск сертификата сервера, подписанного CA. Возвращает сертификат и ключ в PEM.
+func (ca *Authority) Issue(opts Options) (certPEM, keyPEM []byte, err error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	hosts := opts.Hosts
+	if len(hosts) == 0 {
+		hosts = DefaultHosts
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{organization}, CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	if tmpl.NotAfter.After(ca.Cert.NotAfter) {
+		tmpl.NotAfter = ca.Cert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+	keyPEM, err = EncodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return EncodeCertificate(der), keyPEM, nil
+}
+
+// Hosts - DNS имена и IP адреса из сертификата
+func Hosts(cert *x509.Certificate) []string {
+	hosts := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// EncodeCertificate - сертификат в PEM (CERTIFICATE)
+func EncodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// EncodeKey - закрытый ключ в PEM (PKCS#8, PRIVATE KEY)
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseCertificate - разбор первого сертификата из PEM
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no CERTIFICATE PEM block found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseKey - разбор закрытого ключа из PEM: PKCS#8, PKCS#1 (RSA PRIVATE KEY) или SEC 1 (EC PRIVATE KEY)
+func ParseKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no private key PEM block found")
+	}
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// writeFile - атомарная запись файла: сервер, перечитывающий сертификат по SIGHUP,
+// не увидит наполовину записанный файл
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Chmod(filePerm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
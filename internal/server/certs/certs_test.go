@@ -0,0 +1,120 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPaths - пути к файлам сертификатов во временном каталоге (каталог certs еще не создан)
+func testPaths(t *testing.T) Paths {
+	dir := filepath.Join(t.TempDir(), "certs")
+	caCert, caKey := CAPaths(filepath.Join(dir, "cert.pem"))
+	return Paths{CACert: caCert, CAKey: caKey, Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+}
+
+// readCert - сертификат из файла
+func readCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	cert, err := ParseCertificate(data)
+	require.NoError(t, err)
+	return cert
+}
+
+// verify - проверка сертификата сервера по CA для host
+func verify(t *testing.T, paths Paths, host string) error {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(readCert(t, paths.CACert))
+	_, err := readCert(t, paths.Cert).Verify(x509.VerifyOptions{Roots: pool, DNSName: host})
+	return err
+}
+
+func TestInit(t *testing.T) {
+	paths := testPaths(t)
+	_, err := Init(paths, Options{}, Options{Hosts: []string{"keeper.local", "10.0.0.5"}}, false)
+	require.NoError(t, err)
+
+	assert.NoError(t, verify(t, paths, "keeper.local"))
+	assert.NoError(t, verify(t, paths, "10.0.0.5"))
+	assert.Error(t, verify(t, paths, "127.0.0.1"))
+	_, err = tls.LoadX509KeyPair(paths.Cert, paths.Key)
+	require.NoError(t, err)
+
+	keyPEM, err := os.ReadFile(paths.Key)
+	require.NoError(t, err)
+	block, _ := pem.Decode(keyPEM)
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+	info, err := os.Stat(paths.Key)
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	ca := readCert(t, paths.CACert)
+	assert.True(t, ca.IsCA)
+	assert.IsType(t, &ecdsa.PublicKey{}, readCert(t, paths.Cert).PublicKey)
+
+	_, err = Init(paths, Options{}, Options{}, false)
+	assert.ErrorIs(t, err, ErrExists)
+
+	serial := readCert(t, paths.Cert).SerialNumber
+	_, err = Init(paths, Options{}, Options{}, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, serial, readCert(t, paths.Cert).SerialNumber, "serial numbers are random")
+	assert.Equal(t, ca.Raw, readCert(t, paths.CACert).Raw, "existing CA is kept")
+	assert.NoError(t, verify(t, paths, "localhost"))
+}
+
+func TestInitRSA(t *testing.T) {
+	if testing.Short() {
+		t.Skip("RSA key generation is slow")
+	}
+	paths := testPaths(t)
+	_, err := Init(paths, Options{KeyType: KeyRSA}, Options{KeyType: KeyRSA}, false)
+	require.NoError(t, err)
+	cert := readCert(t, paths.Cert)
+	assert.IsType(t, &rsa.PublicKey{}, cert.PublicKey)
+	assert.NotZero(t, cert.KeyUsage&x509.KeyUsageKeyEncipherment)
+
+	_, err = Init(testPaths(t), Options{KeyType: "dsa"}, Options{}, false)
+	assert.ErrorContains(t, err, "unknown key type")
+}
+
+func TestRenew(t *testing.T) {
+	paths := testPaths(t)
+	_, err := Init(paths, Options{}, Options{Hosts: []string{"keeper.local"}, Validity: 10 * 24 * time.Hour}, false)
+	require.NoError(t, err)
+	old := readCert(t, paths.Cert)
+
+	renewed, notAfter, err := Renew(paths, Options{}, 24*time.Hour, false)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+	assert.Equal(t, old.NotAfter, notAfter)
+
+	renewed, notAfter, err = Renew(paths, Options{}, DefaultRenewBefore, false)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	assert.True(t, notAfter.After(old.NotAfter))
+	assert.Equal(t, []string{"keeper.local"}, Hosts(readCert(t, paths.Cert)), "names are kept")
+	assert.NoError(t, verify(t, paths, "keeper.local"))
+}
+
+func TestRenewWithoutCA(t *testing.T) {
+	paths := testPaths(t)
+	_, err := Init(paths, Options{}, Options{}, false)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(paths.CAKey))
+	_, _, err = Renew(paths, Options{}, 0, true)
+	assert.ErrorIs(t, err, ErrNoCA)
+}
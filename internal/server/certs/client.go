@@ -0,0 +1,69 @@
+// Модуль клиентских сертификатов устройств (mTLS)
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultClientValidity - срок действия сертификата устройства
+var DefaultClientValidity = 365 * 24 * time.Hour
+
+// ParseCSR - разбор запроса на подпись сертификата из PEM с проверкой его подписи
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no CERTIFICATE REQUEST PEM block found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CSR: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid CSR signature: %w", err)
+	}
+	return csr, nil
+}
+
+// SignClient - выпуск клиентского сертификата по CSR. Из CSR берется только открытый ключ:
+// субъект задает сервер, чтобы клиент не мог выдать себя за другого пользователя.
+func (ca *Authority) SignClient(csr *x509.CertificateRequest, subject pkix.Name, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	if validity == 0 {
+		validity = DefaultClientValidity
+	}
+	now := time.Now()
+	subject.Organization = []string{organization}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if tmpl.NotAfter.After(ca.Cert.NotAfter) {
+		tmpl.NotAfter = ca.Cert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, csr.PublicKey, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error signing client certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CertFingerprint - SHA-256 сертификата в hex
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
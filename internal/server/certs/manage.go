@@ -0,0 +1,112 @@
+// Модуль создания и перевыпуска файлов сертификатов
+package certs
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrExists - сертификат сервера уже создан
+var ErrExists = errors.New("server certificate already exists: use `gophkeeper certs renew` or --force")
+
+// Init - создание CA (если его еще нет) и выпуск им сертификата сервера.
+// Существующий CA не пересоздается, чтобы не сломать доверие клиентов;
+// существующий сертификат сервера без force не перезаписывается.
+func Init(paths Paths, caOpts, opts Options, force bool) (*Authority, error) {
+	if !force && (exists(paths.Cert) || exists(paths.Key)) {
+		return nil, ErrExists
+	}
+	ca, err := LoadCA(paths.CACert, paths.CAKey)
+	if errors.Is(err, ErrNoCA) {
+		ca, err = createCA(paths, caOpts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := issue(ca, paths, opts); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Renew - перевыпуск сертификата сервера, если до его истечения осталось меньше before (или force).
+// Имена, адреса и тип ключа берутся из текущего сертификата, если не заданы в opts.
+// Возвращает признак перевыпуска и срок действия сертификата после вызова.
+func Renew(paths Paths, opts Options, before time.Duration, force bool) (bool, time.Time, error) {
+	data, err := os.ReadFile(paths.Cert)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("error reading certificate: %w", err)
+	}
+	current, err := ParseCertificate(data)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if !force && time.Until(current.NotAfter) > before {
+		return false, current.NotAfter, nil
+	}
+	ca, err := LoadCA(paths.CACert, paths.CAKey)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = Hosts(current)
+	}
+	if opts.KeyType == "" {
+		opts.KeyType = KeyECDSA
+		if _, ok := current.PublicKey.(*rsa.PublicKey); ok {
+			opts.KeyType = KeyRSA
+		}
+	}
+	if err := issue(ca, paths, opts); err != nil {
+		return false, time.Time{}, err
+	}
+	renewed, err := os.ReadFile(paths.Cert)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	cert, err := ParseCertificate(renewed)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return true, cert.NotAfter, nil
+}
+
+// createCA - создание CA и запись его файлов
+func createCA(paths Paths, opts Options) (*Authority, error) {
+	ca, err := NewCA(opts)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := EncodeKey(ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(paths.CAKey, keyPEM); err != nil {
+		return nil, err
+	}
+	if err := writeFile(paths.CACert, EncodeCertificate(ca.Cert.Raw)); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// issue - выпуск сертификата сервера и запись его файлов
+func issue(ca *Authority, paths Paths, opts Options) error {
+	certPEM, keyPEM, err := ca.Issue(opts)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(paths.Key, keyPEM); err != nil {
+		return err
+	}
+	return writeFile(paths.Cert, certPEM)
+}
+
+// exists - файл существует
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -2,74 +2,294 @@
 package config
 
 import (
-	"bytes"
-	"dario.cat/mergo"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
-	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// ServerConfig описывает структуру конфигурации приложения
+// ServerConfig описывает структуру конфигурации приложения.
+// Значения собираются слоями: значения по умолчанию, файл конфигурации (JSON или YAML, ключи как в json-тегах),
+// переменные окружения (в том числе из .env) и флаги командной строки; каждый следующий слой переопределяет предыдущий.
 type ServerConfig struct {
-	RunAddr     string `json:"server_address" env:"SERVER_ADDRESS" envconfig:"SERVER_ADDRESS"`
-	DatabaseDSN string `json:"database_dsn" env:"DATABASE_DSN" envconfig:"DATABASE_DSN"`
-	Config      string `json:"-" env:"CONFIG" envconfig:"CONFIG"`
-	TLSCertPath string `json:"tls_cert_path" env:"TLS_CERT_PATH" envconfig:"TLS_CERT_PATH"`
-	TLSKeyPath  string `json:"tls_key_path" env:"TLS_KEY_PATH" envconfig:"TLS_KEY_PATH"`
-	LogLevel    string `env:"LOG_LEVEL" envDefault:"debug" envconfig:"LOG_LEVEL"`
-	EnableHTTPS bool   `json:"enable_https" env:"ENABLE_HTTPS" envconfig:"ENABLE_HTTPS"`
+	RunAddr     string `json:"server_address" envconfig:"SERVER_ADDRESS"`
+	DatabaseDSN string `json:"database_dsn" envconfig:"DATABASE_DSN"`
+	Config      string `json:"-" envconfig:"CONFIG"`
+	TLSCertPath string `json:"tls_cert_path" envconfig:"TLS_CERT_PATH"`
+	TLSKeyPath  string `json:"tls_key_path" envconfig:"TLS_KEY_PATH"`
+	LogLevel    string `json:"log_level" envconfig:"LOG_LEVEL"`
+	// MetricsAddr - адрес отдельного листенера для /metrics; если пуст, /metrics отдается основным сервером
+	MetricsAddr string `json:"metrics_address" envconfig:"METRICS_ADDRESS"`
+	// HTTPRedirectAddr - адрес HTTP листенера, который только перенаправляет на HTTPS (нужен ENABLE_HTTPS)
+	HTTPRedirectAddr string `json:"http_redirect_address" envconfig:"HTTP_REDIRECT_ADDRESS"`
+	// UnixSocket - путь к unix сокету для локальных инструментов администрирования (HTTP без TLS, права 0660)
+	UnixSocket  string `json:"unix_socket" envconfig:"UNIX_SOCKET"`
+	EnableHTTPS bool   `json:"enable_https" envconfig:"ENABLE_HTTPS"`
+	AutoMigrate bool   `json:"auto_migrate" envconfig:"AUTO_MIGRATE"`
+	// TrustedProxies - IP адреса и подсети (через запятую) прокси, которым сервер доверяет X-Forwarded-For
+	// и X-Real-IP. По умолчанию никому: IP клиента в аудите - адрес соединения.
+	TrustedProxies string `json:"trusted_proxies" envconfig:"TRUSTED_PROXIES"`
+	// Пороги проверки готовности /readyz: срок действия TLS сертификата (0 - 14 дней)
+	// и свободное место для ./userdata (0 - 100 МБ)
+	ReadyCertMinDays   int `json:"ready_cert_min_days" envconfig:"READY_CERT_MIN_DAYS"`
+	ReadyMinDiskFreeMB int `json:"ready_min_disk_free_mb" envconfig:"READY_MIN_DISK_FREE_MB"`
+	// Трассировка OpenTelemetry: экспортер none (по умолчанию), otlp, stdout или file
+	TraceExporter    string  `json:"trace_exporter" envconfig:"TRACE_EXPORTER"`
+	TraceEndpoint    string  `json:"trace_endpoint" envconfig:"TRACE_ENDPOINT"`
+	TraceInsecure    bool    `json:"trace_insecure" envconfig:"TRACE_INSECURE"`
+	TraceFile        string  `json:"trace_file" envconfig:"TRACE_FILE"`
+	TraceSampleRatio float64 `json:"trace_sample_ratio" envconfig:"TRACE_SAMPLE_RATIO"`
+	// Логирование тела и заголовков запросов (секреты скрываются), по умолчанию выключено
+	LogRequestBody bool `json:"log_request_body" envconfig:"LOG_REQUEST_BODY"`
+	// LogBodyMaxSize - сколько байт тела запроса попадает в лог, 0 - 4096
+	LogBodyMaxSize int `json:"log_body_max_size" envconfig:"LOG_BODY_MAX_SIZE"`
+	// Настройки пула соединений PostgreSQL, нулевые значения оставляют значения из DSN или по умолчанию pgxpool
+	DBMaxConns               int32         `json:"db_max_conns" envconfig:"DB_MAX_CONNS"`
+	DBMinConns               int32         `json:"db_min_conns" envconfig:"DB_MIN_CONNS"`
+	DBMaxConnLifetime        time.Duration `json:"db_max_conn_lifetime" envconfig:"DB_MAX_CONN_LIFETIME"`
+	DBMaxConnIdleTime        time.Duration `json:"db_max_conn_idle_time" envconfig:"DB_MAX_CONN_IDLE_TIME"`
+	DBStatementCacheCapacity int           `json:"db_statement_cache_capacity" envconfig:"DB_STATEMENT_CACHE_CAPACITY"`
+	// DBQueryExecMode - cache_statement (по умолчанию), cache_describe, describe_exec, exec или simple_protocol
+	DBQueryExecMode string `json:"db_query_exec_mode" envconfig:"DB_QUERY_EXEC_MODE"`
+	// Ключ шифрования ключей (KEK) для шифрования записей на сервере: файл или base64 в переменной окружения.
+	// Если не задан ни один, записи хранятся без серверного шифрования.
+	KEKFile string `json:"kek_file" envconfig:"KEK_FILE"`
+	KEK     string `json:"-" envconfig:"KEK"`
+	// Аутентификация устройств клиентскими сертификатами (mTLS): off (по умолчанию), optional - проверять
+	// сертификат, если он предъявлен, require - доступ к записям только с сертификатом зарегистрированного устройства.
+	// CA для подписи сертификатов устройств по умолчанию - локальный CA рядом с TLS_CERT_PATH (certs init).
+	MTLSMode   string `json:"mtls_mode" envconfig:"MTLS_MODE"`
+	MTLSCACert string `json:"mtls_ca_cert" envconfig:"MTLS_CA_CERT"`
+	MTLSCAKey  string `json:"mtls_ca_key" envconfig:"MTLS_CA_KEY"`
+	// Квоты пользователей по умолчанию, 0 - без ограничения: количество записей, суммарный размер данных
+	// и размер одной записи в байтах. Для отдельных пользователей переопределяются командой admin quota.
+	QuotaMaxRecords    int64 `json:"quota_max_records" envconfig:"QUOTA_MAX_RECORDS"`
+	QuotaMaxBytes      int64 `json:"quota_max_bytes" envconfig:"QUOTA_MAX_BYTES"`
+	QuotaMaxRecordSize int64 `json:"quota_max_record_size" envconfig:"QUOTA_MAX_RECORD_SIZE"`
+	// Экспорт событий аудита. AuditSyslogAddr - syslog (RFC 5424): udp://host:port, tcp://host:port
+	// или unix:///dev/log. AuditFile - файл JSON Lines с ротацией по размеру (0 - 100 МБ), хранится
+	// AuditFileMaxBackups старых файлов (0 - 5). AuditQueueSize - очередь событий каждого приемника (0 - 1024),
+	// при переполнении события отбрасываются.
+	AuditSyslogAddr     string `json:"audit_syslog_address" envconfig:"AUDIT_SYSLOG_ADDRESS"`
+	AuditFile           string `json:"audit_file" envconfig:"AUDIT_FILE"`
+	AuditFileMaxSizeMB  int    `json:"audit_file_max_size_mb" envconfig:"AUDIT_FILE_MAX_SIZE_MB"`
+	AuditFileMaxBackups int    `json:"audit_file_max_backups" envconfig:"AUDIT_FILE_MAX_BACKUPS"`
+	AuditQueueSize      int    `json:"audit_queue_size" envconfig:"AUDIT_QUEUE_SIZE"`
+	// Вебхуки: WebhookMaxAttempts - попыток доставки события (0 - 10), WebhookAllowPrivate - разрешить адреса
+	// loopback и внутренних сетей (по умолчанию запрещены, чтобы вебхуки нельзя было направить во внутреннюю сеть)
+	WebhookMaxAttempts  int  `json:"webhook_max_attempts" envconfig:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookAllowPrivate bool `json:"webhook_allow_private" envconfig:"WEBHOOK_ALLOW_PRIVATE"`
+	// IdempotencyKeyTTL - сколько хранятся ключи идемпотентности создания записей (0 - 7 дней);
+	// повтор запроса с удаленным ключом выполняется как новый запрос
+	IdempotencyKeyTTL time.Duration `json:"idempotency_key_ttl" envconfig:"IDEMPOTENCY_KEY_TTL"`
+	// TombstoneTTL - сколько хранятся следы удаленных записей (0 - 90 дней); клиент, не синхронизировавшийся
+	// дольше, получает 410 и синхронизируется заново
+	TombstoneTTL time.Duration `json:"tombstone_ttl" envconfig:"TOMBSTONE_TTL"`
 }
 
-var serverConfig ServerConfig
+// Defaults - значения по умолчанию
+func Defaults() ServerConfig {
+	return ServerConfig{
+		RunAddr:     ":8080",
+		TLSCertPath: "./certs/cert.pem",
+		TLSKeyPath:  "./certs/private.pem",
+		LogLevel:    "debug",
+	}
+}
+
+// flagDef - флаг командной строки и ключ конфигурации, который он задает
+type flagDef struct {
+	name, short, key, usage string
+	isBool                  bool
+}
 
-// ServerConfig парсит значения из переменных окружения
-func ParseFlags() (*ServerConfig, error) {
-	flag.BoolVar(&serverConfig.EnableHTTPS, "s", true, "enable https")
-	flag.StringVar(&serverConfig.DatabaseDSN, "d", "", "Data Source Name (DSN)")
-	flag.StringVar(&serverConfig.Config, "c", "", "Config json file path")
-	flag.StringVar(&serverConfig.TLSCertPath, "l", "./certs/cert.pem", "path to tls cert file")
-	flag.StringVar(&serverConfig.TLSKeyPath, "k", "./certs/private.pem", "path to tls key file")
-	flag.StringVar(&serverConfig.LogLevel, "g", "", "log level")
-	flag.Parse()
+// flagDefs - флаги, переопределяющие конфигурацию
+var flagDefs = []flagDef{
+	{name: "config", short: "c", usage: "config file path (JSON or YAML), also CONFIG"},
+	{name: "address", short: "a", key: "server_address", usage: "address to listen on, host:port"},
+	{name: "database-dsn", short: "d", key: "database_dsn", usage: "database DSN: postgres://..., sqlite://path or memory://"},
+	{name: "enable-https", short: "s", key: "enable_https", usage: "serve HTTPS", isBool: true},
+	{name: "tls-cert", short: "l", key: "tls_cert_path", usage: "path to TLS certificate file"},
+	{name: "tls-key", short: "k", key: "tls_key_path", usage: "path to TLS key file"},
+	{name: "log-level", short: "g", key: "log_level", usage: "log level: debug, info, warn or error"},
+	{name: "metrics-address", key: "metrics_address", usage: "separate listener for /metrics"},
+	{name: "http-redirect-address", key: "http_redirect_address", usage: "plain HTTP listener redirecting to HTTPS"},
+	{name: "unix-socket", key: "unix_socket", usage: "unix socket path for local admin tooling"},
+}
 
-	if err := env.Parse(&serverConfig); err != nil {
-		return nil, fmt.Errorf("error parsing env variables: %w", err)
+// BindFlags - регистрация флагов конфигурации. Значения флагов применяются в Load, только если флаг задан явно.
+func BindFlags(fs *pflag.FlagSet) {
+	for _, f := range flagDefs {
+		if f.isBool {
+			fs.BoolP(f.name, f.short, false, f.usage)
+			continue
+		}
+		fs.StringP(f.name, f.short, "", f.usage)
 	}
+}
 
-	if serverConfig.Config != "" {
-		data, err := os.ReadFile(serverConfig.Config)
-		if err != nil {
-			return nil, fmt.Errorf("error opening config file: %w", err)
+// dotenv - переменные окружения, выставленные из файла .env
+var dotenv = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// Load - загрузка конфигурации: значения по умолчанию, файл конфигурации, переменные окружения
+// (файл .env необязателен) и явно заданные флаги из fs (может быть nil). Проверка значений - Validate.
+func Load(l *zap.SugaredLogger, fs *pflag.FlagSet) (*ServerConfig, error) {
+	cfg := Defaults()
+	if err := loadDotenv(); err != nil {
+		return nil, err
+	}
+	path := os.Getenv("CONFIG")
+	if fs != nil && fs.Changed("config") {
+		path, _ = fs.GetString("config")
+	}
+	if path != "" {
+		l.Debugf("reading config file %s", path)
+		if err := loadFile(&cfg, path); err != nil {
+			return nil, err
 		}
+		cfg.Config = path
+	}
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing environment: %w", err)
+	}
+	if fs != nil {
+		for _, f := range flagDefs {
+			if f.key == "" || !fs.Changed(f.name) {
+				continue
+			}
+			if err := setKey(&cfg, f.key, fs.Lookup(f.name).Value.String()); err != nil {
+				return nil, fmt.Errorf("flag --%s: %w", f.name, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
 
-		var configFromFile ServerConfig
-		if err := json.NewDecoder(bytes.NewReader(data)).Decode(&configFromFile); err != nil {
-			return nil, fmt.Errorf("error parsing json file config: %w", err)
+// loadDotenv - применение файла .env к окружению процесса. Переменные, заданные в окружении,
+// файл не перекрывает, а выставленные из него при прошлой загрузке обновляет: так изменения .env
+// подхватываются при перечитывании конфигурации. Удаленные из файла переменные сбрасываются.
+func loadDotenv() error {
+	values, err := godotenv.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading .env: %w", err)
+	}
+	dotenv.Lock()
+	defer dotenv.Unlock()
+	for key := range dotenv.keys {
+		if _, ok := values[key]; !ok {
+			_ = os.Unsetenv(key)
+			delete(dotenv.keys, key)
+		}
+	}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok && !dotenv.keys[key] {
+			continue
 		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("error applying .env: %w", err)
+		}
+		dotenv.keys[key] = true
+	}
+	return nil
+}
 
-		if err := mergo.Merge(&serverConfig, configFromFile); err != nil {
-			return nil, fmt.Errorf("cannot merge configs: %w", err)
+// loadFile - наложение значений из файла конфигурации. Формат определяется по расширению:
+// .yaml и .yml - YAML, остальные - JSON.
+func loadFile(cfg *ServerConfig, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		err = json.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	for key, value := range values {
+		if value == nil {
+			continue
+		}
+		raw := fmt.Sprint(value)
+		if f, ok := value.(float64); ok {
+			// JSON числа приходят как float64, целые значения не должны превращаться в 1e+06
+			raw = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		if err := setKey(cfg, key, raw); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
 		}
 	}
+	return nil
+}
 
-	return &serverConfig, nil
+// setKey - установка поля конфигурации по ключу из json-тега
+func setKey(cfg *ServerConfig, key, raw string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != key || name == "-" {
+			continue
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", raw, key, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown key %q", key)
 }
 
-func Load(l *zap.SugaredLogger) (*ServerConfig, error) {
-	var cfg ServerConfig
-	if err := godotenv.Load(); err != nil {
-		l.Debug("error func Load, method Load by path internal/config/config.go", zap.Error(err))
-		return nil, err
+// setValue - разбор строкового значения по типу поля
+func setValue(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
 	}
-	err := envconfig.Process("", &cfg)
-	if err != nil {
-		l.Debug("error func Load, method Process by path internal/config/config.go", zap.Error(err))
-		return nil, err
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
 	}
-	return &cfg, nil
+	return nil
 }
@@ -0,0 +1,45 @@
+// Модуль сравнения конфигураций
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change - изменение одного ключа конфигурации. Секреты в значениях скрыты.
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// String - изменение в виде "key: old -> new"
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Key, c.Old, c.New)
+}
+
+// Diff - список ключей, значения которых отличаются в old и new, в порядке полей ServerConfig.
+// Секреты сравниваются по настоящим значениям, но выводятся скрытыми; KEK не выводится совсем.
+func Diff(old, new ServerConfig) []Change {
+	changes := make([]Change, 0)
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	// значения для вывода берутся из копий со скрытыми секретами
+	oldShown, newShown := reflect.ValueOf(old.Redacted()), reflect.ValueOf(new.Redacted())
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "-" || ov.Field(i).Interface() == nv.Field(i).Interface() {
+			continue
+		}
+		changes = append(changes, Change{
+			Key: key,
+			Old: fmt.Sprint(oldShown.Field(i).Interface()),
+			New: fmt.Sprint(newShown.Field(i).Interface()),
+		})
+	}
+	if old.KEK != new.KEK {
+		changes = append(changes, Change{Key: "kek", Old: redacted, New: redacted})
+	}
+	return changes
+}
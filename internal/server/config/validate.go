@@ -0,0 +1,199 @@
+// Модуль проверки конфигурации
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/utils"
+)
+
+// redacted - значение, которым заменяются секреты при выводе конфигурации
+const redacted = "xxxxx"
+
+// Режимы mTLS
+const (
+	MTLSOff      = "off"
+	MTLSOptional = "optional"
+	MTLSRequire  = "require"
+)
+
+// mtlsModes - допустимые значения MTLS_MODE
+var mtlsModes = map[string]bool{"": true, MTLSOff: true, MTLSOptional: true, MTLSRequire: true}
+
+// traceExporters - допустимые значения TRACE_EXPORTER
+var traceExporters = map[string]bool{"": true, "none": true, "otlp": true, "stdout": true, "file": true}
+
+// Validate - проверка конфигурации. Возвращает все найденные ошибки разом.
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	if c.DatabaseDSN == "" {
+		errs = append(errs, errors.New("database DSN is not set: use DATABASE_DSN, --database-dsn or --dev"))
+	}
+	if _, _, err := net.SplitHostPort(c.RunAddr); err != nil {
+		errs = append(errs, fmt.Errorf("invalid server address %q: %w", c.RunAddr, err))
+	}
+	if c.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid metrics address %q: %w", c.MetricsAddr, err))
+		}
+	}
+	if c.HTTPRedirectAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPRedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid HTTP redirect address %q: %w", c.HTTPRedirectAddr, err))
+		} else if !c.EnableHTTPS {
+			errs = append(errs, errors.New("HTTP redirect listener requires ENABLE_HTTPS"))
+		}
+	}
+	if utils.ConvertLogLevelToInt(c.LogLevel) == 0 {
+		errs = append(errs, fmt.Errorf("invalid log level %q: use debug, info, warn or error", c.LogLevel))
+	}
+	if c.EnableHTTPS {
+		errs = append(errs, checkTLSPath("certificate", c.TLSCertPath), checkTLSPath("key", c.TLSKeyPath))
+	}
+	if c.KEKFile != "" {
+		if _, err := os.Stat(c.KEKFile); err != nil {
+			errs = append(errs, fmt.Errorf("KEK file: %w", err))
+		}
+	}
+	if !traceExporters[strings.ToLower(c.TraceExporter)] {
+		errs = append(errs, fmt.Errorf("invalid trace exporter %q: use none, otlp, stdout or file", c.TraceExporter))
+	}
+	if strings.EqualFold(c.TraceExporter, "file") && c.TraceFile == "" {
+		errs = append(errs, errors.New("trace exporter file requires TRACE_FILE"))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("trace sample ratio %v is out of range [0, 1]", c.TraceSampleRatio))
+	}
+	if !mtlsModes[c.MTLSMode] {
+		errs = append(errs, fmt.Errorf("invalid mTLS mode %q: use off, optional or require", c.MTLSMode))
+	} else if c.MTLSEnabled() && !c.EnableHTTPS {
+		errs = append(errs, errors.New("mTLS requires ENABLE_HTTPS"))
+	} else if c.MTLSMode == MTLSRequire && c.UnixSocket != "" {
+		// unix сокет обслуживается без TLS: на нем некому предъявить сертификат устройства
+		errs = append(errs, errors.New("unix socket cannot be used with MTLS_MODE=require: "+
+			"requests on it carry no client certificate, unset UNIX_SOCKET or use MTLS_MODE=optional"))
+	}
+	if c.LogBodyMaxSize < 0 || c.ReadyCertMinDays < 0 || c.ReadyMinDiskFreeMB < 0 {
+		errs = append(errs, errors.New("log body size and readiness thresholds must not be negative"))
+	}
+	if c.QuotaMaxRecords < 0 || c.QuotaMaxBytes < 0 || c.QuotaMaxRecordSize < 0 {
+		errs = append(errs, errors.New("quotas must not be negative"))
+	}
+	if c.AuditSyslogAddr != "" {
+		if _, _, err := ParseSyslogAddress(c.AuditSyslogAddr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.AuditFileMaxSizeMB < 0 || c.AuditFileMaxBackups < 0 || c.AuditQueueSize < 0 {
+		errs = append(errs, errors.New("audit file size, backups and queue size must not be negative"))
+	}
+	if c.WebhookMaxAttempts < 0 {
+		errs = append(errs, errors.New("webhook max attempts must not be negative"))
+	}
+	for _, p := range c.TrustedProxyList() {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				errs = append(errs, fmt.Errorf("invalid trusted proxy %q: use an IP address or CIDR", p))
+			}
+		}
+	}
+	if c.IdempotencyKeyTTL < 0 {
+		errs = append(errs, errors.New("idempotency key TTL must not be negative"))
+	}
+	if c.TombstoneTTL < 0 {
+		errs = append(errs, errors.New("tombstone TTL must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Quota - квоты пользователей по умолчанию
+func (c *ServerConfig) Quota() models.Quota {
+	return models.Quota{MaxRecords: c.QuotaMaxRecords, MaxBytes: c.QuotaMaxBytes, MaxRecordSize: c.QuotaMaxRecordSize}
+}
+
+// TrustedProxyList - адреса и подсети доверенных прокси из TRUSTED_PROXIES, пустой список - доверенных прокси нет
+func (c *ServerConfig) TrustedProxyList() []string {
+	var proxies []string
+	for _, p := range strings.Split(c.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// ParseSyslogAddress - сеть и адрес syslog из AUDIT_SYSLOG_ADDRESS: udp://host:port, tcp://host:port
+// или unix:///path. Для unix сеть пустая: сначала пробуется датаграммный сокет, затем потоковый.
+func ParseSyslogAddress(raw string) (network, address string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid audit syslog address %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", fmt.Errorf("invalid audit syslog address %q: %w", raw, err)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid audit syslog address %q: socket path is not set", raw)
+		}
+		return "", u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid audit syslog address %q: use udp://, tcp:// or unix://", raw)
+	}
+}
+
+// MTLSEnabled - включена ли аутентификация устройств клиентскими сертификатами
+func (c *ServerConfig) MTLSEnabled() bool {
+	return c.MTLSMode == MTLSOptional || c.MTLSMode == MTLSRequire
+}
+
+// checkTLSPath - путь к сертификату или ключу задан и, если файл существует, он читается.
+// Отсутствующие файлы допустимы: сервер создаст самоподписанный сертификат при старте.
+func checkTLSPath(kind, path string) error {
+	if path == "" {
+		return fmt.Errorf("TLS %s path is not set", kind)
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("TLS %s %s is not readable: %w", kind, path, err)
+	}
+	return f.Close()
+}
+
+// keyValuePassword - пароль в DSN формата "host=... password=..."
+var keyValuePassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// Redacted - копия конфигурации со скрытыми секретами для вывода
+func (c ServerConfig) Redacted() ServerConfig {
+	if u, err := url.Parse(c.DatabaseDSN); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		c.DatabaseDSN = u.String()
+	} else {
+		c.DatabaseDSN = keyValuePassword.ReplaceAllString(c.DatabaseDSN, "${1}"+redacted)
+	}
+	if u, err := url.Parse(c.DatabaseDSN); err == nil && u.Query().Has("password") {
+		q := u.Query()
+		q.Set("password", redacted)
+		u.RawQuery = q.Encode()
+		c.DatabaseDSN = u.String()
+	}
+	if c.KEK != "" {
+		c.KEK = redacted
+	}
+	return c
+}
@@ -0,0 +1,181 @@
+// Модуль конвертного шифрования данных на сервере.
+// Чувствительные колонки шифруются ключом данных пользователя (DEK), который хранится
+// в базе только в обернутом ключом шифрования ключей (KEK) виде. KEK в базу не попадает.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize - длина KEK и DEK в байтах (AES-256)
+const KeySize = 32
+
+// sealedPrefix - префикс зашифрованного значения колонки; значения без него считаются открытыми
+// (записи, сохраненные до включения шифрования)
+const sealedPrefix = "enc:v1:"
+
+var (
+	// ErrWrongKEK - ключ данных обернут другим KEK
+	ErrWrongKEK = errors.New("data key is wrapped with another KEK")
+	// ErrNoKEK - в базе есть зашифрованные данные, но KEK не настроен
+	ErrNoKEK = errors.New("encrypted value found but no KEK configured")
+)
+
+// KEK - ключ шифрования ключей
+type KEK struct {
+	aead cipher.AEAD
+	id   string
+}
+
+// NewKEK - создание KEK из 32 байт ключа
+func NewKEK(key []byte) (*KEK, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("KEK must be %d bytes, got %d", KeySize, len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &KEK{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// LoadKEK - загрузка KEK из файла или из значения переменной окружения (base64).
+// Файл может содержать 32 байта ключа или их base64. Если оба источника пусты, возвращает nil:
+// шифрование на сервере выключено.
+func LoadKEK(path, encoded string) (*KEK, error) {
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading KEK file: %w", err)
+		}
+		if len(raw) == KeySize {
+			return NewKEK(raw)
+		}
+		encoded = strings.TrimSpace(string(raw))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding KEK: %w", err)
+	}
+	return NewKEK(key)
+}
+
+// GenerateKey - генерация случайного ключа для KEK или DEK
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	return key, nil
+}
+
+// ID - идентификатор KEK (префикс SHA-256 ключа), по нему видно, каким KEK обернут ключ данных
+func (k *KEK) ID() string {
+	return k.id
+}
+
+// Wrap - оборачивание ключа данных
+func (k *KEK) Wrap(dek []byte) ([]byte, error) {
+	return seal(k.aead, dek, []byte(k.id))
+}
+
+// Unwrap - разворачивание ключа данных
+func (k *KEK) Unwrap(wrapped []byte) ([]byte, error) {
+	dek, err := open(k.aead, wrapped, []byte(k.id))
+	if err != nil {
+		return nil, fmt.Errorf("%w (configured KEK %s)", ErrWrongKEK, k.id)
+	}
+	return dek, nil
+}
+
+// Seal - шифрование значения колонки ключом данных. aad привязывает шифртекст
+// к владельцу и колонке, чтобы его нельзя было подставить в чужую запись.
+func Seal(dek []byte, plaintext, aad string) (string, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open - расшифровка значения колонки. Открытые значения возвращаются без изменений.
+func Open(dek []byte, value, aad string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if dek == nil {
+		return "", ErrNoKEK
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("error decoding sealed value: %w", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting sealed value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed - признак зашифрованного значения
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// BlindIndex - детерминированный HMAC значения для поиска по зашифрованной колонке
+func BlindIndex(dek []byte, value string) string {
+	indexKey := hmac.New(sha256.New, dek)
+	indexKey.Write([]byte("blind-index"))
+	mac := hmac.New(sha256.New, indexKey.Sum(nil))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newAEAD - AES-256-GCM
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal - шифрование со случайным nonce в начале шифртекста
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open - расшифровка шифртекста, созданного seal
+func open(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,188 @@
+// Модуль рассылки событий изменения записей подключенным клиентам
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// subscriptionBuffer - сколько событий ждут отправки клиенту, прежде чем поток будет закрыт как отстающий
+	subscriptionBuffer = 64
+	// задержка переподключения к каналу событий базы
+	minReconnect = time.Second
+	maxReconnect = 30 * time.Second
+)
+
+var (
+	// ErrClosed - сервер останавливается, новые подписки не принимаются
+	ErrClosed = errors.New("event hub is closed")
+	// ErrTooManyStreams - у пользователя открыто максимальное число потоков событий
+	ErrTooManyStreams = errors.New("too many event streams")
+)
+
+// Subscription - подписка на события записей пользователя
+type Subscription struct {
+	// C - события пользователя. Канал закрывается, если клиент не успевает их забирать, при потере
+	// связи с другими репликами и при остановке сервера: клиенту нужно переподключиться и синхронизироваться.
+	C      <-chan models.RecordEvent
+	c      chan models.RecordEvent
+	hub    *Hub
+	userID uint64
+}
+
+// Close - отмена подписки
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s, false)
+}
+
+// Hub - рассылка событий записей подписчикам этой реплики. Если хранилище умеет рассылать события
+// между репликами (PostgreSQL LISTEN/NOTIFY), события публикуются через него и принимаются в Run,
+// иначе сразу доставляются локальным подписчикам.
+type Hub struct {
+	notifier store.RecordNotifier
+	logger   *zap.SugaredLogger
+	metrics  *metrics.Metrics
+	mu       sync.Mutex
+	subs     map[uint64]map[*Subscription]struct{}
+	closed   bool
+}
+
+// NewHub - конструктор рассылки. notifier может быть nil: тогда события не выходят за пределы процесса.
+func NewHub(notifier store.RecordNotifier, logger *zap.SugaredLogger, m *metrics.Metrics) *Hub {
+	return &Hub{
+		notifier: notifier,
+		logger:   logger,
+		metrics:  m,
+		subs:     make(map[uint64]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe - подписка на события пользователя, не больше limit одновременных подписок (0 - без ограничения)
+func (h *Hub) Subscribe(userID uint64, limit int) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if limit > 0 && len(h.subs[userID]) >= limit {
+		return nil, ErrTooManyStreams
+	}
+	c := make(chan models.RecordEvent, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, hub: h, userID: userID}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][s] = struct{}{}
+	h.metrics.EventStream(true)
+	return s, nil
+}
+
+// unsubscribe - удаление подписки и закрытие ее канала; dropped - клиент не успевал забирать события
+func (h *Hub) unsubscribe(s *Subscription, dropped bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s, dropped)
+}
+
+// remove - удаление подписки под h.mu
+func (h *Hub) remove(s *Subscription, dropped bool) {
+	subs := h.subs[s.userID]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.c)
+	h.metrics.EventStream(false)
+	if dropped {
+		h.metrics.EventStreamDropped()
+	}
+}
+
+// Publish - публикация события. Ошибка рассылки между репликами не прерывает запрос: событие получат
+// хотя бы подписчики этой реплики, остальные клиенты увидят изменение при следующей синхронизации.
+func (h *Hub) Publish(ctx context.Context, e models.RecordEvent) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	if h.notifier != nil {
+		err := h.notifier.NotifyRecordEvent(ctx, &e)
+		if err == nil {
+			return
+		}
+		h.logger.Errorw("cannot notify other replicas, delivering locally", "event", e.Type, zap.Error(err))
+	}
+	h.deliver(&e)
+}
+
+// deliver - отправка события подписчикам пользователя на этой реплике без ожидания
+func (h *Hub) deliver(e *models.RecordEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[e.UserID] {
+		select {
+		case s.c <- *e:
+		default:
+			h.logger.Infow("event stream is too slow, closing", "user_id", e.UserID)
+			h.remove(s, true)
+		}
+	}
+}
+
+// Run - прием событий других реплик до отмены ctx; без рассылки между репликами только ждет отмены.
+// При потере соединения с базой все потоки закрываются, чтобы клиенты переподключились и не пропустили
+// изменения, сделанные, пока событий не было.
+func (h *Hub) Run(ctx context.Context) {
+	if h.notifier == nil {
+		<-ctx.Done()
+		return
+	}
+	delay := minReconnect
+	for {
+		started := time.Now()
+		err := h.notifier.ListenRecordEvents(ctx, h.deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Errorw("record events listener stopped", "retry_in", delay, zap.Error(err))
+		h.closeSubscriptions()
+		if time.Since(started) > maxReconnect {
+			delay = minReconnect
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnect)
+	}
+}
+
+// Close - закрытие всех потоков при остановке сервера, чтобы Shutdown не ждал их завершения
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.closeSubscriptions()
+}
+
+// closeSubscriptions - закрытие всех подписок
+func (h *Hub) closeSubscriptions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.remove(s, false)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeNotifier - рассылка между репликами в памяти: события из NotifyRecordEvent приходят слушателю
+type fakeNotifier struct {
+	events chan models.RecordEvent
+	// fail - ListenRecordEvents завершается этой ошибкой, имитируя потерю соединения
+	fail chan error
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{events: make(chan models.RecordEvent, 10), fail: make(chan error)}
+}
+
+func (n *fakeNotifier) NotifyRecordEvent(ctx context.Context, e *models.RecordEvent) error {
+	n.events <- *e
+	return nil
+}
+
+func (n *fakeNotifier) ListenRecordEvents(ctx context.Context, handle func(e *models.RecordEvent)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-n.fail:
+			return err
+		case e := <-n.events:
+			handle(&e)
+		}
+	}
+}
+
+// receive - очередное событие подписки
+func receive(t *testing.T, s *Subscription) models.RecordEvent {
+	t.Helper()
+	select {
+	case e, ok := <-s.C:
+		require.True(t, ok, "subscription is closed")
+		return e
+	case <-time.After(time.Second):
+		require.FailNow(t, "no event")
+	}
+	return models.RecordEvent{}
+}
+
+// closed - закрыт ли канал подписки (после уже полученных событий)
+func closed(s *Subscription) bool {
+	for {
+		select {
+		case _, ok := <-s.C:
+			if !ok {
+				return true
+			}
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+}
+
+func TestHub_Local(t *testing.T) {
+	h := NewHub(nil, zap.NewNop().Sugar(), nil)
+	first, err := h.Subscribe(1, 2)
+	require.NoError(t, err)
+	second, err := h.Subscribe(1, 2)
+	require.NoError(t, err)
+	_, err = h.Subscribe(1, 2)
+	assert.ErrorIs(t, err, ErrTooManyStreams)
+	other, err := h.Subscribe(2, 2)
+	require.NoError(t, err)
+
+	h.Publish(context.Background(), models.RecordEvent{Type: models.RecordCreated, UserID: 1, RecordID: 7})
+	for _, s := range []*Subscription{first, second} {
+		e := receive(t, s)
+		assert.Equal(t, uint64(7), e.RecordID)
+		assert.False(t, e.CreatedAt.IsZero())
+	}
+	assert.Empty(t, other.C, "events of other users are not delivered")
+
+	second.Close()
+	second.Close()
+	assert.True(t, closed(second))
+	_, err = h.Subscribe(1, 2)
+	assert.NoError(t, err, "closed subscriptions are not counted")
+
+	h.Close()
+	assert.True(t, closed(first))
+	assert.True(t, closed(other))
+	_, err = h.Subscribe(1, 0)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	h := NewHub(nil, zap.NewNop().Sugar(), nil)
+	s, err := h.Subscribe(1, 0)
+	require.NoError(t, err)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		h.Publish(context.Background(), models.RecordEvent{Type: models.RecordCreated, UserID: 1})
+	}
+	assert.True(t, closed(s), "subscriber that does not keep up is dropped")
+}
+
+func TestHub_Notifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newFakeNotifier()
+	h := NewHub(n, zap.NewNop().Sugar(), nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Run(ctx)
+	}()
+	s, err := h.Subscribe(1, 0)
+	require.NoError(t, err)
+
+	h.Publish(ctx, models.RecordEvent{Type: models.RecordCreated, UserID: 1, RecordID: 3})
+	assert.Equal(t, uint64(3), receive(t, s).RecordID, "events come back through the listener")
+
+	n.fail <- errors.New("connection lost")
+	assert.True(t, closed(s), "streams are closed when the listener fails")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Run did not stop")
+	}
+}
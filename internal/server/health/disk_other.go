@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package health
+
+// freeSpace - на остальных платформах проверка места не поддерживается
+func freeSpace(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
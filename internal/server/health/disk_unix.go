@@ -0,0 +1,17 @@
+//go:build unix
+
+package health
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace - свободное для непривилегированного пользователя место на разделе с path
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("error reading filesystem stats: %w", err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package health
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace - свободное для текущего пользователя место на диске с path
+func freeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		return 0, fmt.Errorf("error reading disk stats: %w", err)
+	}
+	return free, nil
+}
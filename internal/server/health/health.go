@@ -0,0 +1,157 @@
+// Модуль проверок живости и готовности сервера
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/migrator"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// StatusOK - проверка пройдена
+	StatusOK = "ok"
+	// StatusFail - проверка не пройдена
+	StatusFail = "fail"
+	// defaultTimeout - время на все проверки готовности
+	defaultTimeout = 3 * time.Second
+)
+
+// ErrUnsupported - проверка недоступна на этой платформе и считается пройденной
+var ErrUnsupported = errors.New("check is not supported on this platform")
+
+// Check - именованная проверка зависимости
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult - результат одной проверки
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Response - ответ /healthz и /readyz
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker - набор проверок готовности
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker - конструктор набора проверок
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: defaultTimeout}
+}
+
+// Run - параллельный запуск всех проверок
+func (ch *Checker) Run(ctx context.Context) Response {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+	resp := Response{Status: StatusOK, Checks: make(map[string]CheckResult, len(ch.checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range ch.checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			t := time.Now()
+			err := c.Run(ctx)
+			result := CheckResult{Status: StatusOK, Duration: time.Since(t).String()}
+			if err != nil && !errors.Is(err, ErrUnsupported) {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[c.Name] = result
+			if result.Status != StatusOK {
+				resp.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+	return resp
+}
+
+// Healthz - процесс жив и обрабатывает запросы
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{Status: StatusOK})
+}
+
+// Readyz - обработчик готовности: 200, если все проверки пройдены, иначе 503
+func (ch *Checker) Readyz(c *gin.Context) {
+	resp := ch.Run(c.Request.Context())
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+// PingCheck - доступность базы
+func PingCheck(ping func(ctx context.Context) error) Check {
+	return Check{Name: "database", Run: ping}
+}
+
+// SchemaCheck - версия схемы базы соответствует бинарнику
+func SchemaCheck(m *migrator.Migrator) Check {
+	return Check{Name: "migrations", Run: m.Check}
+}
+
+// CertCheck - TLS сертификат читается и действителен еще не менее minValidity
+func CertCheck(path string, minValidity time.Duration) Check {
+	return Check{Name: "tls_certificate", Run: func(ctx context.Context) error {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading certificate: %w", err)
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return fmt.Errorf("no PEM data in %s", path)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("error parsing certificate: %w", err)
+		}
+		if left := time.Until(cert.NotAfter); left < minValidity {
+			return fmt.Errorf("certificate expires at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}}
+}
+
+// DiskCheck - на разделе с path свободно не менее minFree байт.
+// Если path еще не создан, проверяется текущая директория.
+func DiskCheck(path string, minFree uint64) Check {
+	return Check{Name: "disk_space", Run: func(ctx context.Context) error {
+		dir := path
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			dir = "."
+		}
+		free, err := freeSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free, need at least %d", free, minFree)
+		}
+		return nil
+	}}
+}
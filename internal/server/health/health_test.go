@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert - самоподписанный сертификат со сроком действия validFor
+func writeTestCert(t *testing.T, validFor time.Duration) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return path
+}
+
+func TestCertCheck(t *testing.T) {
+	minValidity := 14 * 24 * time.Hour
+	assert.NoError(t, CertCheck(writeTestCert(t, 365*24*time.Hour), minValidity).Run(context.Background()))
+	assert.Error(t, CertCheck(writeTestCert(t, 24*time.Hour), minValidity).Run(context.Background()))
+	assert.Error(t, CertCheck(filepath.Join(t.TempDir(), "missing.pem"), minValidity).Run(context.Background()))
+}
+
+func TestDiskCheck(t *testing.T) {
+	assert.NoError(t, DiskCheck(filepath.Join(t.TempDir(), "not-created"), 1).Run(context.Background()))
+	assert.Error(t, DiskCheck(t.TempDir(), 1<<62).Run(context.Background()))
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbErr      error
+		wantStatus int
+	}{
+		{name: "ready", dbErr: nil, wantStatus: http.StatusOK},
+		{name: "database down", dbErr: errors.New("connection refused"), wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(
+				PingCheck(func(ctx context.Context) error { return tt.dbErr }),
+				Check{Name: "unsupported", Run: func(ctx context.Context) error { return ErrUnsupported }},
+			)
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.GET("/readyz", checker.Readyz)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, StatusOK, resp.Checks["unsupported"].Status)
+			if tt.dbErr != nil {
+				assert.Equal(t, StatusFail, resp.Status)
+				assert.Equal(t, tt.dbErr.Error(), resp.Checks["database"].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Модуль сетевых листенеров сервера: unix сокет, перенаправление HTTP на HTTPS и сокеты systemd
+package listeners
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Роли листенеров; они же имена сокетов systemd (FileDescriptorName)
+const (
+	// Main - основной листенер API (HTTPS или HTTP)
+	Main = "main"
+	// Redirect - HTTP листенер, перенаправляющий на HTTPS
+	Redirect = "redirect"
+	// Unix - unix сокет для локальных инструментов администрирования
+	Unix = "unix"
+)
+
+// unixSocketPerm - права на unix сокет: владелец и группа
+const unixSocketPerm = 0660
+
+// ListenUnix - листенер на unix сокете. Оставшийся от прошлого запуска сокет удаляется,
+// обычный файл по этому пути не трогается.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on unix socket: %w", err)
+	}
+	if err := os.Chmod(path, unixSocketPerm); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("error setting unix socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// RedirectHandler - перенаправление всех запросов на тот же хост и путь по HTTPS на порт httpsPort
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,82 @@
+package listeners
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		host   string
+		target string
+	}{
+		{name: "custom port", port: "8443", host: "example.com:8080", target: "https://example.com:8443/api/user/login?x=1"},
+		{name: "default port", port: "443", host: "example.com", target: "https://example.com/api/user/login?x=1"},
+		{name: "ipv6", port: "443", host: "[::1]:80", target: "https://[::1]/api/user/login?x=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login?x=1", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			RedirectHandler(tt.port).ServeHTTP(w, req)
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.target, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gk.sock")
+	ln, err := ListenUnix(path)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(unixSocketPerm), info.Mode().Perm())
+
+	// сокет, оставшийся после аварийного завершения, заменяется
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	ln, err = ListenUnix(path)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	regular := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(regular, nil, 0600))
+	_, err = ListenUnix(regular)
+	assert.ErrorContains(t, err, "not a socket")
+}
+
+func TestActivated(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+
+	env := map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}
+	getenv := func(key string) string { return env[key] }
+
+	got, err := activated(getenv, 2, int(f.Fd()))
+	require.NoError(t, err)
+	assert.Empty(t, got, "sockets are passed to another process")
+
+	env["LISTEN_PID"] = strconv.Itoa(2)
+	env["LISTEN_FDNAMES"] = "redirect"
+	got, err = activated(getenv, 2, int(f.Fd()))
+	require.NoError(t, err)
+	require.Contains(t, got, Redirect)
+	assert.Equal(t, tcp.Addr().String(), got[Redirect].Addr().String())
+	require.NoError(t, got[Redirect].Close())
+}
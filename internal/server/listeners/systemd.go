@@ -0,0 +1,65 @@
+// Модуль активации сокетами systemd (sd_listen_fds)
+package listeners
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart - первый переданный systemd дескриптор (SD_LISTEN_FDS_START)
+const listenFDsStart = 3
+
+// Systemd - листенеры, переданные systemd (LISTEN_PID, LISTEN_FDS, LISTEN_FDNAMES), по именам сокетов.
+// Сокет без имени (FileDescriptorName не задан) считается основным. Если сервер запущен не через
+// активацию сокетом, возвращает пустой набор. Переменные окружения очищаются, чтобы их не унаследовали
+// дочерние процессы.
+func Systemd() (map[string]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	return activated(os.Getenv, os.Getpid(), listenFDsStart)
+}
+
+// activated - разбор переменных активации сокетами для процесса pid
+func activated(getenv func(string) string, pid, firstFD int) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener)
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return listeners, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return listeners, nil
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		name := Main
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		}
+		if _, ok := listeners[name]; ok {
+			closeAll(listeners)
+			return nil, fmt.Errorf("duplicate systemd socket %q", name)
+		}
+		f := os.NewFile(uintptr(firstFD+i), name)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			closeAll(listeners)
+			return nil, fmt.Errorf("error using systemd socket %q: %w", name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// closeAll - закрытие листенеров
+func closeAll(listeners map[string]net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
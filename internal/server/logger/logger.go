@@ -14,3 +14,15 @@ func NewLogger() (*zap.SugaredLogger, error) {
 	}
 	return logger.Sugar(), nil
 }
+
+// NewLoggerWithLevel - конструктор логгера с изменяемым уровнем: уровень можно поменять
+// через level без пересоздания логгера (например, при перечитывании конфигурации)
+func NewLoggerWithLevel(level zap.AtomicLevel) (*zap.SugaredLogger, error) {
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = level
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("error creating logger: %w", err)
+	}
+	return logger.Sugar(), nil
+}
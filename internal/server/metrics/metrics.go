@@ -0,0 +1,297 @@
+// Модуль метрик Prometheus
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/buildinfo"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophkeeper"
+
+// Metrics - метрики сервера в собственном реестре.
+// Методы безопасно вызывать у nil: тогда метрики не собираются.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+	recordsCreated  prometheus.Counter
+	recordsUpdated  prometheus.Counter
+	recordsDeleted  prometheus.Counter
+	recordsFetched  prometheus.Counter
+	auditExported   *prometheus.CounterVec
+	auditDropped    *prometheus.CounterVec
+	webhooks        *prometheus.CounterVec
+	eventStreams    prometheus.Gauge
+	eventsDropped   prometheus.Counter
+}
+
+// New - конструктор метрик. Если хранилище предоставляет статистику пула соединений,
+// она экспортируется при каждом сборе метрик.
+func New(s store.Store) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route template and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		recordsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_created_total",
+			Help:      "Data records created.",
+		}),
+		recordsUpdated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_updated_total",
+			Help:      "Data records replaced.",
+		}),
+		recordsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_deleted_total",
+			Help:      "Data records deleted.",
+		}),
+		recordsFetched: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_fetched_total",
+			Help:      "Data records returned to clients.",
+		}),
+		auditExported: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "audit_events_exported_total",
+			Help:      "Audit events written to export sinks by sink.",
+		}, []string{"sink"}),
+		auditDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "audit_events_dropped_total",
+			Help:      "Audit events not exported by sink and reason: queue_full or write_error.",
+		}, []string{"sink", "reason"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_deliveries_total",
+			Help:      "Webhook delivery attempts by result: delivered, retry or failed.",
+		}, []string{"result"}),
+		eventStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_streams",
+			Help:      "Open Server-Sent Events streams of record changes.",
+		}),
+		eventsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "event_streams_dropped_total",
+			Help:      "Event streams closed because the client did not keep up.",
+		}),
+	}
+	info := buildinfo.Get()
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information, always 1.",
+	}, []string{"version", "commit", "date", "go_version"})
+	buildInfo.WithLabelValues(info.Version, info.Commit, info.Date, info.GoVersion).Set(1)
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.logins,
+		m.recordsCreated,
+		m.recordsUpdated,
+		m.recordsDeleted,
+		m.recordsFetched,
+		m.auditExported,
+		m.auditDropped,
+		m.webhooks,
+		m.eventStreams,
+		m.eventsDropped,
+		buildInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if ps, ok := s.(store.PoolStatter); ok {
+		m.registry.MustRegister(newPoolCollector(ps))
+	}
+	return m
+}
+
+// Handler - обработчик /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware - счетчик и гистограмма времени обработки запросов.
+// Маршрут берется из шаблона (/api/user/records/:name), чтобы не плодить метки на каждое имя записи.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m == nil {
+			c.Next()
+			return
+		}
+		t := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(t).Seconds())
+	}
+}
+
+// LoginAttempt - учет попытки входа
+func (m *Metrics) LoginAttempt(success bool) {
+	if m == nil {
+		return
+	}
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// RecordsCreated - учет созданных записей
+func (m *Metrics) RecordsCreated(n int) {
+	if m == nil {
+		return
+	}
+	m.recordsCreated.Add(float64(n))
+}
+
+// RecordsUpdated - учет замененных записей
+func (m *Metrics) RecordsUpdated(n int) {
+	if m == nil {
+		return
+	}
+	m.recordsUpdated.Add(float64(n))
+}
+
+// RecordsDeleted - учет удаленных записей
+func (m *Metrics) RecordsDeleted(n int) {
+	if m == nil {
+		return
+	}
+	m.recordsDeleted.Add(float64(n))
+}
+
+// RecordsFetched - учет записей, отданных клиенту
+func (m *Metrics) RecordsFetched(n int) {
+	if m == nil {
+		return
+	}
+	m.recordsFetched.Add(float64(n))
+}
+
+// AuditExported - учет события аудита, записанного в sink
+func (m *Metrics) AuditExported(sink string) {
+	if m == nil {
+		return
+	}
+	m.auditExported.WithLabelValues(sink).Inc()
+}
+
+// AuditDropped - учет события аудита, не попавшего в sink: очередь переполнена или запись не удалась
+func (m *Metrics) AuditDropped(sink, reason string) {
+	if m == nil {
+		return
+	}
+	m.auditDropped.WithLabelValues(sink, reason).Inc()
+}
+
+// WebhookDelivery - учет попытки доставки вебхука
+func (m *Metrics) WebhookDelivery(result string) {
+	if m == nil {
+		return
+	}
+	m.webhooks.WithLabelValues(result).Inc()
+}
+
+// EventStream - учет открытия (open) или закрытия потока событий
+func (m *Metrics) EventStream(open bool) {
+	if m == nil {
+		return
+	}
+	if open {
+		m.eventStreams.Inc()
+		return
+	}
+	m.eventStreams.Dec()
+}
+
+// EventStreamDropped - учет потока событий, закрытого из-за отстающего клиента
+func (m *Metrics) EventStreamDropped() {
+	if m == nil {
+		return
+	}
+	m.eventsDropped.Inc()
+}
+
+// poolCollector - статистика пула соединений хранилища
+type poolCollector struct {
+	store         store.PoolStatter
+	maxConns      *prometheus.Desc
+	openConns     *prometheus.Desc
+	idleConns     *prometheus.Desc
+	inUseConns    *prometheus.Desc
+	waitCount     *prometheus.Desc
+	waitDuration  *prometheus.Desc
+	maxIdleClosed *prometheus.Desc
+}
+
+// newPoolCollector - конструктор коллектора статистики пула
+func newPoolCollector(s store.PoolStatter) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+	return &poolCollector{
+		store:         s,
+		maxConns:      desc("max_open_connections", "Maximum number of open connections."),
+		openConns:     desc("open_connections", "Number of established connections."),
+		idleConns:     desc("idle_connections", "Number of idle connections."),
+		inUseConns:    desc("in_use_connections", "Number of connections in use."),
+		waitCount:     desc("wait_count_total", "Total number of connections waited for."),
+		waitDuration:  desc("wait_duration_seconds_total", "Total time blocked waiting for a connection."),
+		maxIdleClosed: desc("max_idle_closed_total", "Total number of connections closed as idle."),
+	}
+}
+
+// Describe - реализация prometheus.Collector
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.maxConns
+	ch <- p.openConns
+	ch <- p.idleConns
+	ch <- p.inUseConns
+	ch <- p.waitCount
+	ch <- p.waitDuration
+	ch <- p.maxIdleClosed
+}
+
+// Collect - реализация prometheus.Collector
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	st := p.store.PoolStats()
+	ch <- prometheus.MustNewConstMetric(p.maxConns, prometheus.GaugeValue, float64(st.MaxConns))
+	ch <- prometheus.MustNewConstMetric(p.openConns, prometheus.GaugeValue, float64(st.OpenConns))
+	ch <- prometheus.MustNewConstMetric(p.idleConns, prometheus.GaugeValue, float64(st.IdleConns))
+	ch <- prometheus.MustNewConstMetric(p.inUseConns, prometheus.GaugeValue, float64(st.InUseConns))
+	ch <- prometheus.MustNewConstMetric(p.waitCount, prometheus.CounterValue, float64(st.WaitCount))
+	ch <- prometheus.MustNewConstMetric(p.waitDuration, prometheus.CounterValue, st.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(p.maxIdleClosed, prometheus.CounterValue, float64(st.MaxIdleClosed))
+}
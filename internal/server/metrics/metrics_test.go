@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolStore - хранилище в памяти со статистикой пула
+type poolStore struct {
+	*store.MemoryStore
+}
+
+// PoolStats - реализация store.PoolStatter
+func (poolStore) PoolStats() store.PoolStats {
+	return store.PoolStats{MaxConns: 4, OpenConns: 2, IdleConns: 1, InUseConns: 1}
+}
+
+// scrape - текст метрик в формате Prometheus
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New(poolStore{store.NewMemoryStore()})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/api/user/records/:name", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	for _, name := range []string{"a", "b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/records/"+name, nil))
+	}
+	m.LoginAttempt(true)
+	m.LoginAttempt(false)
+	m.RecordsFetched(3)
+	m.RecordsDeleted(1)
+	m.AuditDropped("syslog", "queue_full")
+	m.EventStream(true)
+	m.EventStream(true)
+	m.EventStream(false)
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`gophkeeper_http_requests_total{method="GET",route="/api/user/records/:name",status="404"} 2`,
+		`gophkeeper_logins_total{result="failure"} 1`,
+		`gophkeeper_logins_total{result="success"} 1`,
+		`gophkeeper_records_fetched_total 3`,
+		`gophkeeper_records_deleted_total 1`,
+		`gophkeeper_audit_events_dropped_total{reason="queue_full",sink="syslog"} 1`,
+		`gophkeeper_event_streams 1`,
+		`gophkeeper_db_open_connections 2`,
+		`gophkeeper_build_info{`,
+	} {
+		assert.True(t, strings.Contains(out, want), "missing %s", want)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.LoginAttempt(true)
+	m.RecordsCreated(1)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -2,6 +2,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -36,11 +37,36 @@ const UserIDKey key = iota
 var ErrTokenNotValid = errors.New("token is not valid")
 var ErrNoUserInToken = errors.New("no user data in token")
 
+// ErrUserDisabled - учетная запись заблокирована администратором
+var ErrUserDisabled = errors.New("account is disabled")
+
+// ErrPasswordChangeRequired - пароль задан администратором, перед входом его нужно сменить
+var ErrPasswordChangeRequired = errors.New("password change required")
+
+// ErrSessionRevoked - токен выдан до принудительного выхода пользователя
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// init - время в токенах с точностью до микросекунд, как время принудительного выхода в хранилище.
+// С точностью до секунды токен, выданный в ту же секунду сразу после выхода, считался бы выданным до него.
+func init() {
+	jwt.TimePrecision = time.Microsecond
+}
+
+// IssuedBefore - токен, выданный в issuedAt, выдан раньше момента t. t округляется до точности времени в токенах.
+func IssuedBefore(issuedAt, t time.Time) bool {
+	return issuedAt.Before(t.Truncate(jwt.TimePrecision))
+}
+
+// SessionCheck - проверка, что пользователь userID может работать с токеном, выданным в issuedAt.
+// Возвращает ErrUserDisabled, ErrSessionRevoked или ErrTokenNotValid.
+type SessionCheck func(ctx context.Context, userID uint64, issuedAt time.Time) error
+
 // BuildJWTString - конструктор JWT строки
 func BuildJWTString(userID uint64) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 		UserID: userID,
 	})
@@ -53,6 +79,15 @@ func BuildJWTString(userID uint64) (string, error) {
 
 // GetUserID- получение ID пользователя из токена
 func GetUserID(tokenString string) (uint64, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseToken - проверка токена и получение данных авторизации
+func ParseToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
@@ -60,43 +95,63 @@ func GetUserID(tokenString string) (uint64, error) {
 		})
 	if err != nil {
 		if !token.Valid {
-			return 0, ErrTokenNotValid
+			return nil, ErrTokenNotValid
 		} else {
-			return 0, errors.New("parsing error")
+			return nil, errors.New("parsing error")
 		}
 	}
 	if claims.UserID == 0 {
-		return 0, ErrNoUserInToken
+		return nil, ErrNoUserInToken
 	}
 	// Проверка на истечение срока действия токена
 	if time.Now().Unix() > claims.ExpiresAt.Time.Unix() {
-		return 0, errors.New("token has expired")
+		return nil, errors.New("token has expired")
 	}
-	return claims.UserID, nil
+	return claims, nil
+}
+
+// issuedAt - время выдачи токена; у токенов без iat - нулевое время
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAt == nil {
+		return time.Time{}
+	}
+	return c.IssuedAt.Time
 }
 
-// AuthMiddleware - авторизация
-func AuthMiddleware(logger *zap.SugaredLogger) gin.HandlerFunc {
+// AuthMiddleware - авторизация. Если check не nil, для каждого запроса проверяется,
+// что учетная запись не заблокирована и токен не отозван принудительным выходом.
+func AuthMiddleware(logger *zap.SugaredLogger, check SessionCheck) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader(AuthorizationHeader)
 		if token == "" {
 			logger.Errorf("Error reading header[%v]: %v", AuthorizationHeader, token)
-			c.AbortWithStatus(http.StatusUnauthorized)
+			c.Status(http.StatusUnauthorized)
+			c.Abort()
 			return
 		}
 		splitToken := strings.Split(token, "Bearer ")
 		token = splitToken[1]
-		userID, err := GetUserID(token)
+		claims, err := ParseToken(token)
+		if err == nil && check != nil {
+			err = check(c.Request.Context(), claims.UserID, claims.issuedAt())
+		}
 		if err != nil {
-			if errors.Is(err, ErrNoUserInToken) || errors.Is(err, ErrTokenNotValid) {
-				c.AbortWithStatus(http.StatusUnauthorized)
+			if errors.Is(err, ErrUserDisabled) {
+				c.Status(http.StatusForbidden)
+				c.Abort()
+				return
+			}
+			if errors.Is(err, ErrNoUserInToken) || errors.Is(err, ErrTokenNotValid) || errors.Is(err, ErrSessionRevoked) {
+				c.Status(http.StatusUnauthorized)
+				c.Abort()
 				return
 			} else {
-				c.AbortWithStatus(http.StatusInternalServerError)
+				c.Status(http.StatusInternalServerError)
+				c.Abort()
 				return
 			}
 		}
-		c.Set(fmt.Sprint(UserIDKey), userID)
+		c.Set(fmt.Sprint(UserIDKey), claims.UserID)
 		c.Next()
 	}
 }
@@ -3,32 +3,189 @@ package logger
 
 import (
 	"bytes"
-	"github.com/gin-gonic/gin"
-	"go.uber.org/zap"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
+	"strings"
 	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/auth"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// DefaultMaxBodySize - сколько байт тела запроса попадает в лог по умолчанию
+	DefaultMaxBodySize = 4096
+	// redacted - значение, которым заменяются секреты
+	redacted = "[REDACTED]"
 )
 
-// Logger - логгер
-func Logger(logger *zap.SugaredLogger) (gin.HandlerFunc, error) {
+// DefaultRedactFields - поля JSON тела, значения которых не попадают в лог
+var DefaultRedactFields = []string{"password", "data", "key", "token"}
+
+// DefaultRedactHeaders - заголовки, значения которых не попадают в лог
+var DefaultRedactHeaders = []string{auth.AuthorizationHeader, "Cookie", "Set-Cookie"}
+
+// Options - настройки логирования запросов
+type Options struct {
+	// LogBody - логировать тело и заголовки запроса; по умолчанию выключено
+	LogBody bool
+	// MaxBodySize - сколько байт тела читать для лога, 0 - DefaultMaxBodySize
+	MaxBodySize int
+	// RedactFields - поля JSON тела для скрытия (без учета регистра), nil - DefaultRedactFields
+	RedactFields []string
+	// RedactHeaders - заголовки для скрытия, nil - DefaultRedactHeaders
+	RedactHeaders []string
+}
+
+// Logger - логгер запросов. Пишет метод, шаблон маршрута, статус, время обработки,
+// ID пользователя, ID запроса и ID трассировки структурированными полями. Тело запроса логируется только
+// при включенном Options.LogBody, с обрезкой по размеру и скрытием секретов.
+func Logger(logger *zap.SugaredLogger, opts Options) (gin.HandlerFunc, error) {
+	if opts.MaxBodySize < 0 {
+		return nil, fmt.Errorf("max body size must not be negative: %d", opts.MaxBodySize)
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = DefaultRedactFields
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	fields := make(map[string]struct{}, len(opts.RedactFields))
+	for _, f := range opts.RedactFields {
+		fields[strings.ToLower(f)] = struct{}{}
+	}
+	l := logger.Desugar()
 	return func(c *gin.Context) {
-		uri := c.Request.RequestURI
-		method := c.Request.Method
-		body, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			return
+		var body []byte
+		if opts.LogBody && c.Request.Body != nil {
+			var err error
+			body, err = peekBody(c.Request, opts.MaxBodySize)
+			if err != nil {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
 		}
-		c.Request.Body = io.NopCloser(bytes.NewReader(body))
 		t := time.Now()
 		c.Next()
-		duration := time.Since(t)
-		logger.Infoln(
-			"URI", uri,
-			"Method", method,
-			"Duration", duration,
-			"Status", c.Writer.Status(),
-			"Size", c.Writer.Size(),
-		)
-		logger.Infoln("Data", string(body))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		logFields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(t)),
+			zap.Int("size", c.Writer.Size()),
+		}
+		if userID, ok := c.Get(auth.UserIDKey.ToString()); ok {
+			logFields = append(logFields, zap.Any("user_id", userID))
+		}
+		if requestID := requestID(c); requestID != "" {
+			logFields = append(logFields, zap.String("request_id", requestID))
+		}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+			logFields = append(logFields, zap.String("trace_id", sc.TraceID().String()))
+		}
+		if opts.LogBody {
+			logFields = append(logFields,
+				zap.Any("headers", redactHeaders(c.Request.Header, opts.RedactHeaders)),
+				zap.String("body", redactBody(body, opts.MaxBodySize, fields)),
+			)
+		}
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case status >= http.StatusBadRequest:
+			level = zapcore.WarnLevel
+		}
+		l.Log(level, "request", logFields...)
 	}, nil
 }
+
+// peekBody - чтение начала тела запроса для лога; обработчик по-прежнему получает тело целиком
+func peekBody(r *http.Request, limit int) ([]byte, error) {
+	head, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	return head, nil
+}
+
+// requestID - ID запроса, назначенный middleware requestid, или заголовок клиента
+func requestID(c *gin.Context) string {
+	if id := requestid.Get(c); id != "" {
+		return id
+	}
+	return c.GetHeader(requestid.Header)
+}
+
+// redactHeaders - заголовки запроса со скрытыми значениями секретов
+func redactHeaders(header http.Header, secret []string) map[string]string {
+	result := make(map[string]string, len(header))
+	for name, values := range header {
+		result[name] = strings.Join(values, ", ")
+	}
+	for _, name := range secret {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := result[name]; ok {
+			result[name] = redacted
+		}
+	}
+	return result
+}
+
+// redactBody - тело запроса для лога. Логируется только JSON со скрытыми полями-секретами;
+// обрезанное или не-JSON тело заменяется описанием, чтобы секреты не попали в лог частично.
+func redactBody(body []byte, limit int, fields map[string]struct{}) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > limit {
+		return fmt.Sprintf("[truncated: more than %d bytes]", limit)
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("[non-JSON body: %d bytes]", len(body))
+	}
+	redacted, err := json.Marshal(redactValue(v, fields))
+	if err != nil {
+		return fmt.Sprintf("[body: %d bytes]", len(body))
+	}
+	return string(redacted)
+}
+
+// redactValue - рекурсивная замена значений полей-секретов
+func redactValue(v interface{}, fields map[string]struct{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if _, ok := fields[strings.ToLower(k)]; ok {
+				value[k] = redacted
+				continue
+			}
+			value[k] = redactValue(item, fields)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item, fields)
+		}
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/middleware/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestRouter - роутер с логгером запросов и обработчиком, читающим тело целиком
+func newTestRouter(t *testing.T, opts Options) (*gin.Engine, *observer.ObservedLogs, *string) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	middleware, err := Logger(zap.New(core).Sugar(), opts)
+	require.NoError(t, err)
+	var received string
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware)
+	r.POST("/api/user/:name", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		received = string(body)
+		c.Status(http.StatusUnauthorized)
+	})
+	return r, logs, &received
+}
+
+func TestLogger_BodyOffByDefault(t *testing.T) {
+	r, logs, _ := newTestRouter(t, Options{})
+	req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"password":"secret"}`))
+	req.Header.Set(requestid.Header, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, zapcore.WarnLevel, entry.Level)
+	fields := entry.ContextMap()
+	assert.Equal(t, "/api/user/:name", fields["route"])
+	assert.Equal(t, int64(http.StatusUnauthorized), fields["status"])
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.NotContains(t, fields, "body")
+}
+
+func TestLogger_RedactsSecrets(t *testing.T) {
+	r, logs, received := newTestRouter(t, Options{LogBody: true})
+	body := `{"login":"user","password":"secret","records":[{"name":"n","data":"payload","key":"k"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, body, *received, "handler must get the original body")
+	fields := logs.All()[0].ContextMap()
+	logged := fields["body"].(string)
+	assert.Contains(t, logged, `"login":"user"`)
+	assert.Contains(t, logged, `"name":"n"`)
+	for _, secret := range []string{"secret", "payload", `"k"`} {
+		assert.NotContains(t, logged, secret)
+	}
+	assert.Equal(t, redacted, fields["headers"].(map[string]string)["Authorization"])
+}
+
+func TestLogger_BodySizeCap(t *testing.T) {
+	r, logs, received := newTestRouter(t, Options{LogBody: true, MaxBodySize: 8})
+	body := `{"password":"secret"}`
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(body)))
+
+	assert.Equal(t, body, *received)
+	assert.Equal(t, "[truncated: more than 8 bytes]", logs.All()[0].ContextMap()["body"])
+}
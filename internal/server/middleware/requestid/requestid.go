@@ -0,0 +1,69 @@
+// Модуль идентификаторов запросов
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/randid"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// Header - заголовок с идентификатором запроса
+	Header = models.RequestIDHeader
+	// contextKey - ключ ID запроса в gin.Context
+	contextKey = "request_id"
+)
+
+type ctxKey struct{}
+
+// validID - допустимый ID запроса от клиента; остальные заменяются сгенерированными,
+// чтобы в логи и заголовки ответа не попадал произвольный текст
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID - принимает X-Request-ID клиента или генерирует новый, сохраняет его в gin.Context
+// и контексте запроса и возвращает в заголовке ответа. Ответы с ошибкой без тела дополняются
+// телом models.ErrorResponse с ID запроса.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !validID.MatchString(id) {
+			var err error
+			if id, err = randid.New(); err != nil {
+				id = "unknown"
+			}
+		}
+		c.Set(contextKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKey{}, id))
+		c.Header(Header, id)
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusBadRequest && !c.Writer.Written() {
+			c.JSON(status, models.ErrorResponse{Error: http.StatusText(status), RequestID: id})
+		}
+	}
+}
+
+// Get - ID текущего запроса
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// FromContext - ID запроса из context.Context
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Logger - логгер с полем request_id текущего запроса
+func Logger(c *gin.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	if id := Get(c); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
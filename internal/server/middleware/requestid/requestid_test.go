@@ -0,0 +1,71 @@
+package requestid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter - роутер с RequestID и обработчиками успешного ответа и ошибки без тела
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c.Request.Context()))
+	})
+	r.GET("/fail", func(c *gin.Context) {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	})
+	return r
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "generated", incoming: "", keep: false},
+		{name: "accepted", incoming: "client-42.abc", keep: true},
+		{name: "invalid replaced", incoming: "bad id\nwith newline", keep: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			newTestRouter().ServeHTTP(w, req)
+
+			id := w.Header().Get(Header)
+			require.NotEmpty(t, id)
+			assert.Equal(t, id, w.Body.String(), "request context must carry the same ID")
+			if tt.keep {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id)
+			}
+		})
+	}
+}
+
+func TestRequestID_ErrorBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	req.Header.Set(Header, "req-1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var body models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "req-1", body.RequestID)
+	assert.Equal(t, http.StatusText(http.StatusNotFound), body.Error)
+}
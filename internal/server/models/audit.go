@@ -0,0 +1,67 @@
+// Модуль журнала аудита
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Действия журнала аудита
+const (
+	AuditLoginSuccess    = "login_success"
+	AuditLoginFailure    = "login_failure"
+	AuditRecordCreate    = "record_create"
+	AuditRecordRead      = "record_read"
+	AuditRecordList      = "record_list"
+	AuditRecordUpdate    = "record_update"
+	AuditRecordDelete    = "record_delete"
+	AuditDeviceEnroll    = "device_enroll"
+	AuditSessionsRevoked = "sessions_revoked"
+	AuditPasswordReset   = "password_reset"
+	AuditPasswordChange  = "password_change"
+	AuditAccountDisabled = "account_disabled"
+	AuditAccountEnabled  = "account_enabled"
+)
+
+// AuditEvent - событие журнала аудита. События образуют цепочку: Hash каждого события считается
+// от его полей и Hash предыдущего (PrevHash), поэтому удаление или изменение строки обнаруживается проверкой.
+type AuditEvent struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// UserID - пользователь, 0 - неизвестен (вход с несуществующим логином)
+	UserID uint64 `json:"-"`
+	Action string `json:"action"`
+	// RecordID - запись, к которой относится событие, 0 - нет
+	RecordID  uint64 `json:"record_id,omitempty"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Details   string `json:"details,omitempty"`
+	PrevHash  string `json:"-"`
+	Hash      string `json:"-"`
+}
+
+// AuditPage - страница журнала аудита, от новых событий к старым
+type AuditPage struct {
+	Events []AuditEvent `json:"events"`
+	// NextBefore - значение before для следующей страницы, 0 - событий больше нет
+	NextBefore uint64 `json:"next_before"`
+}
+
+// ComputeHash - SHA-256 в hex от PrevHash и полей события. Время берется с точностью до микросекунд,
+// как его хранит база.
+func (e *AuditEvent) ComputeHash() string {
+	fields, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		e.UserID,
+		e.Action,
+		e.RecordID,
+		e.IP,
+		e.UserAgent,
+		e.Details,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+// Модуль изменений записей для синхронизации
+package models
+
+import "time"
+
+// Операции изменения записи
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// IfMatchHeader - версия записи, от которой клиент меняет или удаляет ее: если запись с тех пор изменена,
+// сервер отвечает 412 и ничего не меняет
+const IfMatchHeader = "If-Match"
+
+// RecordChange - изменение записи после курсора синхронизации
+type RecordChange struct {
+	// Version - номер изменения, по возрастанию которого изменения нужно применять
+	Version uint64 `json:"version"`
+	Op      string `json:"op"`
+	// Record - текущее состояние записи; у удаленной записи заполнены только ID, тип, название и версия
+	Record    DataRecord `json:"record"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// RecordChanges - страница изменений записей пользователя
+type RecordChanges struct {
+	Changes []RecordChange `json:"changes"`
+	// Cursor - значение since для следующего запроса
+	Cursor uint64 `json:"cursor"`
+	// More - изменений больше, чем поместилось в страницу, следующую нужно запросить сразу
+	More bool `json:"more"`
+}
+
+// RecordTombstone - след удаленной записи, по которому клиенты удаляют свои копии
+type RecordTombstone struct {
+	RecordID  uint64
+	UserID    uint64
+	Type      DataType
+	Name      string
+	Version   uint64
+	DeletedAt time.Time
+}
+
+// Change - изменение удаления записи
+func (t *RecordTombstone) Change() RecordChange {
+	deletedAt := t.DeletedAt
+	return RecordChange{
+		Version:   t.Version,
+		Op:        ChangeDeleted,
+		Record:    DataRecord{ID: t.RecordID, Type: t.Type, Name: t.Name, Version: t.Version},
+		DeletedAt: &deletedAt,
+	}
+}
@@ -42,6 +42,8 @@ type DataRecord struct {
 	User       User      `json:"-"`
 	UserID     uint64    `json:"-"`
 	Key        string    `json:"key"`
+	// Version - номер изменения пользователя, которым запись создана или последний раз изменена
+	Version uint64 `json:"version"`
 }
 
 // DataRecordRequest - структура данных запроса
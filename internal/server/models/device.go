@@ -0,0 +1,31 @@
+// Модуль устройств пользователя
+package models
+
+import "time"
+
+// Device - устройство пользователя с клиентским сертификатом (mTLS)
+type Device struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"-"`
+	Name   string `json:"name"`
+	// Fingerprint - SHA-256 сертификата устройства в hex, по нему сертификат сопоставляется с устройством
+	Fingerprint string     `json:"fingerprint"`
+	Subject     string     `json:"subject"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// EnrollRequest - запрос на выпуск сертификата устройства
+type EnrollRequest struct {
+	// Name - название устройства, например имя хоста
+	Name string `json:"name"`
+	// CSR - запрос на подпись сертификата в PEM
+	CSR string `json:"csr"`
+}
+
+// EnrollResponse - выпущенный сертификат устройства и сертификат CA в PEM
+type EnrollResponse struct {
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
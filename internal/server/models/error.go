@@ -0,0 +1,11 @@
+// Модуль ошибок API
+package models
+
+// RequestIDHeader - заголовок с идентификатором запроса, который клиент передает, а сервер возвращает
+const RequestIDHeader = "X-Request-ID"
+
+// ErrorResponse - тело ответа с ошибкой
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id"`
+}
@@ -0,0 +1,21 @@
+// Модуль событий изменения записей
+package models
+
+import "time"
+
+// Типы событий записей
+const (
+	RecordCreated = "record.created"
+	RecordUpdated = "record.updated"
+	RecordDeleted = "record.deleted"
+)
+
+// RecordEvent - событие изменения записи пользователя для подключенных клиентов.
+// Названия и данные записей в событие не входят: клиент получает их отдельным запросом.
+type RecordEvent struct {
+	Type       string    `json:"type"`
+	UserID     uint64    `json:"user_id"`
+	RecordID   uint64    `json:"record_id"`
+	RecordType DataType  `json:"record_type,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+// Модуль ключей идемпотентности
+package models
+
+import "time"
+
+// Заголовки идемпотентного создания записи
+const (
+	// IdempotencyKeyHeader - ключ, с которым клиент повторяет запрос создания записи без риска создать дубликат
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader - ответ на повтор уже выполненного запроса, запись не создавалась заново
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyKey - ключ идемпотентности, с которым пользователь создал запись
+type IdempotencyKey struct {
+	UserID uint64
+	Key    string
+	// RequestHash - хэш содержимого запроса: тот же ключ с другим содержимым - ошибка клиента
+	RequestHash string
+	RecordID    uint64
+	CreatedAt   time.Time
+}
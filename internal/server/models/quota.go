@@ -0,0 +1,50 @@
+// Модуль квот хранилища пользователя
+package models
+
+// Quota - ограничения хранилища пользователя, 0 - без ограничения
+type Quota struct {
+	// MaxRecords - максимальное количество записей
+	MaxRecords int64 `json:"max_records"`
+	// MaxBytes - максимальный суммарный размер данных записей, байт
+	MaxBytes int64 `json:"max_bytes"`
+	// MaxRecordSize - максимальный размер данных одной записи, байт
+	MaxRecordSize int64 `json:"max_record_size"`
+}
+
+// QuotaOverride - квоты пользователя, заданные администратором; nil - значение из конфигурации сервера
+type QuotaOverride struct {
+	MaxRecords    *int64
+	MaxBytes      *int64
+	MaxRecordSize *int64
+}
+
+// Usage - использование хранилища пользователем и его квоты
+type Usage struct {
+	// Records - количество записей
+	Records int64 `json:"records"`
+	// Bytes - суммарный размер данных записей, байт
+	Bytes  int64 `json:"bytes"`
+	Limits Quota `json:"limits"`
+}
+
+// Apply - квоты с учетом заданных администратором значений
+func (q Quota) Apply(o *QuotaOverride) Quota {
+	if o == nil {
+		return q
+	}
+	if o.MaxRecords != nil {
+		q.MaxRecords = *o.MaxRecords
+	}
+	if o.MaxBytes != nil {
+		q.MaxBytes = *o.MaxBytes
+	}
+	if o.MaxRecordSize != nil {
+		q.MaxRecordSize = *o.MaxRecordSize
+	}
+	return q
+}
+
+// IsEmpty - не задано ни одного значения
+func (o *QuotaOverride) IsEmpty() bool {
+	return o.MaxRecords == nil && o.MaxBytes == nil && o.MaxRecordSize == nil
+}
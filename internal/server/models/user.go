@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 var (
@@ -17,6 +19,22 @@ type User struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 	ID       uint64 `json:"id,omitempty"`
+	// DisabledAt - время блокировки учетной записи администратором, nil - учетная запись активна
+	DisabledAt  *time.Time `json:"-"`
+	LastLoginAt *time.Time `json:"-"`
+	// SessionsRevokedAt - время принудительного выхода: токены, выданные раньше, недействительны
+	SessionsRevokedAt *time.Time `json:"-"`
+	// MustChangePassword - пароль задан администратором, войти с ним можно только для смены пароля
+	MustChangePassword bool `json:"-"`
+}
+
+// UserStats - пользователь с объемом хранимых данных, для администрирования
+type UserStats struct {
+	User
+	// Records - количество записей
+	Records int
+	// DataSize - суммарный размер данных записей в хранилище, байт
+	DataSize int64
 }
 
 // UserCredentialsSchema - структура для хранения данных пользователя
@@ -25,6 +43,13 @@ type UserCredentialsSchema struct {
 	Password string `json:"password"`
 }
 
+// PasswordChangeRequest - запрос смены пароля: текущий пароль и новый
+type PasswordChangeRequest struct {
+	Login       string `json:"login"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
 // TokenResponse - ответ сервера
 type TokenResponse struct {
 	Token     string `json:"token"`
@@ -33,5 +58,32 @@ type TokenResponse struct {
 
 // GetUserFolder - получить путь к папке пользователя
 func (u *User) GetUserFolder() ([]fs.DirEntry, error) {
-	return os.ReadDir(fmt.Sprintf("./userdata/%s-%d", u.Login, u.ID))
+	return os.ReadDir(u.FolderPath())
+}
+
+// FolderPath - путь к папке пользователя
+func (u *User) FolderPath() string {
+	return fmt.Sprintf("./userdata/%s-%d", u.Login, u.ID)
+}
+
+// FolderSize - размер файлов в папке пользователя, байт; если папки нет - 0
+func (u *User) FolderSize() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(u.FolderPath(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return size, err
 }
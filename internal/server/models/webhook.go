@@ -0,0 +1,95 @@
+// Модуль вебхуков
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// События вебхуков
+const (
+	WebhookRecordCreated   = "record.created"
+	WebhookRecordUpdated   = "record.updated"
+	WebhookRecordDeleted   = "record.deleted"
+	WebhookAccountLogin    = "account.login"
+	WebhookSessionsRevoked = "account.sessions_revoked"
+	WebhookPasswordReset   = "account.password_reset"
+	WebhookAccountDisabled = "account.disabled"
+	WebhookAccountEnabled  = "account.enabled"
+	// WebhookTest - проверочное событие, отправляется только по запросу пользователя
+	WebhookTest = "webhook.test"
+)
+
+// WebhookEvents - события, на которые можно подписаться
+var WebhookEvents = []string{
+	WebhookRecordCreated,
+	WebhookRecordUpdated,
+	WebhookRecordDeleted,
+	WebhookAccountLogin,
+	WebhookSessionsRevoked,
+	WebhookPasswordReset,
+	WebhookAccountDisabled,
+	WebhookAccountEnabled,
+}
+
+// Webhook - подписка пользователя на события
+type Webhook struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"-"`
+	URL    string `json:"url"`
+	// Events - события подписки, пустой список - все события
+	Events []string `json:"events"`
+	// Secret - ключ подписи HMAC-SHA256, возвращается только при создании
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches - подписан ли вебхук на событие
+func (w *Webhook) Matches(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// WebhookRequest - запрос на создание вебхука
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret - ключ подписи; если пуст, сервер создает случайный
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload - тело запроса вебхука. Содержит только метаданные: данные записей и их названия не передаются.
+type WebhookPayload struct {
+	// ID - уникальный идентификатор события, повторные попытки доставки отправляют тот же ID
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint64    `json:"user_id"`
+	// RecordID - запись, к которой относится событие, 0 - нет
+	RecordID   uint64   `json:"record_id,omitempty"`
+	RecordType DataType `json:"record_type,omitempty"`
+}
+
+// WebhookDelivery - доставка события вебхуку из очереди (outbox)
+type WebhookDelivery struct {
+	ID            uint64
+	WebhookID     uint64
+	Event         string
+	Payload       string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastStatus    int
+	LastError     string
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time
+	// URL, Secret и владелец вебхука, заполняются при выборке доставок к отправке
+	URL    string
+	Secret string
+	UserID uint64
+}
+
+// WebhookTestResult - результат проверочной отправки
+type WebhookTestResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,361 @@
+// Модуль доставки вебхуков
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/buildinfo"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/adapters/store"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/metrics"
+	"github.com/EvgeniyBudaev/gophkeeper/internal/server/models"
+	"go.uber.org/zap"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderEvent     = "X-Gophkeeper-Event"
+	HeaderDelivery  = "X-Gophkeeper-Delivery"
+	HeaderTimestamp = "X-Gophkeeper-Timestamp"
+	// HeaderSignature - "sha256=" и HMAC-SHA256 в hex от "<timestamp>.<тело>" с секретом вебхука
+	HeaderSignature = "X-Gophkeeper-Signature"
+)
+
+const (
+	// defaultMaxAttempts - попыток доставки по умолчанию, после них доставка считается неудачной
+	defaultMaxAttempts = 10
+	// минимальная и максимальная пауза между попытками: 30s, 1m, 2m, ... до 1h
+	minBackoff = 30 * time.Second
+	maxBackoff = time.Hour
+	// requestTimeout - таймаут одного запроса к получателю
+	requestTimeout = 10 * time.Second
+	// pollInterval - как часто проверяется очередь, если новых событий нет
+	pollInterval = 5 * time.Second
+	// claimLimit - сколько доставок выбирается за раз
+	claimLimit = 20
+	// claimLease - на сколько откладываются выбранные доставки, должно быть больше requestTimeout * claimLimit
+	claimLease = 5 * time.Minute
+	// retention - сколько хранятся завершенные доставки
+	retention = 7 * 24 * time.Hour
+	// purgeInterval - как часто удаляются старые доставки
+	purgeInterval = time.Hour
+	// secretLen - длина секрета, создаваемого сервером, байт
+	secretLen = 32
+	// maxErrorLen - сколько байт ошибки или ответа получателя сохраняется
+	maxErrorLen = 512
+)
+
+// ErrPrivateAddress - адрес получателя во внутренней сети, а такие адреса запрещены конфигурацией
+var ErrPrivateAddress = errors.New("webhook address is in a private network")
+
+// Options - настройки доставки
+type Options struct {
+	// MaxAttempts - попыток доставки, 0 - 10
+	MaxAttempts int
+	// AllowPrivate - разрешить адреса loopback и внутренних сетей (для локальной проверки вебхуков)
+	AllowPrivate bool
+}
+
+// Deliverer - доставка событий из очереди (outbox) с повторными попытками и экспоненциальной паузой.
+// Несколько реплик могут работать с одной базой: доставки выбираются с блокировкой (см. ClaimWebhookDeliveries).
+type Deliverer struct {
+	store   store.Store
+	logger  *zap.SugaredLogger
+	metrics *metrics.Metrics
+	client  *http.Client
+	// maxAttempts и allowPrivate меняются SetOptions во время доставки
+	maxAttempts  atomic.Int64
+	allowPrivate atomic.Bool
+	wake         chan struct{}
+	now          func() time.Time
+}
+
+// NewDeliverer - конструктор доставки. metrics может быть nil.
+func NewDeliverer(s store.Store, logger *zap.SugaredLogger, m *metrics.Metrics, opts Options) *Deliverer {
+	d := &Deliverer{
+		store:   s,
+		logger:  logger,
+		metrics: m,
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+	}
+	dialer := &net.Dialer{Timeout: requestTimeout, Control: d.checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	d.client = &http.Client{
+		Transport: transport,
+		Timeout:   requestTimeout,
+		// переадресация могла бы увести запрос во внутреннюю сеть в обход проверки URL
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	d.SetOptions(opts)
+	return d
+}
+
+// SetOptions - замена настроек доставки, в том числе во время работы (перечитывание конфигурации по SIGHUP).
+// Следующие попытки доставки выполняются с новыми настройками.
+func (d *Deliverer) SetOptions(opts Options) {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	d.maxAttempts.Store(int64(maxAttempts))
+	d.allowPrivate.Store(opts.AllowPrivate)
+	// открытые соединения проверены по старым настройкам
+	d.client.CloseIdleConnections()
+}
+
+// checkAddress - проверка адреса соединения по текущей настройке AllowPrivate
+func (d *Deliverer) checkAddress(network, address string, c syscall.RawConn) error {
+	if d.allowPrivate.Load() {
+		return nil
+	}
+	return denyPrivate(network, address, c)
+}
+
+// denyPrivate - запрет соединений с loopback, внутренними и служебными адресами.
+// Проверяется адрес после разрешения имени, поэтому DNS имя, указывающее во внутреннюю сеть, тоже не пройдет.
+func denyPrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// ValidateURL - проверка адреса вебхука: http или https с именем хоста
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("invalid webhook URL: use http:// or https://")
+	}
+	if u.Hostname() == "" {
+		return errors.New("invalid webhook URL: host is not set")
+	}
+	if u.User != nil {
+		return errors.New("invalid webhook URL: credentials in URL are not allowed, use the signature")
+	}
+	return nil
+}
+
+// ValidateEvents - все события подписки известны
+func ValidateEvents(events []string) error {
+	for _, e := range events {
+		if !slices.Contains(models.WebhookEvents, e) {
+			return fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+	return nil
+}
+
+// NewSecret - случайный секрет подписи
+func NewSecret() (string, error) {
+	b := make([]byte, secretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign - подпись тела запроса: "sha256=" и HMAC-SHA256 от "<timestamp>.<body>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newPayload - тело события с уникальным ID
+func newPayload(event string, userID uint64, p models.WebhookPayload) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("error generating webhook event id: %w", err)
+	}
+	p.ID = hex.EncodeToString(id)
+	p.Event = event
+	p.UserID = userID
+	p.CreatedAt = time.Now().UTC()
+	return json.Marshal(p)
+}
+
+// Enqueue - постановка события в очередь доставки всех вебхуков пользователя, подписанных на него.
+// p задает поля события, относящиеся к записи; ID, событие, пользователь и время заполняются здесь.
+// Секреты вебхуков не читаются: их расшифровывает только доставка. Возвращает количество поставленных
+// в очередь доставок.
+func Enqueue(ctx context.Context, s store.Store, userID uint64, event string, p models.WebhookPayload) (int, error) {
+	payload, err := newPayload(event, userID, p)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.EnqueueWebhookEvent(ctx, userID, event, string(payload))
+	return int(n), err
+}
+
+// Notify - разбудить доставку после постановки событий в очередь, не дожидаясь очередной проверки
+func (d *Deliverer) Notify() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run - доставка событий до отмены ctx
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		d.DeliverPending(ctx)
+		if d.now().Sub(lastPurge) > purgeInterval {
+			lastPurge = d.now()
+			n, err := d.store.PurgeWebhookDeliveries(ctx, lastPurge.Add(-retention))
+			if err != nil {
+				d.logger.Errorw("cannot purge webhook deliveries", zap.Error(err))
+			} else if n > 0 {
+				d.logger.Infof("purged %d old webhook deliveries", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverPending - отправка всех доставок, время которых наступило
+func (d *Deliverer) DeliverPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.now(), claimLease, claimLimit)
+		if err != nil {
+			d.logger.Errorw("cannot claim webhook deliveries", zap.Error(err))
+			return
+		}
+		for i := range deliveries {
+			d.attempt(ctx, &deliveries[i])
+		}
+		if len(deliveries) < claimLimit {
+			return
+		}
+	}
+}
+
+// attempt - одна попытка доставки и сохранение ее результата
+func (d *Deliverer) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	status, err := d.Send(ctx, delivery.URL, delivery.Secret, delivery.Event, delivery.ID, []byte(delivery.Payload))
+	now := d.now().UTC()
+	delivery.LastStatus = status
+	delivery.LastError = ""
+	result := "delivered"
+	switch {
+	case err == nil:
+		delivery.DeliveredAt = &now
+	case int64(delivery.Attempts) >= d.maxAttempts.Load():
+		delivery.LastError = truncate(err.Error())
+		delivery.FailedAt = &now
+		result = "failed"
+	default:
+		delivery.LastError = truncate(err.Error())
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+		result = "retry"
+	}
+	if err != nil {
+		d.logger.Infow("webhook delivery attempt failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID,
+			"attempt", delivery.Attempts, "result", result, zap.Error(err))
+	}
+	d.metrics.WebhookDelivery(result)
+	// результат сохраняется и при отмене ctx, иначе отправленное событие уйдет повторно
+	if err := d.store.UpdateWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		d.logger.Errorw("cannot save webhook delivery", "delivery_id", delivery.ID, zap.Error(err))
+	}
+}
+
+// Backoff - пауза перед следующей попыткой после attempts неудачных: 30s, 1m, 2m, ... не больше 1h
+func Backoff(attempts int) time.Duration {
+	backoff := minBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// Send - подписанный POST запрос с телом события. Успешна доставка с ответом 2xx;
+// возвращает код ответа (0, если ответа нет).
+func (d *Deliverer) Send(ctx context.Context, target, secret, event string, deliveryID uint64, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gophkeeper-webhooks/"+buildinfo.Get().Version)
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(deliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLen))
+		return resp.StatusCode, fmt.Errorf("receiver responded %s: %s", resp.Status, text)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorLen))
+	return resp.StatusCode, nil
+}
+
+// SendTest - проверочное событие вебхуку сразу, без очереди
+func (d *Deliverer) SendTest(ctx context.Context, w *models.Webhook) models.WebhookTestResult {
+	payload, err := newPayload(models.WebhookTest, w.UserID, models.WebhookPayload{})
+	if err != nil {
+		return models.WebhookTestResult{Error: err.Error()}
+	}
+	status, err := d.Send(ctx, w.URL, w.Secret, models.WebhookTest, 0, payload)
+	if err != nil {
+		return models.WebhookTestResult{Status: status, Error: truncate(err.Error())}
+	}
+	return models.WebhookTestResult{Status: status}
+}
+
+// truncate - ограничение длины сохраняемой ошибки
+func truncate(s string) string {
+	if len(s) > maxErrorLen {
+		return s[:maxErrorLen]
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+// Модуль трассировки OpenTelemetry, общий для сервера и клиента
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/EvgeniyBudaev/gophkeeper/internal/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Экспортеры трассировки
+const (
+	// ExporterNone - спаны не экспортируются, но контекст трассировки передается дальше
+	ExporterNone = "none"
+	// ExporterOTLP - OTLP/HTTP, например в локальный OpenTelemetry Collector
+	ExporterOTLP = "otlp"
+	// ExporterStdout - спаны в JSON в стандартный вывод
+	ExporterStdout = "stdout"
+	// ExporterFile - спаны в JSON в файл
+	ExporterFile = "file"
+)
+
+// Options - настройки трассировки
+type Options struct {
+	// ServiceName - имя сервиса в спанах
+	ServiceName string
+	// Exporter - none (по умолчанию), otlp, stdout или file
+	Exporter string
+	// Endpoint - адрес OTLP/HTTP коллектора host:port; пустой - значение OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318
+	Endpoint string
+	// Insecure - OTLP без TLS
+	Insecure bool
+	// File - файл для экспортера file
+	File string
+	// SampleRatio - доля трассируемых запросов от 0 до 1; 0 - все запросы
+	SampleRatio float64
+}
+
+// Shutdown - сброс накопленных спанов и остановка экспортера
+type Shutdown func(ctx context.Context) error
+
+// Setup - настройка глобальных TracerProvider и пропагатора W3C Trace Context.
+// Пропагатор настраивается и без экспортера, чтобы контекст трассировки клиента не терялся.
+func Setup(ctx context.Context, opts Options) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	exporter, closer, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(buildinfo.Get().Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+	sampler := sdktrace.AlwaysSample()
+	if opts.SampleRatio > 0 && opts.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(opts.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// newExporter - экспортер по настройкам; nil, если экспорт выключен
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, io.Closer, error) {
+	switch strings.ToLower(opts.Exporter) {
+	case "", ExporterNone:
+		return nil, nil, nil
+	case ExporterOTLP:
+		var otlpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, otlpOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating stdout trace exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case ExporterFile:
+		if opts.File == "" {
+			return nil, nil, errors.New("trace file is not set")
+		}
+		f, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, fmt.Errorf("error creating file trace exporter: %w", err)
+		}
+		return exporter, f, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q: use none, otlp, stdout or file", opts.Exporter)
+	}
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Options{ServiceName: "test", Exporter: ExporterFile, File: path})
+	require.NoError(t, err)
+	_, span := otel.Tracer("test").Start(context.Background(), "file-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"file-span"`)
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Exporter: "jaeger"})
+	assert.Error(t, err)
+}
+
+func TestPropagation(t *testing.T) {
+	_, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(otelgin.Middleware("server"))
+	r.GET("/api/user/records/:name", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, span := otel.Tracer("client").Start(context.Background(), "records sync")
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/user/records/a", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	span.End()
+
+	spans := recorder.Ended()
+	require.NotEmpty(t, spans)
+	for _, s := range spans {
+		assert.Equal(t, span.SpanContext().TraceID(), s.SpanContext().TraceID(), "span %s is not in the client trace", s.Name())
+	}
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	assert.Contains(t, names, "/api/user/records/:name")
+}
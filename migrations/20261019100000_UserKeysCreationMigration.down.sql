@@ -0,0 +1,8 @@
+DROP INDEX data_records_user_name_index_idx;
+ALTER TABLE data_records
+    DROP COLUMN name_index,
+    ALTER COLUMN type TYPE VARCHAR(255),
+    ALTER COLUMN checksum TYPE VARCHAR(255),
+    ALTER COLUMN filepath TYPE VARCHAR(255),
+    ALTER COLUMN name TYPE VARCHAR(255);
+DROP TABLE user_keys;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE user_keys
+(
+    user_id BIGINT NOT NULL PRIMARY KEY,
+    kek_id VARCHAR(32) NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    rotated_at TIMESTAMP
+);
+ALTER TABLE data_records
+    ALTER COLUMN type TYPE TEXT,
+    ALTER COLUMN checksum TYPE TEXT,
+    ALTER COLUMN filepath TYPE TEXT,
+    ALTER COLUMN name TYPE TEXT,
+    ADD COLUMN name_index VARCHAR(64);
+CREATE UNIQUE INDEX data_records_user_name_index_idx ON data_records (user_id, name_index);
\ No newline at end of file
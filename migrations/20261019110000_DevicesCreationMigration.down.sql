@@ -0,0 +1 @@
+DROP TABLE devices;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE devices
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL UNIQUE,
+    subject TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX devices_user_id_idx ON devices (user_id);
\ No newline at end of file
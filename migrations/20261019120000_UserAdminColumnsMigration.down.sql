@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN must_change_password;
+ALTER TABLE users DROP COLUMN sessions_revoked_at;
+ALTER TABLE users DROP COLUMN last_login_at;
+ALTER TABLE users DROP COLUMN disabled_at;
\ No newline at end of file
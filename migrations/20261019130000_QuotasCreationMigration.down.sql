@@ -0,0 +1,2 @@
+DROP TABLE user_quotas;
+ALTER TABLE data_records DROP COLUMN size;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE data_records ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+UPDATE data_records SET size = octet_length(data) WHERE data IS NOT NULL;
+CREATE TABLE user_quotas
+(
+    user_id BIGINT NOT NULL PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    max_records BIGINT,
+    max_bytes BIGINT,
+    max_record_size BIGINT
+);
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE audit_events
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id BIGINT NOT NULL DEFAULT 0,
+    action VARCHAR(64) NOT NULL,
+    record_id BIGINT NOT NULL DEFAULT 0,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, id);
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
\ No newline at end of file
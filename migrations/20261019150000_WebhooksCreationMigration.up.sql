@@ -0,0 +1,27 @@
+CREATE TABLE webhooks
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id);
+CREATE TABLE webhook_deliveries
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    webhook_id BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP,
+    failed_at TIMESTAMP
+);
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at)
+    WHERE delivered_at IS NULL AND failed_at IS NULL;
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
\ No newline at end of file
@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN tombstones_purged_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE data_records
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN created_version BIGINT NOT NULL DEFAULT 0;
+UPDATE data_records
+SET version = (SELECT count(*) FROM data_records p WHERE p.user_id = data_records.user_id AND p.id <= data_records.id);
+UPDATE data_records SET created_version = version;
+UPDATE users SET change_seq = (SELECT count(*) FROM data_records d WHERE d.user_id = users.id);
+CREATE INDEX data_records_user_version_idx ON data_records (user_id, version);
+CREATE TABLE record_tombstones
+(
+    record_id BIGINT NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    deleted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX record_tombstones_user_version_idx ON record_tombstones (user_id, version);
+CREATE INDEX record_tombstones_deleted_at_idx ON record_tombstones (deleted_at);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys
+(
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    record_id BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
\ No newline at end of file
@@ -0,0 +1,15 @@
+// Модуль встроенных миграций
+package migrations
+
+import "embed"
+
+// Postgres - миграции схемы PostgreSQL в формате golang-migrate (<версия>_<имя>.up|down.sql)
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+// SQLite - миграции схемы для встроенного хранилища SQLite.
+// Версии и имена файлов совпадают с миграциями PostgreSQL в корне каталога.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
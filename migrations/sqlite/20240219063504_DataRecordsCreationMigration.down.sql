@@ -0,0 +1 @@
+DROP TABLE data_records;
\ No newline at end of file
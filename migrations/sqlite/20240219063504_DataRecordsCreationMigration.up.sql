@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS data_records
+(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    uploaded_at TIMESTAMP NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    checksum VARCHAR(255),
+    data TEXT,
+    filepath VARCHAR(255),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    user_id BIGINT NOT NULL,
+    key VARCHAR
+);
\ No newline at end of file
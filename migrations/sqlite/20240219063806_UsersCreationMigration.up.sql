@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    login VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL
+);
\ No newline at end of file
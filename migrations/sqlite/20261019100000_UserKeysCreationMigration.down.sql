@@ -0,0 +1,3 @@
+DROP INDEX data_records_user_name_index_idx;
+ALTER TABLE data_records DROP COLUMN name_index;
+DROP TABLE user_keys;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE user_keys
+(
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    kek_id VARCHAR(32) NOT NULL,
+    wrapped_key BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMP
+);
+ALTER TABLE data_records ADD COLUMN name_index VARCHAR(64);
+CREATE UNIQUE INDEX data_records_user_name_index_idx ON data_records (user_id, name_index);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE data_records ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+UPDATE data_records SET size = octet_length(data) WHERE data IS NOT NULL;
+CREATE TABLE user_quotas
+(
+    user_id INTEGER NOT NULL PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    max_records INTEGER,
+    max_bytes INTEGER,
+    max_record_size INTEGER
+);
\ No newline at end of file
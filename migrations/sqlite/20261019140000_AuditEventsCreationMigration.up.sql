@@ -0,0 +1,22 @@
+CREATE TABLE audit_events
+(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    created_at TIMESTAMP NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    action VARCHAR(64) NOT NULL,
+    record_id INTEGER NOT NULL DEFAULT 0,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, id);
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE record_tombstones;
+DROP INDEX data_records_user_version_idx;
+ALTER TABLE data_records DROP COLUMN created_version;
+ALTER TABLE data_records DROP COLUMN version;
+ALTER TABLE users DROP COLUMN tombstones_purged_seq;
+ALTER TABLE users DROP COLUMN change_seq;
\ No newline at end of file
@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN tombstones_purged_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE data_records ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE data_records ADD COLUMN created_version INTEGER NOT NULL DEFAULT 0;
+UPDATE data_records
+SET version = (SELECT count(*) FROM data_records p WHERE p.user_id = data_records.user_id AND p.id <= data_records.id);
+UPDATE data_records SET created_version = version;
+UPDATE users SET change_seq = (SELECT count(*) FROM data_records d WHERE d.user_id = users.id);
+CREATE INDEX data_records_user_version_idx ON data_records (user_id, version);
+CREATE TABLE record_tombstones
+(
+    record_id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    deleted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX record_tombstones_user_version_idx ON record_tombstones (user_id, version);
+CREATE INDEX record_tombstones_deleted_at_idx ON record_tombstones (deleted_at);
\ No newline at end of file